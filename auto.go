@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+
+	lz4 "rzstd/src"
+)
+
+// autoSample is how much of the input -auto looks at.
+const autoSample = 64 * 1024
+
+// compressedMagics are the signatures of formats that are already
+// compressed, so LZ4 cannot shrink them.
+var compressedMagics = []struct {
+	kind   string
+	offset int
+	magic  string
+}{
+	{"JPEG image", 0, "\xFF\xD8\xFF"},
+	{"PNG image", 0, "\x89PNG"},
+	{"GIF image", 0, "GIF8"},
+	{"WebP image", 8, "WEBP"},
+	{"MP4 video", 4, "ftyp"},
+	{"Matroska video", 0, "\x1A\x45\xDF\xA3"},
+	{"MP3 audio", 0, "ID3"},
+	{"Ogg media", 0, "OggS"},
+	{"FLAC audio", 0, "fLaC"},
+	{"gzip archive", 0, "\x1F\x8B"},
+	{"zip archive", 0, "PK\x03\x04"},
+	{"zstd archive", 0, "\x28\xB5\x2F\xFD"},
+	{"xz archive", 0, "\xFD7zXZ"},
+	{"bzip2 archive", 0, "BZh"},
+	{"7z archive", 0, "7z\xBC\xAF"},
+	{"PDF document", 0, "%PDF"},
+}
+
+var compressedExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true,
+	".mp4": true, ".mkv": true, ".mov": true, ".webm": true, ".avi": true,
+	".mp3": true, ".ogg": true, ".flac": true, ".aac": true, ".m4a": true, ".opus": true,
+	".gz": true, ".tgz": true, ".zip": true, ".zst": true, ".xz": true, ".bz2": true, ".7z": true, ".rar": true,
+	".lz4": true, ".br": true, ".jar": true, ".apk": true, ".docx": true, ".xlsx": true, ".pptx": true,
+}
+
+// autoDecision is what -auto picked for a file and why.
+type autoDecision struct {
+	reason  string
+	summary string
+	options []lz4.Option
+}
+
+func (d autoDecision) String() string {
+	return d.summary + " (" + d.reason + ")"
+}
+
+// detectProfile picks compression settings for the file name from a sample
+// of its start: inputs that are already compressed, by magic number,
+// extension or entropy, get the fastest level since matches are rare, and
+// text gets the second hash table for longer matches.
+func detectProfile(name string, sample []byte) autoDecision {
+	fastest := autoDecision{summary: "fastest level", options: []lz4.Option{lz4.WithLevel(-5)}}
+	for _, m := range compressedMagics {
+		if len(sample) >= m.offset+len(m.magic) && string(sample[m.offset:m.offset+len(m.magic)]) == m.magic {
+			fastest.reason = m.kind
+			return fastest
+		}
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	if compressedExts[ext] {
+		fastest.reason = ext + " file"
+		return fastest
+	}
+
+	h := entropy(sample)
+	switch {
+	case h > 7.5:
+		fastest.reason = fmt.Sprintf("%.2f bits of entropy per byte", h)
+		return fastest
+	case h > 6:
+		return autoDecision{
+			reason:  fmt.Sprintf("%.2f bits of entropy per byte", h),
+			summary: "fast level",
+			options: []lz4.Option{lz4.WithLevel(-1)},
+		}
+	case isText(sample):
+		return autoDecision{
+			reason:  fmt.Sprintf("text, %.2f bits of entropy per byte", h),
+			summary: "dual hash",
+			options: []lz4.Option{lz4.WithDualHash()},
+		}
+	}
+	return autoDecision{
+		reason:  fmt.Sprintf("%.2f bits of entropy per byte", h),
+		summary: "default settings",
+	}
+}
+
+// entropy returns the Shannon entropy of p in bits per byte.
+func entropy(p []byte) float64 {
+	if len(p) == 0 {
+		return 0
+	}
+	var counts [256]int
+	for _, b := range p {
+		counts[b]++
+	}
+	h := 0.0
+	for _, c := range counts {
+		if c > 0 {
+			f := float64(c) / float64(len(p))
+			h -= f * math.Log2(f)
+		}
+	}
+	return h
+}
+
+// isText reports whether p looks like text: no NUL bytes and few control
+// characters other than whitespace.
+func isText(p []byte) bool {
+	if bytes.IndexByte(p, 0) >= 0 {
+		return false
+	}
+	control := 0
+	for _, b := range p {
+		if b < 0x20 && b != '\n' && b != '\r' && b != '\t' {
+			control++
+		}
+	}
+	return control*100 <= len(p)
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	lz4 "rzstd/src"
+
+	lz4lib "github.com/pierrec/lz4/v4"
+)
+
+// benchEngine is one compressor configuration measured by "bench".
+type benchEngine struct {
+	name      string
+	blockSize int
+	// levels reports whether the engine has a given compression level; an
+	// engine without levels has it nil and runs once
+	levels func(level int) bool
+	// bench measures a round trip of data at level, and decompress the
+	// decoding of an .lz4 stream
+	bench      func(data []byte, level int) (lz4.Result, error)
+	decompress func(compressed []byte) (lz4.Result, error)
+}
+
+// rz4Levels reports whether level is one of lz4.WithLevel.
+func rz4Levels(level int) bool {
+	return level >= minBenchLevel && level <= maxBenchLevel
+}
+
+// libraryLevels reports whether pierrec/lz4 has level: its fast mode is
+// level 1 and its HC levels go up to 9.
+func libraryLevels(level int) bool {
+	return level >= 1 && level <= 9
+}
+
+// libraryLevel returns the pierrec/lz4 equivalent of level.
+func libraryLevel(level int) lz4lib.CompressionLevel {
+	if level <= 1 {
+		return lz4lib.Fast
+	}
+	return lz4lib.CompressionLevel(1 << (8 + level))
+}
+
+// decompressRZ4 measures the Reader of this package.
+func decompressRZ4(compressed []byte) (lz4.Result, error) {
+	return lz4.BenchmarkDecompress(compressed, nil)
+}
+
+var benchEngines = []benchEngine{
+	{
+		name:      "rz4",
+		blockSize: 4 << 20,
+		levels:    rz4Levels,
+		bench: func(data []byte, level int) (lz4.Result, error) {
+			return lz4.Benchmark(data, lz4.WithLevel(level))
+		},
+		decompress: decompressRZ4,
+	},
+	{
+		name:      "rz4 -favor-decspeed",
+		blockSize: 4 << 20,
+		levels:    rz4Levels,
+		bench: func(data []byte, level int) (lz4.Result, error) {
+			return lz4.Benchmark(data, lz4.WithLevel(level), lz4.WithFavorDecSpeed())
+		},
+		decompress: decompressRZ4,
+	},
+	{
+		name:      "pierrec/lz4",
+		blockSize: 4 << 20,
+		levels:    libraryLevels,
+		bench: func(data []byte, level int) (lz4.Result, error) {
+			return lz4.BenchmarkCodec(data, libraryCodec{blockSize: lz4lib.Block4Mb, level: libraryLevel(level)})
+		},
+		decompress: func(compressed []byte) (lz4.Result, error) {
+			return lz4.BenchmarkDecompress(compressed, libraryCodec{})
+		},
+	},
+}
+
+// libraryCodec runs pierrec/lz4 as an lz4.Codec, so that lz4.BenchmarkCodec
+// measures it the same way as rz4.
+type libraryCodec struct {
+	blockSize lz4lib.BlockSize
+	level     lz4lib.CompressionLevel
+}
+
+func (c libraryCodec) NewWriter(dst io.Writer) (io.WriteCloser, error) {
+	w := lz4lib.NewWriter(dst)
+	return w, w.Apply(lz4lib.BlockSizeOption(c.blockSize), lz4lib.CompressionLevelOption(c.level))
+}
+
+func (libraryCodec) NewReader(src io.Reader) (io.Reader, error) {
+	return lz4lib.NewReader(src), nil
+}
+
+// codecEngines returns an engine for each codec registered with
+// lz4.RegisterCodec. Their block size is unknown and reported as zero.
+func codecEngines() []benchEngine {
+	var engines []benchEngine
+	for _, name := range lz4.Codecs()[1:] {
+		option := lz4.WithCodec(name)
+		engines = append(engines, benchEngine{
+			name: name,
+			bench: func(data []byte, _ int) (lz4.Result, error) {
+				return lz4.Benchmark(data, option)
+			},
+		})
+	}
+	return engines
+}
+
+// reportEngines extends benchEngines with the smaller block sizes of rz4
+// and pierrec/lz4 and the registered codecs for "bench report".
+func reportEngines() []benchEngine {
+	engines := append([]benchEngine(nil), benchEngines...)
+	for _, size := range []int{64 << 10, 256 << 10, 1 << 20} {
+		option := lz4.WithBlockSize(size)
+		engines = append(engines, benchEngine{
+			name:      "rz4",
+			blockSize: size,
+			levels:    rz4Levels,
+			bench: func(data []byte, level int) (lz4.Result, error) {
+				return lz4.Benchmark(data, lz4.WithLevel(level), option)
+			},
+		})
+	}
+	for _, size := range []lz4lib.BlockSize{lz4lib.Block64Kb, lz4lib.Block256Kb, lz4lib.Block1Mb} {
+		engines = append(engines, benchEngine{
+			name:      "pierrec/lz4",
+			blockSize: int(size),
+			levels:    libraryLevels,
+			bench: func(data []byte, level int) (lz4.Result, error) {
+				return lz4.BenchmarkCodec(data, libraryCodec{blockSize: size, level: libraryLevel(level)})
+			},
+		})
+	}
+	return append(engines, codecEngines()...)
+}
+
+// The range of levels of "bench", those of lz4.WithLevel
+const (
+	minBenchLevel = -5
+	maxBenchLevel = 12
+)
+
+// flagSet reports whether the flag name was given on the command line.
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// bestOf calls bench until minDuration has passed, at least once, and
+// returns the fastest compression and decompression times of its results
+// with their average allocations, and the number of runs.
+func bestOf(minDuration time.Duration, bench func() (lz4.Result, error)) (lz4.Result, int, error) {
+	var best lz4.Result
+	var total time.Duration
+	runs := 0
+	for runs == 0 || total < minDuration {
+		r, err := bench()
+		if err != nil {
+			return best, runs, err
+		}
+		total += r.CompressTime + r.DecompressTime
+		if runs == 0 {
+			best = r
+		} else {
+			best.CompressTime = min(best.CompressTime, r.CompressTime)
+			best.DecompressTime = min(best.DecompressTime, r.DecompressTime)
+			best.CompressAllocs += r.CompressAllocs
+			best.DecompressAllocs += r.DecompressAllocs
+			best.CompressAllocBytes += r.CompressAllocBytes
+			best.DecompressAllocBytes += r.DecompressAllocBytes
+		}
+		runs++
+	}
+	n := uint64(runs)
+	best.CompressAllocs /= n
+	best.DecompressAllocs /= n
+	best.CompressAllocBytes /= n
+	best.DecompressAllocBytes /= n
+	return best, runs, nil
+}
+
+// runBench implements "bench [-b level] [-e level] [-i seconds] [-d]
+// FILE...". Every engine runs each step at each level from -b to -e that it
+// has repeatedly for at least the given duration, and the fastest run is
+// reported.
+func runBench(args []string) error {
+	if len(args) > 0 && args[0] == "report" {
+		return runBenchReport(args[1:])
+	}
+
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	seconds := fs.Float64("i", 3, "Minimum `seconds` to run each benchmark")
+	first := fs.Int("b", 1, "First compression `level` to benchmark")
+	last := fs.Int("e", 0, "Last compression `level` to benchmark; defaults to -b")
+	decompressOnly := fs.Bool("d", false, "Benchmark decompression only; inputs are .lz4 files")
+	noColor := fs.Bool("no-color", false, "Disable colored output")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s bench [-b level] [-e level] [-i seconds] [-d] FILE...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(fs.Output(), "       %s bench report [-i seconds] [-levels LIST] [-format markdown|csv] FILE...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "\nMeasures compression ratio and speed of each engine on the given files.")
+		fmt.Fprintln(fs.Output(), "\nOptions:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	useColor = !*noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+	minDuration := time.Duration(*seconds * float64(time.Second))
+	if !flagSet(fs, "e") {
+		*last = *first
+	}
+	if !rz4Levels(*first) || !rz4Levels(*last) || *first > *last {
+		return fmt.Errorf("levels -b %d to -e %d are not a range of %d to %d", *first, *last, minBenchLevel, maxBenchLevel)
+	}
+	// Decompression does not depend on the level
+	if *decompressOnly {
+		*last = *first
+	}
+
+	// Registered codecs cannot decode .lz4 inputs
+	engines := benchEngines
+	if !*decompressOnly {
+		engines = append(engines[:len(engines):len(engines)], codecEngines()...)
+	}
+	for _, name := range fs.Args() {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		for level := *first; level <= *last; level++ {
+			for _, e := range engines {
+				label := e.name
+				switch {
+				case *decompressOnly:
+				case e.levels == nil:
+					// Engines without levels run at the first one only
+					if level != *first {
+						continue
+					}
+				case !e.levels(level):
+					continue
+				default:
+					label = fmt.Sprintf("%s -level %d", e.name, level)
+				}
+				bench := func() (lz4.Result, error) { return e.bench(data, level) }
+				if *decompressOnly {
+					bench = func() (lz4.Result, error) { return e.decompress(data) }
+				}
+				r, runs, err := bestOf(minDuration, bench)
+				if err != nil {
+					return fmt.Errorf("%s: %s: %w", name, label, err)
+				}
+				if !*decompressOnly {
+					fmt.Printf("%s: %s: %s -> %s (%s), compress %s (best of %d)\n",
+						name, label, formatSize(r.Size), formatSize(r.CompressedSize),
+						formatRatio(r.CompressedSize, r.Size),
+						colorize(colorBold, formatSpeed(r.Size, r.CompressTime)), runs)
+				}
+				fmt.Printf("%s: %s: decompress %s (best of %d)\n",
+					name, label, colorize(colorBold, formatSpeed(r.Size, r.DecompressTime)), runs)
+			}
+		}
+	}
+	return nil
+}
+
+// reportLevels are the levels of "bench report" unless -levels sets others:
+// turbo, default and HC ones.
+var reportLevels = []int{-5, 0, 1, 3, 9, 12}
+
+// runBenchReport implements "bench report", which measures every engine,
+// level and block size on every input and prints the results as one table.
+func runBenchReport(args []string) error {
+	fs := flag.NewFlagSet("bench report", flag.ExitOnError)
+	seconds := fs.Float64("i", 1, "Minimum `seconds` to run each benchmark")
+	format := fs.String("format", "markdown", "Table format: markdown or csv")
+	levelList := fs.String("levels", formatLevels(reportLevels), "Comma-separated compression `levels` to measure")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s bench report [-i seconds] [-levels LIST] [-format markdown|csv] FILE...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "\nOptions:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *format != "markdown" && *format != "csv" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	levels, err := parseLevels(*levelList)
+	if err != nil {
+		return err
+	}
+	minDuration := time.Duration(*seconds * float64(time.Second))
+
+	header := []string{"file", "engine", "level", "block size", "ratio", "compress MB/s", "decompress MB/s", "compress allocs/op", "decompress allocs/op"}
+	var rows [][]string
+	for _, name := range fs.Args() {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		for _, e := range reportEngines() {
+			for i, level := range levels {
+				label := strconv.Itoa(level)
+				switch {
+				case e.levels == nil:
+					// Engines without levels run once
+					if i > 0 {
+						continue
+					}
+					label = "-"
+				case !e.levels(level):
+					continue
+				}
+				r, _, err := bestOf(minDuration, func() (lz4.Result, error) { return e.bench(data, level) })
+				if err != nil {
+					return fmt.Errorf("%s: %s at level %s: %w", name, e.name, label, err)
+				}
+				blockSize := "-"
+				if e.blockSize > 0 {
+					blockSize = formatSize(int64(e.blockSize))
+				}
+				rows = append(rows, []string{
+					filepath.Base(name),
+					e.name,
+					label,
+					blockSize,
+					formatRatio(r.CompressedSize, r.Size),
+					fmt.Sprintf("%.1f", r.CompressSpeed()),
+					fmt.Sprintf("%.1f", r.DecompressSpeed()),
+					strconv.FormatUint(r.CompressAllocs, 10),
+					strconv.FormatUint(r.DecompressAllocs, 10),
+				})
+			}
+		}
+	}
+
+	if *format == "csv" {
+		w := csv.NewWriter(os.Stdout)
+		w.Write(header)
+		w.WriteAll(rows)
+		return w.Error()
+	}
+	fmt.Printf("| %s |\n", strings.Join(header, " | "))
+	fmt.Printf("|%s\n", strings.Repeat(" --- |", len(header)))
+	for _, row := range rows {
+		fmt.Printf("| %s |\n", strings.Join(row, " | "))
+	}
+	return nil
+}
+
+// parseLevels parses the -levels list of "bench report".
+func parseLevels(list string) ([]int, error) {
+	var levels []int
+	for _, field := range strings.Split(list, ",") {
+		level, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || !rz4Levels(level) {
+			return nil, fmt.Errorf("-levels: %q is not a level from %d to %d", field, minBenchLevel, maxBenchLevel)
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+func formatLevels(levels []int) string {
+	fields := make([]string, len(levels))
+	for i, level := range levels {
+		fields[i] = strconv.Itoa(level)
+	}
+	return strings.Join(fields, ",")
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// scanConfigKeys are the keys of the defaults file for flags of the scan
+// command, which the main command leaves alone.
+var scanConfigKeys = []string{"exclude"}
+
+// configPath returns the location of the defaults file,
+// $XDG_CONFIG_HOME/rz4/config.toml or else ~/.config/rz4/config.toml, on
+// every platform.
+func configPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	// Relative paths are to be ignored
+	if !filepath.IsAbs(dir) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "rz4", "config.toml"), nil
+}
+
+// loadConfig applies the defaults file to the flags of the main command.
+// Keys are flag names; values are TOML strings, numbers, booleans or arrays
+// of strings for repeatable flags. A missing file is not an error.
+func loadConfig(fs *flag.FlagSet, path string) error {
+	return readConfig(path, func(key string, values []string) error {
+		if slices.Contains(scanConfigKeys, key) {
+			return nil
+		}
+		if fs.Lookup(key) == nil {
+			return fmt.Errorf("unknown key %q", key)
+		}
+		return setFlag(fs, key, values)
+	})
+}
+
+// loadScanConfig applies the keys of the defaults file in scanConfigKeys to
+// the flags of the scan command.
+func loadScanConfig(fs *flag.FlagSet, path string) error {
+	return readConfig(path, func(key string, values []string) error {
+		if !slices.Contains(scanConfigKeys, key) {
+			return nil
+		}
+		return setFlag(fs, key, values)
+	})
+}
+
+func setFlag(fs *flag.FlagSet, key string, values []string) error {
+	for _, v := range values {
+		if err := fs.Set(key, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readConfig passes every key of the defaults file to apply along with its
+// values.
+func readConfig(path string, apply func(key string, values []string) error) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected key = value", path, lineNo)
+		}
+		values, err := parseConfigValue(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, lineNo, err)
+		}
+		if err := apply(strings.TrimSpace(key), values); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// stripComment removes a trailing # comment that is not inside a string.
+func stripComment(line string) string {
+	inString := false
+	for i, c := range line {
+		switch {
+		case c == '"':
+			inString = !inString
+		case c == '#' && !inString:
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func parseConfigValue(value string) ([]string, error) {
+	if strings.HasPrefix(value, "[") {
+		if !strings.HasSuffix(value, "]") {
+			return nil, errors.New("unterminated array")
+		}
+		var values []string
+		for _, item := range strings.Split(value[1:len(value)-1], ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			v, err := parseConfigValue(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v...)
+		}
+		return values, nil
+	}
+	if strings.HasPrefix(value, "\"") {
+		s, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", value)
+		}
+		return []string{s}, nil
+	}
+	return []string{value}, nil
+}
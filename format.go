@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorDim    = "\x1b[2m"
+)
+
+// useColor is set from -no-color and whether stdout is a terminal.
+var useColor bool
+
+// isTerminal reports whether f is a character device such as a TTY.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func colorize(color, s string) string {
+	if !useColor {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// formatSize formats n bytes with a binary unit, e.g. "1.5 MiB".
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTP"[exp])
+}
+
+// formatRatio formats out as a percentage of in.
+func formatRatio(out, in int64) string {
+	if in == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f%%", float64(out)*100/float64(in))
+}
+
+// formatSpeed formats n bytes processed in d as decimal megabytes per second.
+func formatSpeed(n int64, d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f MB/s", float64(n)/1e6/d.Seconds())
+}
+
+// printSummary reports the sizes, ratio and speed of one run. The speed is
+// measured on the uncompressed side.
+func printSummary(verb, input, output string, in, out int64, elapsed time.Duration) {
+	uncompressed, compressed := in, out
+	if verb == "Decompressed" {
+		uncompressed, compressed = out, in
+	}
+
+	ratio := formatRatio(compressed, uncompressed)
+	if compressed < uncompressed {
+		ratio = colorize(colorGreen, ratio)
+	} else {
+		ratio = colorize(colorYellow, ratio)
+	}
+
+	fmt.Printf("%s '%s' -> '%s': %s -> %s (%s) %s\n",
+		verb, input, output,
+		colorize(colorBold, formatSize(in)), colorize(colorBold, formatSize(out)),
+		ratio,
+		colorize(colorDim, fmt.Sprintf("in %.2fs, %s", elapsed.Seconds(), formatSpeed(uncompressed, elapsed))))
+}
@@ -3,6 +3,6 @@ module rzstd
 go 1.25.4
 
 require (
-	github.com/pierrec/lz4/v4 v4.1.22 // indirect
-	github.com/pierrec/xxHash v0.1.5 // indirect
+	github.com/pierrec/lz4/v4 v4.1.22
+	github.com/pierrec/xxHash v0.1.5
 )
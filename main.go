@@ -7,6 +7,8 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	lz4 "rzstd/src"
 
@@ -14,20 +16,106 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "cmp":
+			differ, err := runCmp(os.Args[2:])
+			if err != nil {
+				log.Fatalf("Compare failed: %v", err)
+			}
+			if differ {
+				os.Exit(1)
+			}
+			return
+		case "scan":
+			damaged, err := runScan(os.Args[2:])
+			if err != nil {
+				log.Fatalf("Scan failed: %v", err)
+			}
+			if damaged {
+				os.Exit(1)
+			}
+			return
+		case "repair":
+			damaged, err := runRepair(os.Args[2:])
+			if err != nil {
+				log.Fatalf("Repair failed: %v", err)
+			}
+			if damaged {
+				os.Exit(1)
+			}
+			return
+		case "shard":
+			if err := runShard(os.Args[2:]); err != nil {
+				log.Fatalf("Shard failed: %v", err)
+			}
+			return
+		case "merge":
+			if err := runMerge(os.Args[2:]); err != nil {
+				log.Fatalf("Merge failed: %v", err)
+			}
+			return
+		case "bench":
+			if err := runBench(os.Args[2:]); err != nil {
+				log.Fatalf("Benchmark failed: %v", err)
+			}
+			return
+		}
+	}
+
 	var (
 		decompress = flag.Bool("d", false, "Decompress the input file")
-		input      = flag.String("i", "C:\\Users\\199-4\\labs\\hasd\\lab4\\data\\lorem.txt", "Input file path")
-		output     = flag.String("o", "", "Output file path (optional)")
+		input      = flag.String("i", "C:\\Users\\199-4\\labs\\hasd\\lab4\\data\\lorem.txt", "Input file path or http(s) URL")
+		output     = flag.String("o", "", "Output file path or http(s) URL (optional)")
 		useLibrary = flag.Bool("lib", false, "Use standard library LZ4 instead of custom implementation")
+		favorDec   = flag.Bool("favor-decspeed", false, "Favor decompression speed over compression ratio")
+		sparse     = flag.Bool("sparse", false, "Skip holes of a sparse input file and record them for decompression")
+		retries    = flag.Int("retries", 3, "Times to resume a failed http(s) or s3:// transfer")
+		noColor    = flag.Bool("no-color", false, "Disable colored output")
+		manifest   = flag.String("manifest", "", "Append the compressed file's sizes, mtime and checksums to this JSON lines manifest")
+		profile    = flag.String("profile", "", "Compression preset: archive (level 12, checksums, the input size and a stored SHA-256)")
+		parity     = flag.String("parity", "", "Append DATA:PARITY Reed-Solomon shards per group of blocks, for the repair command")
+		level      = flag.Int("level", 1, "Compression level; 0 to -5 trade ratio for speed, 2 to 12 speed for ratio")
+		codec      = flag.String("codec", "lz4", "Compression engine: "+strings.Join(lz4.Codecs(), ", "))
+		partSize   = flag.Int64("part-size", 0, "Split the output into independently decodable parts of this many bytes, e.g. for S3 multipart uploads")
+		blockSize  = flag.Int("block-size", 4<<20, "Block size in bytes: 65536, 262144, 1048576 or 4194304")
+		jobs       = flag.Int("j", 1, "Compress or decompress this many blocks at a time; 0 uses every CPU")
+		auto       = flag.Bool("auto", false, "Pick compression settings from the input's name and content")
+		force      = flag.Bool("force-recompress", false, "Compress inputs that are already LZ4 instead of copying them unchanged")
+		every      = flag.Int("checksum-every", 0, "Store a running checksum every this many blocks, verified while decompressing")
+		tees       stringList
 	)
+	flag.Var(&tees, "tee", "Also write the compressed output to this file or http(s) URL (repeatable)")
 
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-d] [-lib] -i INPUT [-o OUTPUT]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s cmp [-dict FILE] A.lz4 B.lz4\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s scan [-j workers] [-json] [-dict FILE] [-exclude PATTERN] DIR...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s repair FILE...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s shard -n COUNT -k INDEX -i INPUT [-o OUTPUT]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s merge -o OUTPUT SHARD...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s bench [-b level] [-e level] [-i seconds] [-d] FILE...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s bench report [-i seconds] [-levels LIST] [-format markdown|csv] FILE...\n", filepath.Base(os.Args[0]))
 		fmt.Println("\nOptions:")
 		flag.PrintDefaults()
+		fmt.Println("\nDefaults are read from $XDG_CONFIG_HOME/rz4/config.toml, or else")
+		fmt.Println("~/.config/rz4/config.toml (flag = value), then from the RZ4_OPTS environment")
+		fmt.Println("variable, then from the command line. The exclude key sets -exclude of scan.")
 	}
 
-	flag.Parse()
+	// Defaults from the config file and the environment come first so the
+	// command line overrides them
+	if path, err := configPath(); err == nil {
+		if err := loadConfig(flag.CommandLine, path); err != nil {
+			log.Fatalf("Error reading config: %v", err)
+		}
+	}
+	args := os.Args[1:]
+	if env := os.Getenv("RZ4_OPTS"); env != "" {
+		args = append(strings.Fields(env), args...)
+	}
+	flag.CommandLine.Parse(args)
+	useColor = !*noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
 
 	if *input == "" {
 		log.Fatal("Error: input file (-i) is required")
@@ -36,51 +124,200 @@ func main() {
 	// Determine output filename if not provided
 	if *output == "" {
 		if *decompress {
-			*output = *input + ".dec"
+			*output = localName(*input) + ".dec"
 		} else {
-			*output = *input + ".lz4"
+			*output = localName(*input) + ".lz4"
 		}
 	}
 
-	inFile, err := os.Open(*input)
+	inFile, err := openInput(*input, *retries)
 	if err != nil {
 		log.Fatalf("Error opening input file: %v", err)
 	}
 	defer inFile.Close()
 
-	outFile, err := os.Create(*output)
+	outFile, err := createOutput(*output, *partSize, *retries)
 	if err != nil {
 		log.Fatalf("Error creating output file: %v", err)
 	}
-	defer outFile.Close()
+
+	if *decompress && len(tees) > 0 {
+		log.Fatal("Error: -tee is only supported when compressing")
+	}
+	var teeFiles []io.WriteCloser
+	var teeWriters []io.Writer
+	for _, name := range tees {
+		f, err := createOutput(name, *partSize, *retries)
+		if err != nil {
+			log.Fatalf("Error creating tee output: %v", err)
+		}
+		teeFiles = append(teeFiles, f)
+		teeWriters = append(teeWriters, f)
+	}
+
+	var src io.Reader = inFile
+	var head []byte
+	if !*decompress && (!*force || *auto) {
+		if head, src, err = peek(inFile, autoSample); err != nil {
+			log.Fatalf("Error reading input file: %v", err)
+		}
+	}
+	passthrough := !*force && isLZ4(head)
+
+	var digest *manifestDigest
+	if *manifest != "" && !*decompress {
+		if *sparse {
+			log.Fatal("Error: -manifest is not supported with -sparse")
+		}
+		digest = newManifestDigest()
+		src = io.TeeReader(src, digest)
+	}
+	in := lz4.NewCountingReader(src)
+	out := lz4.NewCountingWriter(outFile)
+	start := time.Now()
 
 	if *decompress {
 		if *useLibrary {
 			log.Println("Decomressing with lz4 lib")
-			err = decompressWithLibrary(inFile, outFile)
+			err = decompressWithLibrary(in, out)
 		} else {
 			log.Println("Decomressing with custom impl")
-			err = lz4.DecompressStream(inFile, outFile)
+			options := []lz4.Option{lz4.WithCodec(*codec)}
+			if *jobs != 1 {
+				options = append(options, lz4.WithConcurrency(*jobs))
+			}
+			if f, ok := outFile.(*os.File); ok {
+				err = lz4.DecompressSparse(in, f, options...)
+			} else {
+				err = lz4.DecompressStream(in, out, options...)
+			}
+		}
+		elapsed := time.Since(start)
+		outSize := out.Count()
+		if f, ok := outFile.(*os.File); ok && err == nil {
+			// Sparse output is written with WriteAt, bypassing the counter
+			if fi, serr := f.Stat(); serr == nil {
+				outSize = fi.Size()
+			}
+		}
+		if err == nil {
+			err = outFile.Close()
 		}
 		if err != nil {
 			log.Fatalf("Decompression failed: %v", err)
 		}
-		fmt.Printf("Decompressed '%s' -> '%s'\n", *input, *output)
+		printSummary("Decompressed", *input, *output, in.Count(), outSize, elapsed)
 	} else {
-		if *useLibrary {
+		if passthrough {
+			log.Println("Input is already LZ4 compressed, copying it unchanged (use -force-recompress to compress it again)")
+			_, err = io.Copy(io.MultiWriter(append([]io.Writer{out}, teeWriters...)...), in)
+		} else if *useLibrary {
 			log.Println("Comressing with lz4 lib")
-			err = compressWithLibrary(inFile, outFile)
+			err = compressWithLibrary(in, io.MultiWriter(append([]io.Writer{out}, teeWriters...)...))
 		} else {
 			log.Println("Compressing with custom impl")
-			err = lz4.CompressStream(inFile, outFile)
+			options := []lz4.Option{lz4.WithCodec(*codec)}
+			if *auto {
+				// Explicit flags come later and override the choice
+				d := detectProfile(*input, head)
+				log.Printf("Auto: %s: %s", *input, d)
+				options = append(options, d.options...)
+			}
+			if *profile != "" {
+				preset, perr := lz4.Profile(*profile)
+				if perr != nil {
+					log.Fatalf("Error: -profile %s: %v", *profile, perr)
+				}
+				options = append(options, preset)
+				// A preset records the size of a regular file in the header,
+				// unless the output will not be a single frame
+				if f, ok := inFile.(*os.File); ok && *partSize == 0 && *every == 0 && !*sparse {
+					if fi, serr := f.Stat(); serr == nil && fi.Mode().IsRegular() {
+						options = append(options, lz4.WithContentSize(fi.Size()))
+					}
+				}
+			}
+			if *parity != "" {
+				data, par, perr := parseParity(*parity)
+				if perr != nil {
+					log.Fatalf("Error: %v", perr)
+				}
+				options = append(options, lz4.WithParity(data, par))
+			}
+			if *partSize > 0 {
+				options = append(options, lz4.WithPartSize(*partSize))
+			}
+			if *blockSize != 4<<20 {
+				options = append(options, lz4.WithBlockSize(*blockSize))
+			}
+			if *jobs != 1 {
+				options = append(options, lz4.WithConcurrency(*jobs))
+			}
+			if *level != 1 {
+				options = append(options, lz4.WithLevel(*level))
+			}
+			if *every > 0 {
+				options = append(options, lz4.WithChecksumInterval(*every))
+			}
+			if *favorDec {
+				options = append(options, lz4.WithFavorDecSpeed())
+			}
+			if len(teeWriters) > 0 {
+				options = append(options, lz4.WithTee(teeWriters...))
+			}
+			if f, ok := inFile.(*os.File); ok && *sparse {
+				err = lz4.CompressSparse(f, out, options...)
+			} else {
+				err = lz4.CompressStream(in, out, options...)
+			}
+		}
+		elapsed := time.Since(start)
+		inSize := in.Count()
+		if f, ok := inFile.(*os.File); ok && *sparse && !*useLibrary && !passthrough {
+			// Sparse input is read directly from the file, bypassing the counter
+			if fi, serr := f.Stat(); serr == nil {
+				inSize = fi.Size()
+			}
+		}
+		if err == nil {
+			err = outFile.Close()
+		}
+		for _, f := range teeFiles {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
 		}
 		if err != nil {
 			log.Fatalf("Compression failed: %v", err)
 		}
-		fmt.Printf("Compressed '%s' -> '%s'\n", *input, *output)
+		if digest != nil {
+			var modTime time.Time
+			if f, ok := inFile.(*os.File); ok {
+				if fi, err := f.Stat(); err == nil {
+					modTime = fi.ModTime()
+				}
+			}
+			entry := digest.entry(*input, *output, inSize, out.Count(), modTime)
+			if err := appendManifest(*manifest, entry); err != nil {
+				log.Fatalf("Error writing manifest: %v", err)
+			}
+		}
+		printSummary("Compressed", *input, *output, inSize, out.Count(), elapsed)
 	}
 }
 
+// stringList collects the values of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 func compressWithLibrary(src io.Reader, dst io.Writer) error {
 	w := lz4lib.NewWriter(dst)
 	w.Apply(lz4lib.BlockSizeOption(lz4lib.Block4Mb))
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/sha256"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	lz4 "rzstd/src"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+// manifestDigest hashes the input as it is compressed, for -manifest.
+type manifestDigest struct {
+	xxh hash.Hash32
+	sha hash.Hash
+	io.Writer
+}
+
+func newManifestDigest() *manifestDigest {
+	d := &manifestDigest{xxh: xxHash32.New(0), sha: sha256.New()}
+	d.Writer = io.MultiWriter(d.xxh, d.sha)
+	return d
+}
+
+func (d *manifestDigest) entry(src, dst string, size, compressedSize int64, modTime time.Time) lz4.ManifestEntry {
+	e := lz4.ManifestEntry{
+		Src:            src,
+		Dst:            dst,
+		Size:           size,
+		CompressedSize: compressedSize,
+		ModTime:        modTime,
+		Checksum:       d.xxh.Sum32(),
+	}
+	d.sha.Sum(e.SHA256[:0])
+	return e
+}
+
+// appendManifest adds e to the JSON lines manifest at path, creating it if
+// needed.
+func appendManifest(path string, e lz4.ManifestEntry) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := lz4.WriteManifest(f, lz4.Manifest{Files: []lz4.ManifestEntry{e}}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// retryDelay is the wait before the first retry of a transfer, which grows
+// by as much for every further attempt.
+var retryDelay = time.Second
+
+func isURL(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") || strings.HasPrefix(name, "s3://")
+}
+
+// localName returns the name of the local file a default output path is
+// derived from, which for URLs is the last element of the URL path.
+func localName(name string) string {
+	if !isURL(name) {
+		return name
+	}
+	u, err := url.Parse(name)
+	if err != nil || path.Base(u.Path) == "/" || path.Base(u.Path) == "." {
+		return "download"
+	}
+	return path.Base(u.Path)
+}
+
+// openInput opens a local file or streams the body of an http(s) or s3://
+// URL, resuming the download up to retries times if the connection fails.
+func openInput(name string, retries int) (io.ReadCloser, error) {
+	switch {
+	case strings.HasPrefix(name, "s3://"):
+		return openS3(name, retries)
+	case isURL(name):
+		r := &retryReader{url: name, retries: retries}
+		if err := r.connect(); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	return os.Open(name)
+}
+
+// retryReader reads an http(s) resource and, when the body fails mid-way,
+// reissues the request with a Range header starting at the first byte not
+// yet delivered, so long jobs survive flaky networks.
+type retryReader struct {
+	url     string
+	body    io.ReadCloser
+	offset  int64
+	retries int
+	// attempts counts the retries since the last read that made progress
+	attempts int
+	// sign, if set, authenticates every request
+	sign func(*http.Request)
+}
+
+func (r *retryReader) connect() error {
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return err
+	}
+	if r.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+	}
+	if r.sign != nil {
+		r.sign(req)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	want := http.StatusOK
+	if r.offset > 0 {
+		want = http.StatusPartialContent
+	}
+	if resp.StatusCode != want {
+		resp.Body.Close()
+		return fmt.Errorf("GET %s: %s", r.url, resp.Status)
+	}
+	r.body = resp.Body
+	return nil
+}
+
+func (r *retryReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if n > 0 {
+			r.attempts = 0
+		}
+		if err == nil || err == io.EOF || r.attempts >= r.retries {
+			return n, err
+		}
+		if n > 0 {
+			// The broken body fails again on the next call, which retries.
+			return n, nil
+		}
+
+		r.attempts++
+		log.Printf("Read from %s failed at byte %d: %v; retrying", r.url, r.offset, err)
+		r.body.Close()
+		time.Sleep(time.Duration(r.attempts) * retryDelay)
+		if cerr := r.connect(); cerr != nil {
+			return 0, cerr
+		}
+	}
+}
+
+func (r *retryReader) Close() error {
+	return r.body.Close()
+}
+
+// createOutput creates a local file, an upload streaming to an http(s) URL
+// with a chunked PUT request, or a multipart upload to an s3:// URL whose
+// parts line up with those of -part-size if they are large enough for S3.
+// Failed parts are sent again up to retries times.
+func createOutput(name string, partSize int64, retries int) (io.WriteCloser, error) {
+	switch {
+	case strings.HasPrefix(name, "s3://"):
+		return newS3Upload(name, partSize, retries)
+	case isURL(name):
+		pr, pw := io.Pipe()
+		req, err := http.NewRequest(http.MethodPut, name, pr)
+		if err != nil {
+			return nil, err
+		}
+		u := &upload{pw: pw, done: make(chan error, 1)}
+		go func() {
+			resp, err := http.DefaultClient.Do(req)
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode/100 != 2 {
+					err = fmt.Errorf("PUT %s: %s", name, resp.Status)
+				}
+			}
+			pr.CloseWithError(err)
+			u.done <- err
+		}()
+		return u, nil
+	}
+	return os.Create(name)
+}
+
+type upload struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func (u *upload) Write(p []byte) (int, error) {
+	return u.pw.Write(p)
+}
+
+// Close finishes the request body and waits for the server's response.
+func (u *upload) Close() error {
+	u.pw.Close()
+	return <-u.done
+}
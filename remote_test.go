@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyServer serves data with range requests, dropping the connection
+// after the number of body bytes limit returns for each request, counted
+// from 0. It records the offset every request starts at.
+func flakyServer(t *testing.T, data []byte, limit func(request int) int) (*httptest.Server, func() []int) {
+	var mu sync.Mutex
+	var offsets []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		off := 0
+		if rng := req.Header.Get("Range"); rng != "" {
+			if _, err := fmt.Sscanf(rng, "bytes=%d-", &off); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		mu.Lock()
+		request := len(offsets)
+		offsets = append(offsets, off)
+		mu.Unlock()
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)-off))
+		if off > 0 {
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		body := data[off:]
+		n := min(limit(request), len(body))
+		w.Write(body[:n])
+		if n < len(body) {
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return offsets
+	}
+}
+
+// quickRetries makes retries immediate and silent for the rest of t.
+func quickRetries(t *testing.T) {
+	delay, out := retryDelay, log.Writer()
+	retryDelay = time.Millisecond
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() {
+		retryDelay = delay
+		log.SetOutput(out)
+	})
+}
+
+func TestRetryReaderResumes(t *testing.T) {
+	quickRetries(t)
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	// Every connection breaks, but each makes progress, so the retries
+	// allowed for one failure are enough for all of them
+	srv, offsets := flakyServer(t, data, func(int) int { return 100 << 10 })
+
+	r, err := openInput(srv.URL+"/file", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("resumed download does not match the data")
+	}
+	for i, off := range offsets() {
+		if want := i * 100 << 10; off != want {
+			t.Errorf("request %d started at %d, want %d", i, off, want)
+		}
+	}
+}
+
+func TestRetryReaderGivesUp(t *testing.T) {
+	quickRetries(t)
+	data := make([]byte, 1<<20)
+	// After the first, no connection delivers anything
+	srv, offsets := flakyServer(t, data, func(request int) int {
+		if request == 0 {
+			return 100 << 10
+		}
+		return 0
+	})
+
+	const retries = 3
+	r, err := openInput(srv.URL+"/file", retries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err == nil {
+		t.Fatal("ReadAll succeeded on a server that stops sending")
+	}
+	if len(got) != 100<<10 {
+		t.Errorf("read %d bytes, want %d", len(got), 100<<10)
+	}
+	if n := len(offsets()); n != 1+retries {
+		t.Errorf("made %d requests, want %d", n, 1+retries)
+	}
+}
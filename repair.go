@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	lz4 "rzstd/src"
+)
+
+// parseParity parses the "-parity DATA:PARITY" flag value.
+func parseParity(s string) (data, parity int, err error) {
+	d, p, ok := strings.Cut(s, ":")
+	if ok {
+		data, err = strconv.Atoi(d)
+		if err == nil {
+			parity, err = strconv.Atoi(p)
+		}
+	}
+	if !ok || err != nil {
+		return 0, 0, fmt.Errorf("invalid parity %q, want DATA:PARITY", s)
+	}
+	return data, parity, nil
+}
+
+// runRepair implements "repair FILE...". It reports whether any file still
+// has damaged blocks.
+func runRepair(args []string) (bool, error) {
+	fset := flag.NewFlagSet("repair", flag.ExitOnError)
+	fset.Usage = func() {
+		fmt.Fprintf(fset.Output(), "Usage: %s repair FILE...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fset.Output(), "\nRebuilds damaged blocks in place from the parity written with -parity.")
+	}
+	fset.Parse(args)
+	if fset.NArg() == 0 {
+		fset.Usage()
+		os.Exit(2)
+	}
+
+	damaged := false
+	for _, path := range fset.Args() {
+		report, err := repairFile(path)
+		if err != nil {
+			return damaged, fmt.Errorf("%s: %w", path, err)
+		}
+		switch {
+		case report.Groups == 0:
+			fmt.Printf("%s: no parity\n", path)
+		case !report.OK():
+			damaged = true
+			fmt.Printf("%s: repaired %d of %d damaged blocks\n", path, report.Repaired, report.Damaged)
+		case report.Damaged > 0:
+			fmt.Printf("%s: repaired %d damaged blocks\n", path, report.Repaired)
+		default:
+			fmt.Printf("%s: ok\n", path)
+		}
+	}
+	return damaged, nil
+}
+
+func repairFile(path string) (lz4.RepairReport, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return lz4.RepairReport{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return lz4.RepairReport{}, err
+	}
+	report, err := lz4.Repair(f, fi.Size())
+	if err != nil {
+		return report, err
+	}
+	return report, f.Close()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	lz4 "rzstd/src"
+)
+
+func TestParseParity(t *testing.T) {
+	if data, parity, err := parseParity("10:4"); err != nil || data != 10 || parity != 4 {
+		t.Errorf("parseParity(10:4) = %d, %d, %v", data, parity, err)
+	}
+	for _, s := range []string{"", "10", "10:", ":4", "a:4", "10:4:1"} {
+		if _, _, err := parseParity(s); err == nil {
+			t.Errorf("parseParity(%q) succeeded", s)
+		}
+	}
+}
+
+// TestRunRepair damages a stream written with parity once within what it
+// can rebuild and once beyond it.
+func TestRunRepair(t *testing.T) {
+	data := bytes.Repeat([]byte("the repair command rebuilds damaged blocks. "), 20000)
+	var buf bytes.Buffer
+	if err := lz4.CompressStream(bytes.NewReader(data), &buf, lz4.WithBlockSize(64<<10), lz4.WithParity(4, 1)); err != nil {
+		t.Fatal(err)
+	}
+	stream := buf.Bytes()
+	frames, err := lz4.Inspect(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := frames[0].Blocks
+
+	path := filepath.Join(t.TempDir(), "stream.lz4")
+	for _, tt := range []struct {
+		damaged []int
+		fixed   bool
+	}{
+		{[]int{1}, true},
+		{[]int{4, 5}, false},
+	} {
+		damaged := bytes.Clone(stream)
+		for _, i := range tt.damaged {
+			damaged[blocks[i].Offset+10] ^= 0xFF
+		}
+		if err := os.WriteFile(path, damaged, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		left, err := runRepair([]string{path})
+		if err != nil || left == tt.fixed {
+			t.Errorf("blocks %v: runRepair = %v, %v, want %v", tt.damaged, left, err, !tt.fixed)
+		}
+		repaired, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restored := bytes.Equal(repaired, stream); restored != tt.fixed {
+			t.Errorf("blocks %v: the file was restored: %v, want %v", tt.damaged, restored, tt.fixed)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// S3 takes at most 10000 parts, all but the last of at least 5MiB
+	s3MinPartSize     = 5 << 20
+	s3DefaultPartSize = 8 << 20
+	s3MaxParts        = 10000
+	// Without aligned parts, the part size doubles every s3GrowParts parts
+	// so that streams of unknown size fit in s3MaxParts
+	s3GrowParts = 1000
+)
+
+var errS3Credentials = errors.New("s3:// URLs need AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+
+// s3Client sends requests to S3, or to an S3 compatible service at
+// AWS_ENDPOINT_URL, signed with Signature Version 4 using the credentials
+// of the environment.
+type s3Client struct {
+	endpoint     *url.URL
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+func newS3Client() (*s3Client, error) {
+	c := &s3Client{
+		region:       os.Getenv("AWS_REGION"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if c.accessKey == "" || c.secretKey == "" {
+		return nil, errS3Credentials
+	}
+	if c.region == "" {
+		c.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if c.region == "" {
+		c.region = "us-east-1"
+	}
+	for _, name := range []string{"AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"} {
+		if endpoint := os.Getenv(name); endpoint != "" {
+			u, err := url.Parse(endpoint)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			c.endpoint = u
+			break
+		}
+	}
+	return c, nil
+}
+
+// objectURL returns the URL of the object named by an s3://bucket/key URL:
+// virtual-hosted on AWS, and path-style on a custom endpoint.
+func (c *s3Client) objectURL(name string) (string, error) {
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(name, "s3://"), "/")
+	if bucket == "" || !ok || key == "" {
+		return "", fmt.Errorf("%s: want s3://BUCKET/KEY", name)
+	}
+	if c.endpoint == nil {
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, c.region, uriEncode(key, false)), nil
+	}
+	base := strings.TrimSuffix(c.endpoint.String(), "/")
+	return fmt.Sprintf("%s/%s/%s", base, uriEncode(bucket, false), uriEncode(key, false)), nil
+}
+
+// sign adds the Signature Version 4 headers to req. The payload is not
+// hashed, which S3 allows.
+func (c *s3Client) sign(req *http.Request) {
+	c.signAt(req, time.Now().UTC(), "UNSIGNED-PAYLOAD")
+}
+
+func (c *s3Client) signAt(req *http.Request, now time.Time, payloadHash string) {
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	// The host, the range and the x-amz- headers are signed
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, k := range keys {
+		params = append(params, uriEncode(k, true)+"="+uriEncode(query.Get(k), true))
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	date := amzDate[:8]
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), date)
+	for _, part := range []string{c.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode escapes s as Signature Version 4 requires: everything but
+// unreserved characters, and slashes only if encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '-', ch == '.', ch == '_', ch == '~', ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+// do sends a signed request and fails unless S3 answers with a 2xx status
+// and no error document.
+func (c *s3Client) do(method, target string, body []byte) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	c.sign(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	// CompleteMultipartUpload can fail after a 200 status
+	var e struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}
+	if resp.StatusCode/100 != 2 || xml.Unmarshal(data, &e) == nil {
+		if e.Code != "" {
+			return nil, nil, fmt.Errorf("%s %s: %s: %s", method, target, e.Code, e.Message)
+		}
+		return nil, nil, fmt.Errorf("%s %s: %s", method, target, resp.Status)
+	}
+	return resp, data, nil
+}
+
+// s3Upload writes an S3 object with a multipart upload, sending a part
+// whenever partSize bytes are buffered. Parts that fail are sent again up
+// to retries times.
+type s3Upload struct {
+	client   *s3Client
+	target   string
+	uploadID string
+	retries  int
+	aligned  bool
+	partSize int
+	buf      []byte
+	etags    []string
+	err      error
+}
+
+// newS3Upload starts a multipart upload to the object named by an s3:// URL.
+// If alignTo is at least the S3 minimum, every part but the last is
+// alignTo bytes, so that the parts of WithPartSize line up with those of
+// the upload.
+func newS3Upload(name string, alignTo int64, retries int) (*s3Upload, error) {
+	client, err := newS3Client()
+	if err != nil {
+		return nil, err
+	}
+	target, err := client.objectURL(name)
+	if err != nil {
+		return nil, err
+	}
+	u := &s3Upload{client: client, target: target, retries: retries, partSize: s3DefaultPartSize}
+	if alignTo >= s3MinPartSize {
+		u.partSize, u.aligned = int(alignTo), true
+	}
+
+	_, data, err := client.do(http.MethodPost, target+"?uploads", nil)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(data, &result); err != nil || result.UploadID == "" {
+		return nil, fmt.Errorf("POST %s?uploads: no upload ID in the response", target)
+	}
+	u.uploadID = result.UploadID
+	return u, nil
+}
+
+func (u *s3Upload) Write(p []byte) (int, error) {
+	if u.err != nil {
+		return 0, u.err
+	}
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), u.partSize-len(u.buf))
+		u.buf = append(u.buf, p[:n]...)
+		written += n
+		p = p[n:]
+		if len(u.buf) == u.partSize {
+			if err := u.sendPart(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// sendPart uploads the buffered bytes as the next part.
+func (u *s3Upload) sendPart() error {
+	number := len(u.etags) + 1
+	if number > s3MaxParts {
+		u.err = fmt.Errorf("%s: more than %d parts of %d bytes", u.target, s3MaxParts, u.partSize)
+		return u.abort()
+	}
+	target := fmt.Sprintf("%s?partNumber=%d&uploadId=%s", u.target, number, url.QueryEscape(u.uploadID))
+	for attempt := 0; ; attempt++ {
+		resp, _, err := u.client.do(http.MethodPut, target, u.buf)
+		if err == nil {
+			u.etags = append(u.etags, resp.Header.Get("ETag"))
+			break
+		}
+		if attempt >= u.retries {
+			u.err = err
+			return u.abort()
+		}
+		log.Printf("Upload of part %d to %s failed: %v; retrying", number, u.target, err)
+		time.Sleep(time.Duration(attempt+1) * retryDelay)
+	}
+	u.buf = u.buf[:0]
+	if !u.aligned && len(u.etags)%s3GrowParts == 0 {
+		u.partSize *= 2
+	}
+	return nil
+}
+
+// abort cancels the upload after u.err, so that S3 drops the parts sent.
+func (u *s3Upload) abort() error {
+	if _, _, err := u.client.do(http.MethodDelete, u.target+"?uploadId="+url.QueryEscape(u.uploadID), nil); err != nil {
+		log.Printf("Aborting the upload to %s failed: %v", u.target, err)
+	}
+	return u.err
+}
+
+// Close sends the last part and completes the upload.
+func (u *s3Upload) Close() error {
+	if u.err != nil {
+		return u.err
+	}
+	// An upload needs a part, even an empty one
+	if len(u.buf) > 0 || len(u.etags) == 0 {
+		if err := u.sendPart(); err != nil {
+			return err
+		}
+	}
+	var body bytes.Buffer
+	body.WriteString("<CompleteMultipartUpload>")
+	for i, etag := range u.etags {
+		fmt.Fprintf(&body, "<Part><PartNumber>%d</PartNumber><ETag>", i+1)
+		xml.EscapeText(&body, []byte(etag))
+		body.WriteString("</ETag></Part>")
+	}
+	body.WriteString("</CompleteMultipartUpload>")
+	if _, _, err := u.client.do(http.MethodPost, u.target+"?uploadId="+url.QueryEscape(u.uploadID), body.Bytes()); err != nil {
+		u.err = err
+		return u.abort()
+	}
+	return nil
+}
+
+// openS3 streams the object named by an s3:// URL with ranged GET requests,
+// resuming up to retries times.
+func openS3(name string, retries int) (io.ReadCloser, error) {
+	client, err := newS3Client()
+	if err != nil {
+		return nil, err
+	}
+	target, err := client.objectURL(name)
+	if err != nil {
+		return nil, err
+	}
+	r := &retryReader{url: target, retries: retries, sign: client.sign}
+	if err := r.connect(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
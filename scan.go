@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	lz4 "rzstd/src"
+)
+
+// scanResult is the outcome of validating one file; it is also the JSON
+// form printed by "scan -json".
+type scanResult struct {
+	Path     string   `json:"path"`
+	OK       bool     `json:"ok"`
+	Frames   int      `json:"frames"`
+	Blocks   int      `json:"blocks"`
+	Size     int64    `json:"size"`
+	Problems []string `json:"problems,omitempty"`
+	// Unverified lists frames that need a dictionary -dict does not give
+	Unverified []string `json:"unverified,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// runScan implements "scan [-j workers] [-json] [-dict FILE] [-exclude
+// PATTERN] DIR...". It reports whether any file is damaged.
+func runScan(args []string) (bool, error) {
+	fset := flag.NewFlagSet("scan", flag.ExitOnError)
+	workers := fset.Int("j", runtime.GOMAXPROCS(0), "Number of files to validate at once")
+	asJSON := fset.Bool("json", false, "Print one JSON object per file instead of text")
+	noColor := fset.Bool("no-color", false, "Disable colored output")
+	dict := fset.String("dict", "", "Dictionary for frames that name one")
+	var exclude stringList
+	fset.Var(&exclude, "exclude", "Skip files and directories whose name or path matches this glob (repeatable)")
+	fset.Usage = func() {
+		fmt.Fprintf(fset.Output(), "Usage: %s scan [-j workers] [-json] [-dict FILE] [-exclude PATTERN] DIR...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fset.Output(), "\nValidates every .lz4 file under the given directories.")
+		fmt.Fprintln(fset.Output(), "\nOptions:")
+		fset.PrintDefaults()
+	}
+	if path, err := configPath(); err == nil {
+		if err := loadScanConfig(fset, path); err != nil {
+			return false, fmt.Errorf("reading config: %w", err)
+		}
+	}
+	fset.Parse(args)
+	if fset.NArg() == 0 {
+		fset.Usage()
+		os.Exit(2)
+	}
+	for _, pattern := range exclude {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return false, fmt.Errorf("-exclude %q: %w", pattern, err)
+		}
+	}
+	useColor = !*noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+	resolve, err := dictionaryFile(*dict)
+	if err != nil {
+		return false, err
+	}
+
+	var paths []string
+	for _, root := range fset.Args() {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != root && excluded(path, exclude) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.Type().IsRegular() && strings.HasSuffix(path, ".lz4") {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Results are printed in walk order as soon as they are ready
+	results := make([]chan scanResult, len(paths))
+	for i := range results {
+		results[i] = make(chan scanResult, 1)
+	}
+	jobs := make(chan int)
+	for w := 0; w < max(1, *workers); w++ {
+		go func() {
+			for i := range jobs {
+				results[i] <- scanFile(paths[i], resolve)
+			}
+		}()
+	}
+	go func() {
+		for i := range paths {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+
+	enc := json.NewEncoder(os.Stdout)
+	healthy, damaged := 0, 0
+	for i := range paths {
+		r := <-results[i]
+		if r.OK {
+			healthy++
+		} else {
+			damaged++
+		}
+		if *asJSON {
+			if err := enc.Encode(r); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if r.OK {
+			fmt.Printf("%s %s\n", colorize(colorGreen, "OK     "), r.Path)
+			for _, u := range r.Unverified {
+				fmt.Printf("        not verified: %s\n", u)
+			}
+			continue
+		}
+		fmt.Printf("%s %s\n", colorize(colorYellow, "DAMAGED"), r.Path)
+		for _, p := range r.Problems {
+			fmt.Printf("        %s\n", p)
+		}
+		for _, u := range r.Unverified {
+			fmt.Printf("        not verified: %s\n", u)
+		}
+		if r.Error != "" {
+			fmt.Printf("        %s\n", r.Error)
+		}
+	}
+	if !*asJSON {
+		fmt.Printf("%d healthy, %d damaged\n", healthy, damaged)
+	}
+	return damaged > 0, nil
+}
+
+// excluded reports whether the base name or the whole of path matches one of
+// patterns.
+func excluded(path string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func scanFile(path string, resolve func(id uint32) ([]byte, error)) scanResult {
+	r := scanResult{Path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	defer f.Close()
+
+	report, err := lz4.Validate(f, lz4.WithDictionaries(resolve))
+	r.Frames = report.Frames
+	r.Blocks = report.Blocks
+	r.Size = report.Size
+	for _, p := range report.Problems {
+		r.Problems = append(r.Problems, p.String())
+	}
+	for _, p := range report.Unverified {
+		r.Unverified = append(r.Unverified, p.String())
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	r.OK = err == nil && report.OK()
+	return r
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	lz4 "rzstd/src"
+)
+
+// runShard implements "shard -n COUNT -k INDEX -i INPUT -o OUTPUT". It
+// compresses the k-th of n equal byte ranges of a local file, so the shards
+// of one input can be produced on different machines and joined by merge.
+func runShard(args []string) error {
+	fs := flag.NewFlagSet("shard", flag.ExitOnError)
+	count := fs.Int("n", 1, "Number of shards the input is split into")
+	index := fs.Int("k", 0, "Index of the shard to compress, from 0")
+	input := fs.String("i", "", "Input file path")
+	output := fs.String("o", "", "Output file path (default INPUT.K.shard.lz4)")
+	favorDec := fs.Bool("favor-decspeed", false, "Favor decompression speed over compression ratio")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s shard -n COUNT -k INDEX -i INPUT [-o OUTPUT]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "\nCompresses one byte range of INPUT; merge joins the shards.")
+		fmt.Fprintln(fs.Output(), "\nOptions:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *input == "" || *count < 1 || *index < 0 || *index >= *count {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *output == "" {
+		*output = fmt.Sprintf("%s.%d.shard.lz4", *input, *index)
+	}
+
+	in, err := os.Open(*input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+
+	var options []lz4.Option
+	if *favorDec {
+		options = append(options, lz4.WithFavorDecSpeed())
+	}
+	start := time.Now()
+	offset, length := lz4.ShardRange(fi.Size(), *count, *index)
+	dst := lz4.NewCountingWriter(out)
+	_, err = lz4.CompressShard(in, offset, length, dst, options...)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(*output)
+		return err
+	}
+	printSummary("Compressed", *input, *output, length, dst.Count(), time.Since(start))
+	return nil
+}
+
+// runMerge implements "merge -o OUTPUT SHARD...".
+func runMerge(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	output := fs.String("o", "", "Output file path")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s merge -o OUTPUT SHARD...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "\nJoins shards written by the shard command into one .lz4 file,")
+		fmt.Fprintln(fs.Output(), "verifying their checksums and indexing them as sections.")
+	}
+	fs.Parse(args)
+	if *output == "" || fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var shards []*io.SectionReader
+	var inSize int64
+	for _, name := range fs.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		shards = append(shards, io.NewSectionReader(f, 0, fi.Size()))
+		inSize += fi.Size()
+	}
+
+	out, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	dst := lz4.NewCountingWriter(out)
+	merged, err := lz4.MergeShards(dst, shards...)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(*output)
+		return err
+	}
+	fmt.Printf("Merged %d shards into '%s': %s of data, %s -> %s in %.2fs\n", len(shards), *output,
+		formatSize(merged.Length), formatSize(inSize), formatSize(dst.Count()), time.Since(start).Seconds())
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+const (
+	lz4Magic       = 0x184D2204
+	lz4LegacyMagic = 0x184C2102
+)
+
+// peek returns up to n bytes from the start of in, and a reader that still
+// yields every byte of in.
+func peek(in io.Reader, n int) ([]byte, io.Reader, error) {
+	head := make([]byte, n)
+	if f, ok := in.(*os.File); ok {
+		// Peek without moving the offset, so the file can still be used
+		// directly, e.g. by -sparse
+		n, _ := f.ReadAt(head, 0)
+		return head[:n], in, nil
+	}
+	n, err := io.ReadFull(in, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, err
+	}
+	return head[:n], io.MultiReader(bytes.NewReader(head[:n]), in), nil
+}
+
+// isLZ4 reports whether head is the start of LZ4 data: a frame, a legacy
+// frame or a skippable frame such as the ones this tool puts first.
+func isLZ4(head []byte) bool {
+	if len(head) < 4 {
+		return false
+	}
+	m := binary.LittleEndian.Uint32(head)
+	return m == lz4Magic || m == lz4LegacyMagic || m&0xFFFFFFF0 == 0x184D2A50
+}
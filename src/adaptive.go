@@ -0,0 +1,146 @@
+package lz4
+
+import (
+	"math"
+	"time"
+)
+
+// The steps of the ladder WithAdaptive climbs, from storing blocks as they
+// are to the HC match finder.
+const (
+	adaptRaw = iota
+	adaptFast
+	adaptDefault
+	adaptDual
+	adaptHC
+)
+
+// adaptLadder holds the match search of every step: the acceleration and
+// table of level -2, of level 1, of level 1 with WithDualHash, and the hash
+// chains of level 5. Blocks at adaptRaw are not compressed.
+var adaptLadder = [...]compressParams{
+	adaptRaw:     {},
+	adaptFast:    {acceleration: 8, tableLog: hashLog - 2},
+	adaptDefault: {acceleration: 1},
+	adaptDual:    {acceleration: 1, dualHash: true},
+	adaptHC:      {searchDepth: 16},
+}
+
+const (
+	// Blocks that compress better than adaptUpgradeRatio move the next
+	// block a step up, blocks worse than adaptDowngradeRatio a step down,
+	// and blocks worse than adaptRawRatio straight to adaptRaw. Blocks in
+	// between move towards startStep.
+	adaptUpgradeRatio   = 0.5
+	adaptDowngradeRatio = 0.9
+	adaptRawRatio       = 0.98
+	// adaptProbeBlocks is how often a block is compressed at adaptFast
+	// while at adaptRaw, to notice when the data compresses again
+	adaptProbeBlocks = 4
+	// adaptMinThroughput is the speed in MB/s below which a step has no
+	// time to spare, unless WithTargetThroughput sets another
+	adaptMinThroughput = 50
+)
+
+// WithAdaptive makes a Writer pick its match finder per block from how
+// well and how fast the previous block compressed, along a ladder of
+// steps: blocks stored as they are, the fast search of level -2, level 1,
+// the dual hash table of WithDualHash and the HC search of level 5. A block
+// that compresses to less than half its size moves the next block a step
+// up, unless that step was measured slower than the target speed, and a
+// block that barely compresses or was too slow moves it a step down. Blocks
+// in between move back towards the step nearest the configured level, where
+// the first block starts.
+// Incompressible data goes straight to storing blocks, with one block in
+// four compressed to notice when that changes. The target speed is that of
+// WithTargetThroughput, or 50MB/s. Since the choice depends on timing, the
+// output is not reproducible.
+func WithAdaptive() Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			w.adaptive = true
+			w.adaptStep = -1
+			w.hashTable = newMatchTable(hashSize + max(longHashSize, chainSize))
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// blockParams returns the parameters for the next block.
+func (w *Writer) blockParams() compressParams {
+	params := w.params
+	if w.adaptive && w.adaptStep >= 0 {
+		step := adaptLadder[w.adaptStep]
+		if w.adaptProbe {
+			step = adaptLadder[adaptFast]
+		}
+		params.acceleration, params.tableLog = step.acceleration, step.tableLog
+		params.dualHash, params.searchDepth = step.dualHash, step.searchDepth
+	}
+	return params
+}
+
+// startStep returns the step nearest the configured parameters.
+func (w *Writer) startStep() int {
+	switch p := w.params; {
+	case p.searchDepth > 0:
+		return adaptHC
+	case p.dualHash:
+		return adaptDual
+	case p.acceleration > 1:
+		return adaptFast
+	}
+	return adaptDefault
+}
+
+// storeRaw reports whether the next block is to be stored without trying
+// to compress it, taking the first step before the first block.
+func (w *Writer) storeRaw() bool {
+	if !w.adaptive {
+		return false
+	}
+	if w.adaptStep < 0 {
+		w.adaptStep = w.startStep()
+	}
+	if w.adaptStep != adaptRaw {
+		return false
+	}
+	w.adaptRawBlocks++
+	w.adaptProbe = w.adaptRawBlocks%adaptProbeBlocks == 0
+	return !w.adaptProbe
+}
+
+// adapt picks the step of the next block after a block of n bytes took d
+// to compress to compressed bytes.
+func (w *Writer) adapt(n, compressed int, d time.Duration) {
+	if !w.adaptive || n == 0 || w.adaptStep == adaptRaw && !w.adaptProbe {
+		return
+	}
+	step := w.adaptStep
+	if w.adaptProbe {
+		step, w.adaptProbe = adaptFast, false
+	}
+	speed := math.Inf(1)
+	if d > 0 {
+		speed = float64(n) / 1e6 / d.Seconds()
+	}
+	w.adaptSpeed[step] = speed
+	target := w.targetThroughput
+	if target <= 0 {
+		target = adaptMinThroughput
+	}
+
+	ratio := float64(compressed) / float64(n)
+	switch {
+	case ratio > adaptRawRatio:
+		w.adaptStep = adaptRaw
+	case ratio > adaptDowngradeRatio || speed < target:
+		w.adaptStep = max(step-1, adaptFast)
+	case (ratio < adaptUpgradeRatio || step < w.startStep()) && step+1 < len(adaptLadder) && (w.adaptSpeed[step+1] == 0 || w.adaptSpeed[step+1] >= target):
+		w.adaptStep = step + 1
+	default:
+		w.adaptStep = step
+	}
+}
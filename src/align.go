@@ -0,0 +1,48 @@
+package lz4
+
+import "errors"
+
+const skippableHeaderSize = 8
+
+var ErrInvalidAlignment = errors.New("invalid alignment")
+
+// WithBlockAlignment makes the Writer put every block in a frame of its own
+// and precede frames with skippable padding, so that each frame, and hence
+// each block, starts at a multiple of n bytes in the output. This allows
+// O_DIRECT reads and random access on block devices. Decoding such output
+// requires support for concatenated and skippable frames. Zero disables
+// alignment.
+func WithBlockAlignment(n int) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			if n < 0 {
+				return ErrInvalidAlignment
+			}
+			w.alignment = n
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// alignOutput pads the output with a skippable frame up to the next
+// alignment boundary.
+func (w *Writer) alignOutput() error {
+	if w.alignment == 0 {
+		return nil
+	}
+	align := int64(w.alignment)
+	gap := (align - w.dst.n%align) % align
+	if gap == 0 {
+		return nil
+	}
+	for gap < skippableHeaderSize {
+		gap += align
+	}
+	if err := writeSkippableFrame(w.dst, paddingNibble, make([]byte, gap-skippableHeaderSize)); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
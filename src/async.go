@@ -0,0 +1,145 @@
+package lz4
+
+import (
+	"sync"
+	"time"
+)
+
+// AsyncWriter hands data to a background goroutine that compresses it with
+// the wrapped Writer, so producers do not wait for the destination. Small
+// writes are batched into full blocks before being queued. At most queueLen
+// blocks are buffered; Write blocks once the queue is full, which caps memory
+// use at roughly (queueLen+2) block sizes. With WithFlushTimeout a partial
+// block is queued and flushed once writes pause for the timeout.
+type AsyncWriter struct {
+	w     *Writer
+	queue chan []byte
+	done  chan struct{}
+	timer *time.Timer
+
+	// pmu guards pending and closed, which the flush timer also touches.
+	pmu     sync.Mutex
+	pending []byte
+	closed  bool
+
+	mu  sync.Mutex
+	err error
+}
+
+func NewAsyncWriter(w *Writer, queueLen int) *AsyncWriter {
+	if queueLen < 1 {
+		queueLen = 1
+	}
+	a := &AsyncWriter{
+		w:     w,
+		queue: make(chan []byte, queueLen),
+		done:  make(chan struct{}),
+	}
+	if w.flushTimeout > 0 {
+		a.timer = time.AfterFunc(w.flushTimeout, a.flushPending)
+		a.timer.Stop()
+	}
+	go a.run()
+	return a
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+	for p := range a.queue {
+		if a.getErr() == nil {
+			if _, err := a.w.Write(p); err != nil {
+				a.setErr(err)
+			} else if a.timer != nil && len(a.queue) == 0 {
+				// Caught up: make sure the peer sees everything so far
+				if err := a.w.Flush(); err != nil {
+					a.setErr(err)
+				}
+			}
+		}
+		a.w.buffers.Put(p)
+	}
+}
+
+func (a *AsyncWriter) getErr() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+func (a *AsyncWriter) setErr(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err == nil {
+		a.err = err
+	}
+}
+
+// flushPending queues the partial block after the flush timeout.
+func (a *AsyncWriter) flushPending() {
+	a.pmu.Lock()
+	defer a.pmu.Unlock()
+	if !a.closed && len(a.pending) > 0 {
+		a.queue <- a.pending
+		a.pending = nil
+	}
+}
+
+// Write copies p into the pending block and queues the block once it is
+// full. An error from an earlier, asynchronous write is returned by the next
+// Write or Close.
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	a.pmu.Lock()
+	defer a.pmu.Unlock()
+	if a.closed {
+		return 0, ErrClosed
+	}
+
+	written := 0
+	for len(p) > 0 {
+		if err := a.getErr(); err != nil {
+			return written, err
+		}
+		if a.pending == nil {
+			// Leave room for the Writer's scratch buffer under a memory limit
+			scratch := a.w.blockSize + a.w.blockSize/255 + 16
+			a.pending = getBufferReserving(a.w.buffers, a.w.blockSize, scratch)[:0]
+		}
+		chunkSize := min(len(p), cap(a.pending)-len(a.pending))
+		a.pending = append(a.pending, p[:chunkSize]...)
+		if len(a.pending) == cap(a.pending) {
+			a.queue <- a.pending
+			a.pending = nil
+		}
+		written += chunkSize
+		p = p[chunkSize:]
+	}
+	if a.timer != nil && len(a.pending) > 0 {
+		a.timer.Reset(a.w.flushTimeout)
+	}
+	return written, nil
+}
+
+// Close waits for all queued data to be compressed and closes the wrapped
+// Writer.
+func (a *AsyncWriter) Close() error {
+	a.pmu.Lock()
+	if !a.closed {
+		a.closed = true
+		if a.timer != nil {
+			a.timer.Stop()
+		}
+		if len(a.pending) > 0 {
+			a.queue <- a.pending
+			a.pending = nil
+		}
+		close(a.queue)
+	}
+	a.pmu.Unlock()
+
+	<-a.done
+	if err := a.getErr(); err != nil {
+		a.w.CloseWithError(err)
+		return err
+	}
+	return a.w.Close()
+}
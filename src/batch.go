@@ -0,0 +1,134 @@
+package lz4
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+// FileSpec names a file to compress and where to put the result.
+type FileSpec struct {
+	Src string
+	Dst string
+}
+
+// CompressFiles compresses every spec's Src into its Dst with the given
+// Writer options. Files are compressed one at a time unless a WorkerPool is
+// passed with WithWorkerPool, in which case as many files as the pool has
+// workers are compressed at once. On the first error, or when ctx is
+// canceled, the remaining files are skipped, the partial output of the
+// failed file is removed and the error is returned.
+func CompressFiles(ctx context.Context, specs []FileSpec, options ...Option) (Manifest, error) {
+	probe := NewWriter(io.Discard)
+	if err := probe.Apply(options...); err != nil {
+		return Manifest{}, err
+	}
+	workers := 1
+	if probe.pool != nil {
+		workers = cap(probe.pool.slots)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	m := Manifest{Files: make([]ManifestEntry, len(specs))}
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	jobs := make(chan int)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				entry, err := compressFile(ctx, specs[i], options)
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				m.Files[i] = entry
+			}
+		}()
+	}
+
+feed:
+	for i := range specs {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	if firstErr != nil {
+		return Manifest{}, firstErr
+	}
+	return m, nil
+}
+
+func compressFile(ctx context.Context, spec FileSpec, options []Option) (ManifestEntry, error) {
+	entry := ManifestEntry{Src: spec.Src, Dst: spec.Dst}
+	if err := ctx.Err(); err != nil {
+		return entry, err
+	}
+
+	src, err := os.Open(spec.Src)
+	if err != nil {
+		return entry, err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(spec.Dst)
+	if err != nil {
+		return entry, err
+	}
+
+	if fi, err := src.Stat(); err == nil {
+		entry.ModTime = fi.ModTime()
+	}
+
+	sum, sha := xxHash32.New(0), sha256.New()
+	in := NewCountingReader(io.TeeReader(&contextReader{ctx: ctx, r: src}, io.MultiWriter(sum, sha)))
+	out := NewCountingWriter(dst)
+	err = CompressStream(in, out, options...)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(spec.Dst)
+		return entry, err
+	}
+
+	entry.Size = in.Count()
+	entry.CompressedSize = out.Count()
+	entry.Checksum = sum.Sum32()
+	sha.Sum(entry.SHA256[:0])
+	return entry, nil
+}
+
+// contextReader fails reads once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
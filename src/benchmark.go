@@ -0,0 +1,158 @@
+package lz4
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"time"
+)
+
+var ErrRoundTrip = errors.New("decompressed data does not match the input")
+
+// Result holds the measurements of one Benchmark run.
+type Result struct {
+	Size           int64
+	CompressedSize int64
+
+	CompressTime   time.Duration
+	DecompressTime time.Duration
+
+	// Heap allocations made by compression and decompression, in number of
+	// objects and bytes.
+	CompressAllocs       uint64
+	CompressAllocBytes   uint64
+	DecompressAllocs     uint64
+	DecompressAllocBytes uint64
+}
+
+// Ratio returns the compressed size as a fraction of the input size.
+func (r Result) Ratio() float64 {
+	if r.Size == 0 {
+		return 0
+	}
+	return float64(r.CompressedSize) / float64(r.Size)
+}
+
+// CompressSpeed returns the compression throughput in MB/s of input.
+func (r Result) CompressSpeed() float64 {
+	return megabytesPerSecond(r.Size, r.CompressTime)
+}
+
+// DecompressSpeed returns the decompression throughput in MB/s of output.
+func (r Result) DecompressSpeed() float64 {
+	return megabytesPerSecond(r.Size, r.DecompressTime)
+}
+
+func megabytesPerSecond(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / 1e6 / d.Seconds()
+}
+
+// Benchmark compresses data with the given options, decompresses it again
+// and checks that the round trip is lossless. Output buffers are allocated
+// before timing starts, so the allocation counts cover only the codec.
+// Options that do not apply to a Reader are ignored for decompression.
+// Call it repeatedly and keep the best times for stable figures.
+func Benchmark(data []byte, options ...Option) (Result, error) {
+	newWriter := func(dst io.Writer) (io.WriteCloser, error) {
+		w := NewWriter(dst)
+		return w, w.Apply(options...)
+	}
+	newReader := func(src io.Reader) (io.Reader, error) {
+		rd := NewReader(src)
+		for _, o := range options {
+			if err := rd.Apply(o); err != nil && err != ErrOptionNotApplicable {
+				return nil, err
+			}
+		}
+		return rd, nil
+	}
+	return benchmark(data, newWriter, newReader)
+}
+
+// BenchmarkCodec measures c as Benchmark measures the built-in engine, so
+// that other engines can be compared with it on the same data without
+// being registered.
+func BenchmarkCodec(data []byte, c Codec) (Result, error) {
+	return benchmark(data, c.NewWriter, c.NewReader)
+}
+
+// BenchmarkDecompress measures the decompression of compressed, a stream
+// of c, or of the built-in engine if c is nil. Size is that of the
+// decompressed data; the compression fields are left zero.
+func BenchmarkDecompress(compressed []byte, c Codec) (Result, error) {
+	r := Result{CompressedSize: int64(len(compressed))}
+	newReader := func(src io.Reader) (io.Reader, error) { return NewReader(src), nil }
+	if c != nil {
+		newReader = c.NewReader
+	}
+	// An untimed run sizes the output buffer
+	var out bytes.Buffer
+	if err := decompressInto(&out, compressed, newReader); err != nil {
+		return r, err
+	}
+	r.Size = int64(out.Len())
+	out.Reset()
+
+	var err error
+	r.DecompressTime, r.DecompressAllocs, r.DecompressAllocBytes = measure(func() {
+		err = decompressInto(&out, compressed, newReader)
+	})
+	return r, err
+}
+
+func benchmark(data []byte, newWriter func(io.Writer) (io.WriteCloser, error), newReader func(io.Reader) (io.Reader, error)) (Result, error) {
+	r := Result{Size: int64(len(data))}
+
+	var compressed bytes.Buffer
+	compressed.Grow(len(data) + len(data)/255 + 64)
+	w, err := newWriter(&compressed)
+	if err != nil {
+		return r, err
+	}
+	r.CompressTime, r.CompressAllocs, r.CompressAllocBytes = measure(func() {
+		if _, err = w.Write(data); err == nil {
+			err = w.Close()
+		}
+	})
+	if err != nil {
+		return r, err
+	}
+	r.CompressedSize = int64(compressed.Len())
+
+	var out bytes.Buffer
+	out.Grow(len(data))
+	r.DecompressTime, r.DecompressAllocs, r.DecompressAllocBytes = measure(func() {
+		err = decompressInto(&out, compressed.Bytes(), newReader)
+	})
+	if err != nil {
+		return r, err
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		return r, ErrRoundTrip
+	}
+	return r, nil
+}
+
+// decompressInto decodes compressed with a reader from newReader into out.
+func decompressInto(out *bytes.Buffer, compressed []byte, newReader func(io.Reader) (io.Reader, error)) error {
+	rd, err := newReader(bytes.NewReader(compressed))
+	if err != nil {
+		return err
+	}
+	_, err = out.ReadFrom(rd)
+	return err
+}
+
+func measure(f func()) (time.Duration, uint64, uint64) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	f()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	return elapsed, after.Mallocs - before.Mallocs, after.TotalAlloc - before.TotalAlloc
+}
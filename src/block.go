@@ -0,0 +1,54 @@
+package lz4
+
+import "errors"
+
+var ErrInvalidMinMatch = errors.New("invalid minimum match length")
+
+// CompressBlockBound returns the largest size a block of n bytes can
+// compress to, which is enough room for dst in CompressBlock.
+func CompressBlockBound(n int) int {
+	return compressBound(n)
+}
+
+// CompressBlock compresses src into dst as a single raw LZ4 block, without
+// any frame around it, and returns the number of bytes written. dst should
+// be at least CompressBlockBound(len(src)) bytes long, or compression may
+// fail with ErrBlockTooLarge. The block does not record its decompressed
+// size, which the caller has to keep to size the destination of
+// DecompressBlock.
+func CompressBlock(src, dst []byte) (int, error) {
+	return CompressBlockMinMatch(src, dst, minMatchLength)
+}
+
+// DecompressBlock decodes a raw LZ4 block into dst and returns the number of
+// bytes written. It fails with ErrBlockTooLarge if dst is too small.
+func DecompressBlock(src, dst []byte) (int, error) {
+	return decompressBlock(src, dst, minMatchLength)
+}
+
+// CompressBlockMinMatch compresses src into dst as a single raw block whose
+// matches are at least minMatch bytes long, and returns the number of bytes
+// written. Match lengths are encoded relative to minMatch, so unless minMatch
+// is 4 the result is NOT valid LZ4: it can only be decoded by
+// DecompressBlockMinMatch with the same minMatch and must never be placed in
+// a frame.
+func CompressBlockMinMatch(src, dst []byte, minMatch int) (int, error) {
+	if minMatch < minMatchLength || minMatch > maxMinMatch {
+		return 0, ErrInvalidMinMatch
+	}
+	params := compressParams{minMatch: minMatch}
+	if len(src) < mfLimit+1 {
+		// Too short to contain a match, so no hash table is needed.
+		return compressBlock(src, dst, nil, params)
+	}
+	return compressBlock(src, dst, newMatchTable(hashSize), params)
+}
+
+// DecompressBlockMinMatch decodes a raw block produced by
+// CompressBlockMinMatch with the same minMatch.
+func DecompressBlockMinMatch(src, dst []byte, minMatch int) (int, error) {
+	if minMatch < minMatchLength || minMatch > maxMinMatch {
+		return 0, ErrInvalidMinMatch
+	}
+	return decompressBlock(src, dst, minMatch)
+}
@@ -0,0 +1,107 @@
+package lz4
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// TestTinyInputs covers every size around mfLimit+1, below which a block
+// cannot hold a match and is written as literals alone.
+func TestTinyInputs(t *testing.T) {
+	inputs := map[string]func(n int) []byte{
+		"repeated": func(n int) []byte { return bytes.Repeat([]byte{'a'}, n) },
+		"distinct": func(n int) []byte {
+			b := make([]byte, n)
+			for i := range b {
+				b[i] = byte(i)
+			}
+			return b
+		},
+	}
+	for name, input := range inputs {
+		for n := 0; n <= 16; n++ {
+			src := input(n)
+
+			dst := make([]byte, CompressBlockBound(n))
+			size, err := CompressBlock(src, dst)
+			if err != nil {
+				t.Fatalf("%s/%d: CompressBlock: %v", name, n, err)
+			}
+			block := dst[:size]
+			switch {
+			case n == 0:
+				if size != 0 {
+					t.Errorf("%s/%d: CompressBlock wrote %d bytes", name, n, size)
+				}
+			case n < mfLimit+1:
+				if want := append([]byte{byte(n << 4)}, src...); !bytes.Equal(block, want) {
+					t.Errorf("%s/%d: CompressBlock = %x, want literals only %x", name, n, block, want)
+				}
+			case name == "repeated":
+				if size >= 1+n {
+					t.Errorf("%s/%d: CompressBlock wrote %d bytes, want a match", name, n, size)
+				}
+			}
+			out := make([]byte, n)
+			if m, err := DecompressBlock(block, out); err != nil || m != n || !bytes.Equal(out, src) {
+				t.Errorf("%s/%d: DecompressBlock = %d, %v", name, n, m, err)
+			}
+
+			frame, err := Compress(src)
+			if err != nil {
+				t.Fatalf("%s/%d: Compress: %v", name, n, err)
+			}
+			if got, err := Decompress(frame); err != nil || !bytes.Equal(got, src) {
+				t.Errorf("%s/%d: Decompress(Compress) = %x, %v", name, n, got, err)
+			}
+
+			var buf bytes.Buffer
+			w := NewWriter(&buf)
+			if _, err := w.Write(src); err != nil {
+				t.Fatalf("%s/%d: Write: %v", name, n, err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("%s/%d: Close: %v", name, n, err)
+			}
+			if got, err := io.ReadAll(NewReader(&buf)); err != nil || !bytes.Equal(got, src) {
+				t.Errorf("%s/%d: Reader = %x, %v", name, n, got, err)
+			}
+		}
+	}
+}
+
+func TestBlockRoundTrip(t *testing.T) {
+	random := make([]byte, 100<<10)
+	rand.New(rand.NewSource(1)).Read(random)
+	text := bytes.Repeat([]byte("a block of text, a block of text with more text. "), 20000)
+	inputs := map[string][]byte{
+		"random": random,
+		"text":   text,
+		"zeros":  make([]byte, 5<<20),
+	}
+	for name, src := range inputs {
+		dst := make([]byte, CompressBlockBound(len(src)))
+		n, err := CompressBlock(src, dst)
+		if err != nil {
+			t.Fatalf("%s: CompressBlock: %v", name, err)
+		}
+		block := dst[:n]
+		out := make([]byte, len(src))
+		if m, err := DecompressBlock(block, out); err != nil || m != len(src) || !bytes.Equal(out, src) {
+			t.Errorf("%s: DecompressBlock = %d, %v", name, m, err)
+		}
+		if _, err := DecompressBlock(block, out[:len(src)-1]); !errors.Is(err, ErrBlockTooLarge) {
+			t.Errorf("%s: DecompressBlock into a short dst = %v, want %v", name, err, ErrBlockTooLarge)
+		}
+		if _, err := DecompressBlock(block[:n/2], out); err == nil {
+			t.Errorf("%s: DecompressBlock of a truncated block succeeded", name)
+		}
+	}
+
+	if _, err := CompressBlock(random, make([]byte, len(random)/2)); !errors.Is(err, ErrBlockTooLarge) {
+		t.Errorf("CompressBlock into a short dst = %v, want %v", err, ErrBlockTooLarge)
+	}
+}
@@ -0,0 +1,20 @@
+package lz4
+
+// BufferPool supplies the block-sized byte buffers used by Writers, Readers
+// and AsyncWriters. Get must return a slice with a capacity of at least size;
+// buffers are handed back with Put once the codec no longer references them.
+// AsyncWriter calls Get and Put from different goroutines.
+type BufferPool interface {
+	Get(size int) []byte
+	Put(buf []byte)
+}
+
+type heapPool struct{}
+
+func (heapPool) Get(size int) []byte { return make([]byte, size) }
+
+func (heapPool) Put([]byte) {}
+
+func getBuffer(p BufferPool, size int) []byte {
+	return p.Get(size)[:size]
+}
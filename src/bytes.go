@@ -0,0 +1,40 @@
+package lz4
+
+import "bytes"
+
+// maxRatio bounds how many bytes a byte of LZ4 input can decode to, so that
+// a content size declared by a corrupted header cannot make Decompress
+// allocate more than the frame could ever hold.
+const maxRatio = 255
+
+// Compress returns data compressed as an LZ4 frame with the given Writer
+// options.
+func Compress(data []byte, options ...Option) ([]byte, error) {
+	c, err := NewCompressor(options...)
+	if err != nil {
+		return nil, err
+	}
+	return c.CompressFrame(data, make([]byte, 0, maxFrameHeaderSize+compressBound(len(data))+8))
+}
+
+// Decompress returns the content of the LZ4 frames in data, decoded with
+// the given Reader options. If the first frame declares its content size,
+// the result is allocated at that size up front.
+func Decompress(data []byte, options ...Option) ([]byte, error) {
+	r := NewReader(bytes.NewReader(data))
+	if err := r.Apply(options...); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if size, err := r.Size(); err == nil && size > 0 && size <= int64(len(data))*maxRatio {
+		buf.Grow(int(size))
+	}
+	if _, err := buf.ReadFrom(r); err != nil {
+		r.Close()
+		return nil, err
+	}
+	if err := r.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,52 @@
+package lz4_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	lz4 "rzstd/src"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+func TestCompressDecompress(t *testing.T) {
+	data := testInput(300 << 10)
+	options := []lz4.Option{lz4.WithBlockSize(64 << 10), lz4.WithContentChecksum()}
+	frame, err := lz4.Compress(data, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := compress(t, data, options...); !bytes.Equal(frame, want) {
+		t.Error("Compress differs from a Writer with the same options")
+	}
+	got, err := lz4.Decompress(append(bytes.Clone(frame), frame...))
+	if err != nil || !bytes.Equal(got, append(bytes.Clone(data), data...)) {
+		t.Errorf("Decompress of two frames = %d bytes, %v", len(got), err)
+	}
+
+	if _, err := lz4.Compress(data, lz4.WithBlockSize(1000)); !errors.Is(err, lz4.ErrInvalidBlockSize) {
+		t.Errorf("Compress with a bad option = %v, want %v", err, lz4.ErrInvalidBlockSize)
+	}
+	if _, err := lz4.Decompress(frame, lz4.WithBlockChecksum()); !errors.Is(err, lz4.ErrOptionNotApplicable) {
+		t.Errorf("Decompress with a Writer option = %v, want %v", err, lz4.ErrOptionNotApplicable)
+	}
+	if got, err := lz4.Decompress(frame[:len(frame)-10]); err == nil || got != nil {
+		t.Errorf("Decompress of a truncated frame = %d bytes, %v", len(got), err)
+	}
+}
+
+// TestDecompressHugeContentSize declares far more content than the frame
+// can hold. Decompress must not trust it to allocate, and still fail.
+func TestDecompressHugeContentSize(t *testing.T) {
+	frame, err := lz4.Compress(testInput(1000), lz4.WithContentSize(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint64(frame[6:], 1<<50)
+	frame[14] = byte(xxHash32.Checksum(frame[4:14], 0) >> 8)
+	if _, err := lz4.Decompress(frame); !errors.Is(err, lz4.ErrContentSize) {
+		t.Errorf("Decompress = %v, want %v", err, lz4.ErrContentSize)
+	}
+}
@@ -0,0 +1,266 @@
+package lz4
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+const checkpointVersion = 2
+
+var (
+	ErrInvalidCheckpoint  = errors.New("invalid checkpoint")
+	ErrCheckpointSettings = errors.New("checkpoint was taken with different settings")
+)
+
+// Checkpoint is an opaque snapshot of a Writer between two calls, which can
+// be stored and later passed to ResumeWriter. Blocks are compressed
+// independently, so no match history is needed to continue the stream; the
+// content checksum of the frame being written is saved with it.
+type Checkpoint []byte
+
+// InputOffset returns how many uncompressed bytes had been written when the
+// checkpoint was taken.
+func (c Checkpoint) InputOffset() int64 {
+	if len(c) < 18 {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint64(c[2:]))
+}
+
+// OutputOffset returns how many compressed bytes had been produced when the
+// checkpoint was taken; the destination passed to ResumeWriter must continue
+// from exactly this offset.
+func (c Checkpoint) OutputOffset() int64 {
+	if len(c) < 18 {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint64(c[10:]))
+}
+
+// Checkpoint captures the state of w. It fails if w has already failed.
+func (w *Writer) Checkpoint() (Checkpoint, error) {
+	if err := w.drain(); err != nil {
+		return nil, err
+	}
+	if w.err != nil {
+		return nil, w.err
+	}
+	if w.parity != nil {
+		return nil, ErrParityCheckpoint
+	}
+	if w.seekable {
+		return nil, ErrSeekIndexCheckpoint
+	}
+	if w.checksumInterval > 0 {
+		return nil, ErrChecksumIntervalCheckpoint
+	}
+	if w.linked && w.blocksInFrame > 0 {
+		// The next block depends on the history of the frame
+		return nil, ErrLinkedCheckpoint
+	}
+
+	var flags byte
+	if w.headerWritten {
+		flags |= 1
+	}
+	if w.sectionOpen {
+		flags |= 2
+	}
+	if w.adaptive {
+		// The adaptive step, from -1 to adaptHC, takes three bits
+		flags |= byte(w.adaptStep+1) << 2
+	}
+	if w.content != nil {
+		flags |= 32
+	}
+	c := Checkpoint{checkpointVersion, flags}
+	c = binary.LittleEndian.AppendUint64(c, uint64(w.consumed))
+	c = binary.LittleEndian.AppendUint64(c, uint64(w.dst.n))
+	c = binary.LittleEndian.AppendUint32(c, uint32(w.blocksInFrame))
+	c = binary.LittleEndian.AppendUint32(c, uint32(w.frames))
+
+	settings := w.settings()
+	c = binary.LittleEndian.AppendUint16(c, uint16(len(settings)))
+	c = append(c, settings...)
+
+	c = binary.LittleEndian.AppendUint32(c, uint32(len(w.sections)))
+	for _, s := range w.sections {
+		c = binary.LittleEndian.AppendUint16(c, uint16(len(s.Name)))
+		c = append(c, s.Name...)
+		c = binary.LittleEndian.AppendUint64(c, uint64(s.Offset))
+		c = binary.LittleEndian.AppendUint64(c, uint64(s.Length))
+	}
+
+	if w.digest != nil {
+		state, err := w.digest.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		c = binary.LittleEndian.AppendUint16(c, uint16(len(state)))
+		c = append(c, state...)
+	}
+	if w.content != nil {
+		// The frame is interrupted, so its content checksum goes on
+		state, _ := w.content.MarshalBinary()
+		c = append(c, state...)
+	}
+	return c, nil
+}
+
+// settings encodes everything that influences the bytes a Writer produces.
+func (w *Writer) settings() []byte {
+	var flags byte
+	if w.params.favorDecSpeed {
+		flags |= 1
+	}
+	if w.params.dualHash {
+		flags |= 2
+	}
+	if w.adaptive {
+		flags |= 4
+	}
+	if w.digest != nil {
+		flags |= 8
+	}
+	if w.partSize != 0 {
+		flags |= 16
+	}
+	if w.level != defaultLevel {
+		flags |= 32
+	}
+	if w.contentChecksum {
+		flags |= 64
+	}
+	if w.blockChecksum {
+		flags |= 128
+	}
+	b := []byte{flags}
+	b = binary.LittleEndian.AppendUint32(b, uint32(w.params.minMatch))
+	b = binary.LittleEndian.AppendUint32(b, uint32(w.blockSize))
+	b = binary.LittleEndian.AppendUint32(b, uint32(w.alignment))
+	if w.partSize != 0 {
+		b = binary.LittleEndian.AppendUint64(b, uint64(w.partSize))
+	}
+	if w.level != defaultLevel {
+		b = append(b, byte(int8(w.level)))
+	}
+	// The flags are all taken, so later settings have a second flag byte,
+	// left out when none of them is used
+	var ext byte
+	if w.contentSize >= 0 {
+		ext |= 1
+	}
+	if w.dict != nil {
+		ext |= 2
+	}
+	if w.linked {
+		ext |= 4
+	}
+	if w.acceleration != 0 {
+		ext |= 8
+	}
+	if ext == 0 {
+		return b
+	}
+	b = append(b, ext)
+	if w.contentSize >= 0 {
+		b = binary.LittleEndian.AppendUint64(b, uint64(w.contentSize))
+	}
+	if w.dict != nil {
+		b = binary.LittleEndian.AppendUint32(b, w.dictID)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(w.dict)))
+		b = binary.LittleEndian.AppendUint32(b, xxHash32.Checksum(w.dict, 0))
+	}
+	if w.acceleration != 0 {
+		b = binary.LittleEndian.AppendUint32(b, uint32(w.acceleration))
+	}
+	return b
+}
+
+// ResumeWriter returns a Writer that continues the stream captured by c,
+// producing the same bytes the original Writer would have. dst must be
+// positioned at c.OutputOffset() and options must match the original ones.
+func ResumeWriter(dst io.Writer, c Checkpoint, options ...Option) (*Writer, error) {
+	w := NewWriter(dst)
+	if err := w.Apply(options...); err != nil {
+		return nil, err
+	}
+
+	if len(c) < 28 || c[0] != checkpointVersion {
+		return nil, ErrInvalidCheckpoint
+	}
+	flags := c[1]
+	w.consumed = int64(binary.LittleEndian.Uint64(c[2:]))
+	w.dst.n = int64(binary.LittleEndian.Uint64(c[10:]))
+	w.blocksInFrame = int(binary.LittleEndian.Uint32(c[18:]))
+	w.frames = int(binary.LittleEndian.Uint32(c[22:]))
+	n := int(binary.LittleEndian.Uint16(c[26:]))
+	p := c[28:]
+	if len(p) < n+4 {
+		return nil, ErrInvalidCheckpoint
+	}
+	if !bytes.Equal(p[:n], w.settings()) {
+		return nil, ErrCheckpointSettings
+	}
+	p = p[n:]
+
+	count := binary.LittleEndian.Uint32(p)
+	p = p[4:]
+	for i := uint32(0); i < count; i++ {
+		if len(p) < 2 {
+			return nil, ErrInvalidCheckpoint
+		}
+		nameLen := int(binary.LittleEndian.Uint16(p))
+		p = p[2:]
+		if len(p) < nameLen+16 {
+			return nil, ErrInvalidCheckpoint
+		}
+		w.sections = append(w.sections, Section{
+			Name:   string(p[:nameLen]),
+			Offset: int64(binary.LittleEndian.Uint64(p[nameLen:])),
+			Length: int64(binary.LittleEndian.Uint64(p[nameLen+8:])),
+		})
+		p = p[nameLen+16:]
+	}
+
+	if w.digest != nil {
+		if len(p) < 2 {
+			return nil, ErrInvalidCheckpoint
+		}
+		n := int(binary.LittleEndian.Uint16(p))
+		if len(p) < 2+n {
+			return nil, ErrInvalidCheckpoint
+		}
+		if err := w.digest.(encoding.BinaryUnmarshaler).UnmarshalBinary(p[2 : 2+n]); err != nil {
+			return nil, ErrInvalidCheckpoint
+		}
+		p = p[2+n:]
+	}
+	if flags&32 != 0 {
+		if !w.contentChecksum || flags&1 == 0 {
+			return nil, ErrInvalidCheckpoint
+		}
+		w.content = newXXH32()
+		if err := w.content.UnmarshalBinary(p); err != nil {
+			return nil, ErrInvalidCheckpoint
+		}
+	}
+
+	w.headerWritten = flags&1 != 0
+	w.sectionOpen = flags&2 != 0
+	if w.adaptive {
+		w.adaptStep = int(flags>>2&7) - 1
+		if w.adaptStep >= len(adaptLadder) {
+			return nil, ErrInvalidCheckpoint
+		}
+	}
+	if w.sectionOpen && len(w.sections) == 0 {
+		return nil, ErrInvalidCheckpoint
+	}
+	return w, nil
+}
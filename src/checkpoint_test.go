@@ -0,0 +1,65 @@
+package lz4_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	lz4 "rzstd/src"
+)
+
+// TestResumeWriter checkpoints a Writer in the middle of a frame and checks
+// that a Writer resumed from the checkpoint produces the rest of the
+// original output.
+func TestResumeWriter(t *testing.T) {
+	data := testInput(300 << 10)
+	half := len(data)/2 + 1000
+	settings := map[string][]lz4.Option{
+		"plain":            {lz4.WithBlockSize(64 << 10)},
+		"content checksum": {lz4.WithBlockSize(64 << 10), lz4.WithContentChecksum(), lz4.WithBlockChecksum()},
+	}
+	for name, options := range settings {
+		var out bytes.Buffer
+		w := lz4.NewWriter(&out)
+		if err := w.Apply(options...); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data[:half]); err != nil {
+			t.Fatal(err)
+		}
+		c, err := w.Checkpoint()
+		if err != nil {
+			t.Fatalf("%s: Checkpoint: %v", name, err)
+		}
+		if _, err := w.Write(data[half:]); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		original := out.Bytes()
+
+		var tail bytes.Buffer
+		rw, err := lz4.ResumeWriter(&tail, c, options...)
+		if err != nil {
+			t.Fatalf("%s: ResumeWriter: %v", name, err)
+		}
+		if _, err := rw.Write(data[c.InputOffset():]); err != nil {
+			t.Fatal(err)
+		}
+		if err := rw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(tail.Bytes(), original[c.OutputOffset():]) {
+			t.Errorf("%s: resumed output differs from the original after offset %d", name, c.OutputOffset())
+		}
+		resumed := append(bytes.Clone(original[:c.OutputOffset()]), tail.Bytes()...)
+		if got := decompress(t, resumed); !bytes.Equal(got, data) {
+			t.Errorf("%s: resumed stream does not decompress to the input", name)
+		}
+
+		if _, err := lz4.ResumeWriter(&tail, c, lz4.WithBlockSize(256<<10)); !errors.Is(err, lz4.ErrCheckpointSettings) {
+			t.Errorf("%s: ResumeWriter with other settings = %v, want %v", name, err, lz4.ErrCheckpointSettings)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package lz4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+const (
+	checksumTag = "RZCK"
+	// Tag, block count (8), content size (8) and the cumulative xxh32 (4)
+	checksumPayloadSize = 4 + 8 + 8 + 4
+)
+
+var (
+	ErrInvalidChecksumInterval    = errors.New("invalid checksum interval")
+	ErrChecksumIntervalCheckpoint = errors.New("checkpoints are not supported with a checksum interval")
+)
+
+// WithContentChecksum makes a Writer set the content checksum flag in its
+// frame headers and follow the end mark of every frame with the xxh32 of
+// the frame's content, as the reference lz4 tool does by default.
+func WithContentChecksum() Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			w.contentChecksum = true
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// WithBlockChecksum makes a Writer set the block checksum flag in its frame
+// headers and follow every block with the xxh32 of its compressed bytes, as
+// lz4 -BX does. The Reader verifies them whenever the flag is set.
+func WithBlockChecksum() Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			w.blockChecksum = true
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// frameFlags returns the FLG byte of the frames w writes.
+func (w *Writer) frameFlags() byte {
+	flg := byte(flgByte)
+	if w.blockChecksum {
+		flg |= 0x10
+	}
+	if w.contentChecksum {
+		flg |= 0x04
+	}
+	if w.contentSize >= 0 && w.frames == 0 {
+		flg |= 0x08
+	}
+	if w.dict != nil {
+		flg |= 0x01
+	}
+	if w.linked {
+		flg &^= 0x20
+	}
+	return flg
+}
+
+// writeContentChecksum writes the checksum of the frame being ended, if
+// any.
+func (w *Writer) writeContentChecksum() error {
+	if w.content == nil {
+		return nil
+	}
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], w.content.Sum32())
+	w.content = nil
+	_, err := w.dst.Write(sum[:])
+	return err
+}
+
+// WithChecksumInterval makes a Writer end the frame every blocks blocks and
+// follow it with a skippable frame holding the block count, the size and the
+// xxh32 of everything written so far. The Reader verifies each of them as it
+// gets there, so corruption is reported within blocks blocks of where it
+// happened instead of at the end of the stream, for much less than a
+// checksum per block. Other LZ4 decoders skip them.
+func WithChecksumInterval(blocks int) Option {
+	return func(a applier) error {
+		if blocks < 1 {
+			return ErrInvalidChecksumInterval
+		}
+		switch rw := a.(type) {
+		case *Writer:
+			rw.checksumInterval = blocks
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// writeChecksumFrame writes the cumulative checksum of the blocks so far.
+// The stream starts with one for no blocks, which tells the Reader to keep
+// a running checksum.
+func (w *Writer) writeChecksumFrame() error {
+	payload := []byte(checksumTag)
+	payload = binary.LittleEndian.AppendUint64(payload, uint64(w.checksumBlocks))
+	payload = binary.LittleEndian.AppendUint64(payload, uint64(w.consumed))
+	payload = binary.LittleEndian.AppendUint32(payload, w.cumulative.Sum32())
+	if err := writeSkippableFrame(w.dst, checksumNibble, payload); err != nil {
+		w.err = err
+		return err
+	}
+	w.sinceChecksum = 0
+	return nil
+}
+
+// blockHash returns the hashes a block is fed to, if any. A single hash is
+// returned as is, without allocating.
+func (w *Writer) blockHash() io.Writer {
+	var content io.Writer
+	if w.content != nil {
+		// A nil *xxh32State would not be a nil io.Writer
+		content = w.content
+	}
+	all := [...]io.Writer{w.digest, w.cumulative, content}
+	hashes := all[:0]
+	for _, h := range all {
+		if h != nil {
+			hashes = append(hashes, h)
+		}
+	}
+	switch len(hashes) {
+	case 0:
+		return nil
+	case 1:
+		return hashes[0]
+	}
+	return io.MultiWriter(hashes...)
+}
+
+// minAsyncHash is the smallest input hashed on a separate goroutine; below
+// it the handoff costs more than it saves.
+const minAsyncHash = 64 * 1024
+
+var hashed = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// hashAsync writes p to h on another goroutine, so that checksums are
+// computed while the block is compressed or consumed, and returns a channel
+// that is closed once it is done. Until then neither p nor h may be
+// touched. On a single CPU, or for small inputs, p is hashed right away.
+func hashAsync(h io.Writer, p []byte) <-chan struct{} {
+	if len(p) < minAsyncHash || runtime.GOMAXPROCS(0) == 1 {
+		h.Write(p)
+		return hashed
+	}
+	done := make(chan struct{})
+	go func() {
+		h.Write(p)
+		close(done)
+	}()
+	return done
+}
+
+// waitHash waits for the checksum of the last block to be computed and
+// releases the buffer it was read from.
+func (r *Reader) waitHash() {
+	if r.hashing == nil {
+		return
+	}
+	<-r.hashing
+	r.hashing = nil
+	if r.hashingBuf != nil {
+		r.putBlockBuffer(r.hashingBuf)
+		r.hashingBuf = nil
+	}
+}
+
+// checkBlock reads the checksum that follows block in a frame with block
+// checksums and verifies it.
+func (r *Reader) checkBlock(block []byte) error {
+	if !r.header.BlocksChecksumFlag {
+		return nil
+	}
+	sum, err := r.readUint32()
+	if err != nil {
+		return noEOF(err)
+	}
+	if sum != xxHash32.Checksum(block, 0) {
+		return ErrBlockChecksum
+	}
+	return nil
+}
+
+// blockHash returns the hashes a decoded block is fed to, if any.
+func (r *Reader) blockHash() io.Writer {
+	switch {
+	case r.checksum != nil && r.cumulative != nil:
+		return io.MultiWriter(r.checksum, r.cumulative)
+	case r.checksum != nil:
+		return r.checksum
+	case r.cumulative != nil:
+		return r.cumulative
+	}
+	return nil
+}
+
+// readFirstHeader reads the header of the first frame, after the checkpoint
+// that starts a stream written with WithChecksumInterval and any skippable
+// frames, which hold metadata or padding of other tools.
+func (r *Reader) readFirstHeader() (*DecodedFrameHeader, error) {
+	var m [4]byte
+	for {
+		if _, err := io.ReadFull(r.src, m[:]); err != nil {
+			return nil, err
+		}
+		switch id := binary.LittleEndian.Uint32(m[:]); {
+		case id == skippableMagic|checksumNibble:
+			r.cumulative = xxHash32.New(0)
+			if err := r.checkChecksumFrame(); err != nil {
+				return nil, err
+			}
+			header, err := r.readNextHeader()
+			if header == nil && err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return header, err
+		case isSkippableMagic(id):
+			if err := r.skipSkippable(); err != nil {
+				return nil, err
+			}
+		default:
+			return ReadFrameHeader(io.MultiReader(bytes.NewReader(m[:]), r.src))
+		}
+	}
+}
+
+// checkChecksumFrame reads the rest of a checkpoint written by
+// WithChecksumInterval and compares it with the output so far.
+func (r *Reader) checkChecksumFrame() error {
+	var p [4 + checksumPayloadSize]byte
+	if _, err := io.ReadFull(r.src, p[:]); err != nil {
+		return noEOF(err)
+	}
+	if binary.LittleEndian.Uint32(p[:]) != checksumPayloadSize || string(p[4:8]) != checksumTag {
+		return fmt.Errorf("%w: invalid checksum frame", ErrCorrupted)
+	}
+	blocks := int64(binary.LittleEndian.Uint64(p[8:]))
+	size := int64(binary.LittleEndian.Uint64(p[16:]))
+	r.waitHash()
+	if blocks != r.checksumBlocks || size != r.checksumSize || binary.LittleEndian.Uint32(p[24:]) != r.cumulative.Sum32() {
+		return fmt.Errorf("%w: checkpoint after block %d", ErrContentChecksum, blocks)
+	}
+	return nil
+}
+
+// nextFrame continues a stream written with WithChecksumInterval past the
+// end of a frame: it verifies the checkpoint that follows and starts the
+// next frame. It reports false at the end of the stream.
+func (r *Reader) nextFrame() (bool, error) {
+	var m [4]byte
+	if _, err := io.ReadFull(r.src, m[:]); err != nil {
+		return false, noEOF(err)
+	}
+	if binary.LittleEndian.Uint32(m[:]) != skippableMagic|checksumNibble {
+		return false, fmt.Errorf("%w: missing checksum frame", ErrCorrupted)
+	}
+	if err := r.checkChecksumFrame(); err != nil {
+		return false, err
+	}
+	header, err := r.readNextHeader()
+	if header == nil || err != nil {
+		return false, err
+	}
+	return true, r.startFrame(header)
+}
+
+// readNextHeader reads the header of the next frame, skipping padding and
+// other skippable frames. It returns nil at the end of the input, or at
+// anything else that is not a frame, which the reference decoder ignores as
+// well.
+func (r *Reader) readNextHeader() (*DecodedFrameHeader, error) {
+	var m [4]byte
+	for {
+		if r.magicRead {
+			m, r.magicRead = r.word, false
+		} else if _, err := io.ReadFull(r.src, m[:]); err == io.EOF {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		switch id := binary.LittleEndian.Uint32(m[:]); {
+		case id == magic || id == legacyMagic:
+			return ReadFrameHeader(io.MultiReader(bytes.NewReader(m[:]), r.src))
+		case isSkippableMagic(id):
+			if err := r.skipSkippable(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, nil
+		}
+	}
+}
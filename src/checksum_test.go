@@ -0,0 +1,100 @@
+package lz4_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	lz4 "rzstd/src"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+func TestContentChecksum(t *testing.T) {
+	for _, n := range []int{0, 10, 300 << 10} {
+		data := testInput(n)
+		frame := compress(t, data, lz4.WithContentChecksum())
+		header, err := lz4.ReadFrameHeader(bytes.NewReader(frame))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !header.ContentChecksumFlag {
+			t.Errorf("%d bytes: content checksum flag not set", n)
+		}
+		if got, want := binary.LittleEndian.Uint32(frame[len(frame)-4:]), xxHash32.Checksum(data, 0); got != want {
+			t.Errorf("%d bytes: content checksum = %08x, want %08x", n, got, want)
+		}
+		if got := decompress(t, frame); !bytes.Equal(got, data) {
+			t.Errorf("%d bytes: round trip does not match the input", n)
+		}
+	}
+
+	r := lz4.NewReader(bytes.NewReader(nil))
+	if err := r.Apply(lz4.WithContentChecksum()); !errors.Is(err, lz4.ErrOptionNotApplicable) {
+		t.Errorf("WithContentChecksum on a Reader = %v, want %v", err, lz4.ErrOptionNotApplicable)
+	}
+}
+
+// TestContentChecksumMismatch corrupts the content checksum of the second
+// of two frames. The first frame decodes before the error is reported.
+func TestContentChecksumMismatch(t *testing.T) {
+	first, second := testInput(70<<10), testInput(50<<10)
+	stream := append(compress(t, first, lz4.WithContentChecksum()), compress(t, second, lz4.WithContentChecksum())...)
+	computed := xxHash32.Checksum(second, 0)
+	binary.LittleEndian.PutUint32(stream[len(stream)-4:], computed^1)
+
+	r := lz4.NewReader(bytes.NewReader(stream))
+	got, err := io.ReadAll(r)
+	var mismatch *lz4.ChecksumMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Read = %v, want a ChecksumMismatchError", err)
+	}
+	if mismatch.Stored != computed^1 || mismatch.Computed != computed {
+		t.Errorf("mismatch = stored %08x, computed %08x; want %08x, %08x", mismatch.Stored, mismatch.Computed, computed^1, computed)
+	}
+	if !errors.Is(err, lz4.ErrContentChecksum) {
+		t.Errorf("errors.Is(%v, ErrContentChecksum) = false", err)
+	}
+	if !bytes.HasPrefix(got, first) {
+		t.Error("first frame was not delivered before the error")
+	}
+}
+
+func TestBlockChecksum(t *testing.T) {
+	data := testInput(300 << 10)
+	stream := compress(t, data, lz4.WithBlockSize(64<<10), lz4.WithBlockChecksum())
+	frames, err := lz4.Inspect(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := frames[0].Blocks
+	for i, b := range blocks {
+		payload := stream[b.Offset+4 : b.Offset+4+int64(b.CompressedSize)]
+		if want := xxHash32.Checksum(payload, 0); b.Checksum != want {
+			t.Errorf("block %d: checksum = %08x, want %08x", i, b.Checksum, want)
+		}
+	}
+	if got := decompress(t, stream); !bytes.Equal(got, data) {
+		t.Fatal("round trip does not match the input")
+	}
+
+	// A flipped bit in the second block is caught by its checksum, with or
+	// without decoding ahead
+	corrupt := bytes.Clone(stream)
+	corrupt[blocks[1].Offset+10] ^= 1
+	for _, concurrency := range []int{1, 4} {
+		r := lz4.NewReader(bytes.NewReader(corrupt))
+		if err := r.Apply(lz4.WithConcurrency(concurrency)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if !errors.Is(err, lz4.ErrBlockChecksum) {
+			t.Errorf("concurrency %d: Read = %v, want %v", concurrency, err, lz4.ErrBlockChecksum)
+		}
+		if !bytes.Equal(got, data[:blocks[0].UncompressedSize]) {
+			t.Errorf("concurrency %d: delivered %d bytes, want the first block", concurrency, len(got))
+		}
+	}
+}
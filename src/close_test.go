@@ -0,0 +1,91 @@
+package lz4_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	lz4 "rzstd/src"
+)
+
+func TestCloseTwice(t *testing.T) {
+	data := testInput(100 << 10)
+	var buf bytes.Buffer
+	w := lz4.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	size := buf.Len()
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+	if _, err := w.Write(data); !errors.Is(err, lz4.ErrClosed) {
+		t.Errorf("Write after Close = %v, want %v", err, lz4.ErrClosed)
+	}
+	// Aborting a closed Writer leaves it closed
+	w.Abort()
+	if err := w.Close(); err != nil {
+		t.Errorf("Close after Abort of a closed Writer = %v", err)
+	}
+	if buf.Len() != size {
+		t.Errorf("the stream grew from %d to %d bytes after Close", size, buf.Len())
+	}
+	if got := decompress(t, buf.Bytes()); !bytes.Equal(got, data) {
+		t.Errorf("decompressed %d bytes, want %d", len(got), len(data))
+	}
+}
+
+// TestCloseWithError stops Writers part way through a frame, which leaves
+// a stream the Reader reports as cut short.
+func TestCloseWithError(t *testing.T) {
+	data := testInput(200 << 10)
+	stop := map[string]struct {
+		stop func(*lz4.Writer)
+		err  error
+	}{
+		"CloseWithError": {func(w *lz4.Writer) { w.CloseWithError(errFault) }, errFault},
+		"nil error":      {func(w *lz4.Writer) { w.CloseWithError(nil) }, lz4.ErrAborted},
+		"Abort":          {(*lz4.Writer).Abort, lz4.ErrAborted},
+	}
+	for name, tt := range stop {
+		var buf bytes.Buffer
+		w := lz4.NewWriter(&buf)
+		if err := w.Apply(lz4.WithBlockSize(64 << 10)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatalf("%s: Write: %v", name, err)
+		}
+		tt.stop(w)
+		if _, err := w.Write(data); !errors.Is(err, tt.err) {
+			t.Errorf("%s: Write after stopping = %v, want %v", name, err, tt.err)
+		}
+		if err := w.Close(); !errors.Is(err, tt.err) {
+			t.Errorf("%s: Close after stopping = %v, want %v", name, err, tt.err)
+		}
+		if buf.Len() == 0 {
+			t.Errorf("%s: the blocks written before stopping were dropped", name)
+		}
+		if _, err := io.ReadAll(lz4.NewReader(&buf)); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%s: Read of the stopped stream = %v, want %v", name, err, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+// TestCompressStreamReadError fails the input of CompressStream part way,
+// which leaves an incomplete stream and returns the error.
+func TestCompressStreamReadError(t *testing.T) {
+	src := io.MultiReader(bytes.NewReader(testInput(200<<10)), iotest.ErrReader(errFault))
+	var buf bytes.Buffer
+	if err := lz4.CompressStream(src, &buf, lz4.WithBlockSize(64<<10)); !errors.Is(err, errFault) {
+		t.Fatalf("CompressStream = %v, want %v", err, errFault)
+	}
+	if _, err := io.ReadAll(lz4.NewReader(&buf)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Read of the incomplete stream = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
@@ -0,0 +1,131 @@
+package lz4
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"sync"
+)
+
+// builtinCodec is the name of the LZ4 engine of this package.
+const builtinCodec = "lz4"
+
+var ErrUnknownCodec = errors.New("unknown codec")
+
+// Codec is a compression engine other than the built-in LZ4 one, such as a
+// zstd wrapper or a hardware offload. Once registered, it is selected with
+// WithCodec, the -codec flag of the command and the benchmark harness.
+type Codec interface {
+	NewWriter(dst io.Writer) (io.WriteCloser, error)
+	NewReader(src io.Reader) (io.Reader, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{}
+)
+
+// RegisterCodec makes c available under name. Like database/sql.Register,
+// it is meant to be called from init functions and panics if c is nil or
+// name is already taken.
+func RegisterCodec(name string, c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if c == nil {
+		panic("lz4: RegisterCodec with a nil codec")
+	}
+	if _, dup := codecs[name]; dup || name == builtinCodec {
+		panic("lz4: RegisterCodec called twice for " + name)
+	}
+	codecs[name] = c
+}
+
+// Codecs returns the names of the registered codecs in sorted order,
+// starting with the built-in "lz4".
+func Codecs() []string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{builtinCodec}, names...)
+}
+
+// WithCodec makes a Writer or a Reader hand the stream to the codec
+// registered under name instead of the built-in LZ4 engine, which is
+// selected by "lz4". The other options then have no effect.
+func WithCodec(name string) Option {
+	return func(a applier) error {
+		var c Codec
+		if name != builtinCodec {
+			codecsMu.RLock()
+			c = codecs[name]
+			codecsMu.RUnlock()
+			if c == nil {
+				return ErrUnknownCodec
+			}
+		}
+		switch rw := a.(type) {
+		case *Writer:
+			rw.codec = c
+			return nil
+		case *Reader:
+			rw.codec = c
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// startCodec creates the codec's writer on first use.
+func (w *Writer) startCodec() error {
+	if w.codecWriter != nil {
+		return nil
+	}
+	cw, err := w.codec.NewWriter(w.dst)
+	if err != nil {
+		w.err = err
+		return err
+	}
+	w.codecWriter = cw
+	w.headerWritten = true
+	return nil
+}
+
+func (w *Writer) writeCodec(p []byte) (int, error) {
+	if err := w.startCodec(); err != nil {
+		return 0, err
+	}
+	n, err := w.codecWriter.Write(p)
+	w.consumed += int64(n)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *Writer) closeCodec() error {
+	if err := w.startCodec(); err != nil {
+		return err
+	}
+	if err := w.codecWriter.Close(); err != nil {
+		w.err = err
+		return err
+	}
+	w.err = ErrClosed
+	return nil
+}
+
+func (r *Reader) readCodec(p []byte) (int, error) {
+	if r.codecReader == nil {
+		cr, err := r.codec.NewReader(r.src)
+		if err != nil {
+			return 0, err
+		}
+		r.codecReader = cr
+		r.headerRead = true
+	}
+	return r.codecReader.Read(p)
+}
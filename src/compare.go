@@ -0,0 +1,147 @@
+package lz4
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Comparison is the result of comparing two streams block by block.
+type Comparison struct {
+	BlocksA int
+	BlocksB int
+	// DivergentBlock is the index of the first block whose stored bytes
+	// differ between the streams, or -1 if the streams are identical block
+	// for block. OffsetA and OffsetB locate that block in each stream, and
+	// are -1 for a stream that has no such block.
+	DivergentBlock int
+	OffsetA        int64
+	OffsetB        int64
+	// ContentEqual reports whether both streams decompress to the same
+	// bytes; if not, ContentDiffOffset is the first uncompressed offset at
+	// which they differ.
+	ContentEqual      bool
+	ContentDiffOffset int64
+	// ContentUnverified is set when a frame names a dictionary that the
+	// options do not supply. The contents are then compared up to that
+	// frame only: ContentEqual is false and ContentDiffOffset is where the
+	// comparison stopped.
+	ContentUnverified bool
+}
+
+// CompareOption configures Compare.
+type CompareOption func(*compareConfig)
+
+type compareConfig struct {
+	resolve func(id uint32) ([]byte, error)
+}
+
+// WithCompareDictionaries makes Compare decode the frames that name a
+// dictionary with the one resolve returns for its ID, as
+// WithDictionaryResolver does for a Reader.
+func WithCompareDictionaries(resolve func(id uint32) ([]byte, error)) CompareOption {
+	return func(c *compareConfig) {
+		c.resolve = resolve
+	}
+}
+
+// Compare reads two streams side by side, reporting where their compressed
+// representations diverge and whether their decompressed contents match.
+func Compare(a, b io.Reader, options ...CompareOption) (*Comparison, error) {
+	var cfg compareConfig
+	for _, o := range options {
+		o(&cfg)
+	}
+	c := &Comparison{
+		DivergentBlock:    -1,
+		OffsetA:           -1,
+		OffsetB:           -1,
+		ContentEqual:      true,
+		ContentDiffOffset: -1,
+	}
+
+	sides := [2]struct {
+		scanner *blockScanner
+		done    bool
+		pending []byte
+		buf     []byte
+	}{{scanner: newBlockScanner(a, cfg.resolve)}, {scanner: newBlockScanner(b, cfg.resolve)}}
+	var compared int64
+
+	for i := 0; !sides[0].done || !sides[1].done; i++ {
+		var blocks [2]*scannedBlock
+		for k := range sides {
+			side := &sides[k]
+			if side.done {
+				continue
+			}
+			block, err := side.scanner.next()
+			if err == io.EOF {
+				side.done = true
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("lz4: stream %c: %w", 'a'+k, err)
+			}
+			blocks[k] = block
+
+			if c.ContentEqual {
+				data, err := side.scanner.decode(block, side.buf)
+				if err != nil && err == side.scanner.dictErr {
+					c.ContentEqual, c.ContentUnverified = false, true
+					c.ContentDiffOffset = compared
+					continue
+				}
+				if err != nil {
+					return nil, fmt.Errorf("lz4: stream %c, block %d: %w", 'a'+k, i, err)
+				}
+				side.buf = data
+				side.pending = append(side.pending, data...)
+			}
+		}
+
+		if blocks[0] != nil {
+			c.BlocksA++
+		}
+		if blocks[1] != nil {
+			c.BlocksB++
+		}
+		if c.DivergentBlock < 0 && (blocks[0] != nil || blocks[1] != nil) && !sameBlock(blocks[0], blocks[1]) {
+			c.DivergentBlock = i
+			if blocks[0] != nil {
+				c.OffsetA = blocks[0].Offset
+			}
+			if blocks[1] != nil {
+				c.OffsetB = blocks[1].Offset
+			}
+		}
+
+		if c.ContentEqual {
+			pa, pb := sides[0].pending, sides[1].pending
+			n := min(len(pa), len(pb))
+			for j := 0; j < n; j++ {
+				if pa[j] != pb[j] {
+					c.ContentEqual = false
+					c.ContentDiffOffset = compared + int64(j)
+					break
+				}
+			}
+			compared += int64(n)
+			sides[0].pending = append(pa[:0], pa[n:]...)
+			sides[1].pending = append(pb[:0], pb[n:]...)
+		}
+	}
+
+	if c.ContentEqual && len(sides[0].pending) != len(sides[1].pending) {
+		c.ContentEqual = false
+		c.ContentDiffOffset = compared
+	}
+	return c, nil
+}
+
+func sameBlock(a, b *scannedBlock) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return a.Uncompressed == b.Uncompressed && bytes.Equal(a.Data, b.Data)
+}
@@ -0,0 +1,94 @@
+package lz4
+
+import (
+	"math"
+	"math/bits"
+)
+
+// The options in this file have the names, types and values of those of
+// github.com/pierrec/lz4/v4, so code written against that package can
+// switch to this one by changing its import path. Each maps onto the
+// corresponding With option.
+
+// BlockSize is a block size of the frame format.
+type BlockSize uint32
+
+const (
+	Block64Kb BlockSize = 1 << (16 + iota*2)
+	Block256Kb
+	Block1Mb
+	Block4Mb
+)
+
+// CompressionLevel selects a compression level; Fast is the default.
+type CompressionLevel uint32
+
+const (
+	Fast   CompressionLevel = 0
+	Level1 CompressionLevel = 1 << (8 + iota)
+	Level2
+	Level3
+	Level4
+	Level5
+	Level6
+	Level7
+	Level8
+	Level9
+)
+
+// BlockSizeOption is WithBlockSize(int(size)).
+func BlockSizeOption(size BlockSize) Option {
+	return WithBlockSize(int(size))
+}
+
+// BlockChecksumOption turns block checksums on or off, like
+// WithBlockChecksum.
+func BlockChecksumOption(flag bool) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			w.blockChecksum = flag
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// ChecksumOption turns the content checksum on or off, like
+// WithContentChecksum. Unlike pierrec/lz4, the checksum is off by default.
+func ChecksumOption(flag bool) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			w.contentChecksum = flag
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// SizeOption is WithContentSize(int64(size)).
+func SizeOption(size uint64) Option {
+	if size > math.MaxInt64 {
+		return func(applier) error { return ErrInvalidContentSize }
+	}
+	return WithContentSize(int64(size))
+}
+
+// ConcurrencyOption is WithConcurrency(n).
+func ConcurrencyOption(n int) Option {
+	return WithConcurrency(n)
+}
+
+// CompressionLevelOption selects level n of WithLevel for LevelN, and the
+// default level for Fast.
+func CompressionLevelOption(level CompressionLevel) Option {
+	n := bits.Len32(uint32(level)) - 9
+	if level == Fast {
+		n = defaultLevel
+	}
+	if level&(level-1) != 0 || n < defaultLevel || n > 9 {
+		return func(applier) error { return ErrInvalidLevel }
+	}
+	return WithLevel(n)
+}
@@ -0,0 +1,72 @@
+package lz4_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	lz4 "rzstd/src"
+
+	lz4lib "github.com/pierrec/lz4/v4"
+)
+
+func TestCompatOptions(t *testing.T) {
+	data := testInput(300 << 10)
+	equivalent := []struct {
+		name        string
+		compat, own []lz4.Option
+	}{
+		{"block size", []lz4.Option{lz4.BlockSizeOption(lz4.Block256Kb)}, []lz4.Option{lz4.WithBlockSize(256 << 10)}},
+		{"block checksum", []lz4.Option{lz4.BlockChecksumOption(true)}, []lz4.Option{lz4.WithBlockChecksum()}},
+		{"checksum", []lz4.Option{lz4.ChecksumOption(true)}, []lz4.Option{lz4.WithContentChecksum()}},
+		{"checksum off", []lz4.Option{lz4.ChecksumOption(true), lz4.ChecksumOption(false)}, nil},
+		{"size", []lz4.Option{lz4.SizeOption(uint64(len(data)))}, []lz4.Option{lz4.WithContentSize(int64(len(data)))}},
+		{"fast", []lz4.Option{lz4.CompressionLevelOption(lz4.Fast)}, nil},
+		{"level 1", []lz4.Option{lz4.CompressionLevelOption(lz4.Level1)}, []lz4.Option{lz4.WithLevel(1)}},
+		{"level 9", []lz4.Option{lz4.CompressionLevelOption(lz4.Level9)}, []lz4.Option{lz4.WithLevel(9)}},
+		{"concurrency", []lz4.Option{lz4.ConcurrencyOption(4)}, nil},
+	}
+	for _, e := range equivalent {
+		got := compress(t, data, e.compat...)
+		if want := compress(t, data, e.own...); !bytes.Equal(got, want) {
+			t.Errorf("%s: output differs from the equivalent With option", e.name)
+		}
+		// The options mean the same to pierrec/lz4, which reads the result
+		if out, err := io.ReadAll(lz4lib.NewReader(bytes.NewReader(got))); err != nil || !bytes.Equal(out, data) {
+			t.Errorf("%s: pierrec/lz4 read %d bytes, %v", e.name, len(out), err)
+		}
+	}
+
+	invalid := map[string]lz4.Option{
+		"two levels": lz4.CompressionLevelOption(lz4.Level1 | lz4.Level2),
+		"level 10":   lz4.CompressionLevelOption(lz4.Level9 << 1),
+		"block size": lz4.BlockSizeOption(1000),
+		"size":       lz4.SizeOption(1 << 63),
+	}
+	for name, option := range invalid {
+		if err := lz4.NewWriter(io.Discard).Apply(option); err == nil || errors.Is(err, lz4.ErrOptionNotApplicable) {
+			t.Errorf("%s: Apply = %v, want a validation error", name, err)
+		}
+	}
+}
+
+// TestPierrecStream decodes a stream pierrec/lz4 wrote with the same
+// options.
+func TestPierrecStream(t *testing.T) {
+	data := testInput(300 << 10)
+	var buf bytes.Buffer
+	w := lz4lib.NewWriter(&buf)
+	if err := w.Apply(lz4lib.BlockSizeOption(lz4lib.Block64Kb), lz4lib.BlockChecksumOption(true), lz4lib.ChecksumOption(true)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := decompress(t, buf.Bytes()); !bytes.Equal(got, data) {
+		t.Fatal("stream of pierrec/lz4 does not decode to its input")
+	}
+}
@@ -0,0 +1,55 @@
+package lz4
+
+// Compressor compresses blocks and frames held in memory. It owns its hash
+// table and scratch buffers and reuses them from call to call, so a server
+// can keep one per goroutine, or in a sync.Pool, instead of setting up a
+// Writer for every message. A Compressor is not safe for concurrent use.
+type Compressor struct {
+	w   *Writer
+	out appendBuffer
+}
+
+// appendBuffer is an io.Writer that appends to a slice.
+type appendBuffer []byte
+
+func (b *appendBuffer) Write(p []byte) (int, error) {
+	*b = append(*b, p...)
+	return len(p), nil
+}
+
+// NewCompressor returns a Compressor configured with Writer options. The
+// options that wrap the destination, WithTee and WithDstWrapper, have
+// nothing to wrap and are dropped.
+func NewCompressor(options ...Option) (*Compressor, error) {
+	c := &Compressor{}
+	c.w = NewWriter(&c.out)
+	if err := c.w.Apply(options...); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// CompressBlock is CompressBlock at the level and match search options of
+// c. The block is compressed on its own, without the dictionary of
+// WithDictionary, so DecompressBlock can decode it.
+func (c *Compressor) CompressBlock(src, dst []byte) (int, error) {
+	n, _, err := compressAfter(src, nil, dst, c.w.hashTable, nil, c.w.blockParams())
+	return n, err
+}
+
+// CompressFrame compresses src as a complete frame, or as many as the
+// options ask for, and appends it to dst, returning the extended slice.
+// dst can be a buffer of an earlier call truncated to length zero.
+func (c *Compressor) CompressFrame(src, dst []byte) ([]byte, error) {
+	c.out = dst
+	c.w.Reset(&c.out)
+	defer func() { c.out = nil }()
+	if _, err := c.w.Write(src); err != nil {
+		c.w.Abort()
+		return dst, err
+	}
+	if err := c.w.Close(); err != nil {
+		return dst, err
+	}
+	return c.out, nil
+}
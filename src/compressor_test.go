@@ -0,0 +1,52 @@
+package lz4_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	lz4 "rzstd/src"
+)
+
+// TestCompressor reuses one Compressor for frames and blocks of different
+// sizes. Each result must match that of a fresh Writer or CompressBlock.
+func TestCompressor(t *testing.T) {
+	options := []lz4.Option{lz4.WithBlockSize(64 << 10), lz4.WithContentChecksum()}
+	c, err := lz4.NewCompressor(options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frame []byte
+	for _, n := range []int{300 << 10, 10, 0, 100 << 10} {
+		data := testInput(n)
+		frame, err = c.CompressFrame(data, frame[:0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := compress(t, data, options...); !bytes.Equal(frame, want) {
+			t.Errorf("%d bytes: CompressFrame differs from a Writer", n)
+		}
+
+		dst := make([]byte, lz4.CompressBlockBound(n))
+		m, err := c.CompressBlock(data, dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := make([]byte, len(dst))
+		k, _ := lz4.CompressBlock(data, want)
+		if !bytes.Equal(dst[:m], want[:k]) {
+			t.Errorf("%d bytes: Compressor.CompressBlock differs from CompressBlock", n)
+		}
+	}
+
+	// CompressFrame appends to what dst holds
+	prefix := []byte("prefix")
+	out, err := c.CompressFrame(testInput(1000), prefix)
+	if err != nil || !bytes.HasPrefix(out, prefix) {
+		t.Errorf("CompressFrame did not append to dst: %v", err)
+	}
+
+	if _, err := lz4.NewCompressor(lz4.WithLevel(20)); !errors.Is(err, lz4.ErrInvalidLevel) {
+		t.Errorf("NewCompressor with a bad option = %v, want %v", err, lz4.ErrInvalidLevel)
+	}
+}
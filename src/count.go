@@ -0,0 +1,95 @@
+package lz4
+
+import "io"
+
+// CountingWriter counts the bytes written through it to an underlying
+// writer. A Writer given one as its destination also records in it the
+// sizes of each block it writes.
+type CountingWriter struct {
+	w    io.Writer
+	n    int64
+	next *CountingWriter
+	// Sizes of the last block, stored and decompressed
+	compressed, uncompressed int
+}
+
+func NewCountingWriter(w io.Writer) *CountingWriter {
+	next, _ := w.(*CountingWriter)
+	return &CountingWriter{w: w, next: next}
+}
+
+// Write passes p to the underlying writer. A writer that takes only part of
+// p without an error, against the io.Writer contract, is given the rest for
+// as long as it makes progress; one that takes nothing fails with
+// io.ErrShortWrite.
+func (c *CountingWriter) Write(p []byte) (int, error) {
+	n := 0
+	for {
+		m, err := c.w.Write(p[n:])
+		n += m
+		if err == nil && n < len(p) && m == 0 {
+			err = io.ErrShortWrite
+		}
+		if err != nil || n == len(p) {
+			c.n += int64(n)
+			return n, err
+		}
+	}
+}
+
+// Count returns the total number of bytes written.
+func (c *CountingWriter) Count() int64 { return c.n }
+
+// LastBlock returns the size of the payload of the last block a Writer
+// wrote through c, as stored and before compression, or zeros before the
+// first block. The size field and checksum of the block are not included,
+// as in Writer.Stats.
+func (c *CountingWriter) LastBlock() (compressed, uncompressed int) {
+	return c.compressed, c.uncompressed
+}
+
+// countBlock records the sizes of a block written through c.
+func (c *CountingWriter) countBlock(compressed, uncompressed int) {
+	for ; c != nil; c = c.next {
+		c.compressed, c.uncompressed = compressed, uncompressed
+	}
+}
+
+// CountingReader counts the bytes read through it from an underlying
+// reader. A Reader given one as its source also records in it the sizes of
+// each block it returns.
+type CountingReader struct {
+	r    io.Reader
+	n    int64
+	next *CountingReader
+	// Sizes of the last block, stored and decompressed
+	compressed, uncompressed int
+}
+
+func NewCountingReader(r io.Reader) *CountingReader {
+	next, _ := r.(*CountingReader)
+	return &CountingReader{r: r, next: next}
+}
+
+func (c *CountingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Count returns the total number of bytes read.
+func (c *CountingReader) Count() int64 { return c.n }
+
+// LastBlock returns the size of the payload of the last block a Reader
+// decoded from c, as stored and decompressed, or zeros before the first
+// block. A Reader decoding in parallel reads ahead of the block it returns.
+func (c *CountingReader) LastBlock() (compressed, uncompressed int) {
+	return c.compressed, c.uncompressed
+}
+
+// countBlock records the sizes of a block read through c.
+func (c *CountingReader) countBlock(compressed, uncompressed int) {
+	for ; c != nil; c = c.next {
+		c.compressed, c.uncompressed = compressed, uncompressed
+	}
+}
@@ -0,0 +1,85 @@
+package lz4_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	lz4 "rzstd/src"
+)
+
+// TestCountingLastBlock writes blocks that compress differently, one of
+// them stored raw, and checks that the counters given to a Writer and a
+// Reader report the sizes of each block as Inspect finds them.
+func TestCountingLastBlock(t *testing.T) {
+	random := make([]byte, 20000)
+	rand.New(rand.NewSource(1)).Read(random)
+	chunks := [][]byte{testInput(30000), random, bytes.Repeat([]byte{'a'}, 5000)}
+
+	var buf bytes.Buffer
+	cw := lz4.NewCountingWriter(&buf)
+	w := lz4.NewWriter(cw)
+	if err := w.Apply(lz4.WithBlockChecksum()); err != nil {
+		t.Fatal(err)
+	}
+	if c, u := cw.LastBlock(); c != 0 || u != 0 {
+		t.Errorf("LastBlock before the first block = %d, %d", c, u)
+	}
+	var written [][2]int
+	for _, chunk := range chunks {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		c, u := cw.LastBlock()
+		written = append(written, [2]int{c, u})
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	frames, err := lz4.Inspect(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := frames[0].Blocks
+	if len(blocks) != len(chunks) {
+		t.Fatalf("got %d blocks, want %d", len(blocks), len(chunks))
+	}
+	if !blocks[1].Uncompressed {
+		t.Error("random block was not stored raw")
+	}
+	for i, b := range blocks {
+		want := [2]int{b.CompressedSize, len(chunks[i])}
+		if written[i] != want {
+			t.Errorf("Writer block %d: LastBlock = %v, want %v", i, written[i], want)
+		}
+	}
+
+	// A parallel Reader reads ahead, but reports the block it returns
+	for _, concurrency := range []int{1, 4} {
+		cr := lz4.NewCountingReader(bytes.NewReader(buf.Bytes()))
+		r := lz4.NewReader(cr)
+		if err := r.Apply(lz4.WithConcurrency(concurrency)); err != nil {
+			t.Fatal(err)
+		}
+		p := make([]byte, 64<<10)
+		for i, b := range blocks {
+			// A Read returns at most one block
+			n, err := io.ReadFull(r, p[:b.UncompressedSize])
+			if err != nil {
+				t.Fatalf("concurrency %d, block %d: %v", concurrency, i, err)
+			}
+			if !bytes.Equal(p[:n], chunks[i]) {
+				t.Fatalf("concurrency %d: block %d does not match its input", concurrency, i)
+			}
+			want := [2]int{b.CompressedSize, b.UncompressedSize}
+			if c, u := cr.LastBlock(); [2]int{c, u} != want {
+				t.Errorf("concurrency %d: Reader block %d: LastBlock = %d, %d, want %v", concurrency, i, c, u, want)
+			}
+		}
+	}
+}
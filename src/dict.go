@@ -0,0 +1,183 @@
+package lz4
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// maxDictSize is the window of a dictionary that matches can reach.
+const maxDictSize = 64 << 10
+
+var ErrDictionaryRequired = errors.New("frame requires a dictionary")
+
+// WithDictionary makes a Writer compress against dict, declaring id in its
+// frame headers so that readers can find the same dictionary, and makes a
+// Reader use dict for frames that name id. Only the last 64KB of dict can be
+// referenced. dict must not be modified while in use.
+func WithDictionary(id uint32, dict []byte) Option {
+	if len(dict) > maxDictSize {
+		dict = dict[len(dict)-maxDictSize:]
+	}
+	return func(a applier) error {
+		switch rw := a.(type) {
+		case *Writer:
+			rw.dict, rw.dictID = dict, id
+			return nil
+		case *Reader:
+			rw.resolver = func(got uint32) ([]byte, error) {
+				if got != id {
+					return nil, ErrDictionaryRequired
+				}
+				return dict, nil
+			}
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// WithDictionaryResolver makes a Reader look up the dictionary of every
+// frame that names one by its ID. A DictionaryCache avoids fetching the
+// same dictionary for every frame or Reader.
+func WithDictionaryResolver(resolve func(id uint32) ([]byte, error)) Option {
+	return func(a applier) error {
+		switch r := a.(type) {
+		case *Reader:
+			r.resolver = resolve
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// loadDictionary resolves the dictionary named by header, if any.
+func (r *Reader) loadDictionary(header *DecodedFrameHeader) error {
+	r.dict = nil
+	if !header.DictIDFlag {
+		return nil
+	}
+	dict, err := resolveDictionary(r.resolver, header.DictID)
+	if err != nil {
+		return err
+	}
+	r.dict = dict
+	return nil
+}
+
+// resolveDictionary returns the part of dictionary id that matches can
+// reference, as resolve finds it.
+func resolveDictionary(resolve func(id uint32) ([]byte, error), id uint32) ([]byte, error) {
+	if resolve == nil {
+		return nil, fmt.Errorf("%w: ID %d", ErrDictionaryRequired, id)
+	}
+	dict, err := resolve(id)
+	if err != nil {
+		return nil, fmt.Errorf("dictionary %d: %w", id, err)
+	}
+	if len(dict) > maxDictSize {
+		dict = dict[len(dict)-maxDictSize:]
+	}
+	return dict, nil
+}
+
+// compress compresses src into dst as a block that may reference the
+// dictionary of w, if any, and with linked blocks the previous blocks of
+// the frame.
+func (w *Writer) compress(src, dst []byte) (int, error) {
+	history := w.dict
+	if w.linked && w.blocksInFrame > 0 {
+		history = w.history
+	}
+	if w.linked {
+		defer func() { w.history = slideWindow(w.history, history, src) }()
+	}
+	if w.storeRaw() {
+		// emitBlock stores src as is when it does not shrink
+		return len(src), nil
+	}
+	n, window, err := compressAfter(src, history, dst, w.hashTable, w.window, w.blockParams())
+	w.window = window
+	return n, err
+}
+
+// compressAfter compresses src into dst as a block that may reference
+// history. The two are joined in window, which is returned grown as
+// needed.
+func compressAfter(src, history, dst []byte, hashTable *matchTable, window []byte, params compressParams) (int, []byte, error) {
+	buf := src
+	if len(history) > 0 {
+		window = append(append(window[:0], history...), src...)
+		buf = window
+	}
+	var n int
+	var err error
+	if params.searchDepth > 0 {
+		n, err = compressBlockHC(buf, len(history), dst, hashTable, params)
+	} else {
+		n, err = compressBlockPrefix(buf, len(history), dst, hashTable, params)
+	}
+	return n, window, err
+}
+
+// DictionaryCache keeps the most recently used dictionaries, fetching the
+// others with a resolve function. It is safe for concurrent use, so Readers
+// of many streams can share one; pass its Get method to
+// WithDictionaryResolver.
+type DictionaryCache struct {
+	resolve  func(id uint32) ([]byte, error)
+	capacity int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[uint32]*list.Element
+}
+
+type dictEntry struct {
+	id   uint32
+	dict []byte
+}
+
+// NewDictionaryCache returns a cache holding up to capacity dictionaries.
+func NewDictionaryCache(capacity int, resolve func(id uint32) ([]byte, error)) *DictionaryCache {
+	return &DictionaryCache{
+		resolve:  resolve,
+		capacity: max(capacity, 1),
+		order:    list.New(),
+		entries:  make(map[uint32]*list.Element),
+	}
+}
+
+// Get returns the dictionary with the given ID, resolving it on a miss and
+// evicting the least recently used one when the cache is full. Failed
+// lookups are not cached.
+func (c *DictionaryCache) Get(id uint32) ([]byte, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[id]; ok {
+		c.order.MoveToFront(e)
+		c.mu.Unlock()
+		return e.Value.(*dictEntry).dict, nil
+	}
+	c.mu.Unlock()
+
+	// Resolve without the lock so a slow fetch does not block hits
+	dict, err := c.resolve(id)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[id]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*dictEntry).dict, nil
+	}
+	c.entries[id] = c.order.PushFront(&dictEntry{id: id, dict: dict})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*dictEntry).id)
+	}
+	return dict, nil
+}
@@ -0,0 +1,49 @@
+package lz4_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	lz4 "rzstd/src"
+)
+
+func TestDictionary(t *testing.T) {
+	dict := make([]byte, 32<<10)
+	rand.New(rand.NewSource(1)).Read(dict)
+	// An input that only compresses against the dictionary
+	data := append(bytes.Clone(dict[1000:3000]), dict[20000:21000]...)
+	const id = 42
+
+	frame := compress(t, data, lz4.WithDictionary(id, dict))
+	header, err := lz4.ReadFrameHeader(bytes.NewReader(frame))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !header.DictIDFlag || header.DictID != id {
+		t.Errorf("header DictID = %v, %d, want %d", header.DictIDFlag, header.DictID, id)
+	}
+	if plain := compress(t, data); len(frame) >= len(plain)/2 {
+		t.Errorf("frame is %d bytes with the dictionary and %d without", len(frame), len(plain))
+	}
+	if got := decompress(t, frame, lz4.WithDictionary(id, dict)); !bytes.Equal(got, data) {
+		t.Fatal("round trip does not match the input")
+	}
+
+	// Without the dictionary, or with the one of another ID, the frame
+	// cannot be decoded
+	for name, options := range map[string][]lz4.Option{
+		"no dictionary": nil,
+		"other ID":      {lz4.WithDictionary(id+1, dict)},
+	} {
+		r := lz4.NewReader(bytes.NewReader(frame))
+		if err := r.Apply(options...); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadAll(r); !errors.Is(err, lz4.ErrDictionaryRequired) {
+			t.Errorf("%s: Read = %v, want %v", name, err, lz4.ErrDictionaryRequired)
+		}
+	}
+}
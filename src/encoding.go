@@ -0,0 +1,201 @@
+package lz4
+
+import (
+	"bufio"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// The encoders and decoders below keep their block buffers and hash tables
+// in pools, so a service writing many small snapshots does not allocate
+// megabytes for each of them.
+
+var (
+	encodingBuffers = &recycledPool{}
+	encoderStates   = sync.Pool{New: func() any {
+		return &encoderState{
+			bw:    bufio.NewWriterSize(nil, defaultBlockSize),
+			table: newMatchTable(hashSize),
+		}
+	}}
+)
+
+// recycledPool is a BufferPool backed by a sync.Pool.
+type recycledPool struct {
+	pool sync.Pool
+}
+
+func (p *recycledPool) Get(size int) []byte {
+	if buf, ok := p.pool.Get().(*[]byte); ok && cap(*buf) >= size {
+		return (*buf)[:size]
+	}
+	return make([]byte, size)
+}
+
+func (p *recycledPool) Put(buf []byte) {
+	p.pool.Put(&buf)
+}
+
+// encoderState is what a pooledWriter recycles: the buffer that gathers
+// small encoder writes into whole blocks, and the hash table.
+type encoderState struct {
+	bw    *bufio.Writer
+	table *matchTable
+}
+
+// pooledWriter is a Writer fed through a block-sized buffer, whose state
+// goes back to the pool on Close.
+type pooledWriter struct {
+	state *encoderState
+	w     *Writer
+}
+
+func newPooledWriter(dst io.Writer) *pooledWriter {
+	s := encoderStates.Get().(*encoderState)
+	w := newWriter(dst, s.table)
+	w.buffers = encodingBuffers
+	s.bw.Reset(w)
+	return &pooledWriter{state: s, w: w}
+}
+
+func (p *pooledWriter) Write(b []byte) (int, error) {
+	if p.state == nil {
+		return 0, ErrClosed
+	}
+	return p.state.bw.Write(b)
+}
+
+// Flush compresses what is buffered and makes everything written so far
+// decodable by the peer.
+func (p *pooledWriter) Flush() error {
+	if p.state == nil {
+		return ErrClosed
+	}
+	if err := p.state.bw.Flush(); err != nil {
+		return err
+	}
+	return p.w.Flush()
+}
+
+// Close completes the stream, without closing the underlying writer, and
+// recycles the state. Later calls return nil.
+func (p *pooledWriter) Close() error {
+	if p.state == nil {
+		return nil
+	}
+	err := p.state.bw.Flush()
+	if err == nil {
+		err = p.w.Close()
+	} else {
+		p.w.CloseWithError(err)
+	}
+	p.state.bw.Reset(nil)
+	encoderStates.Put(p.state)
+	p.state, p.w = nil, nil
+	return err
+}
+
+// pooledReader is a Reader whose buffers go back to the pool on Close.
+type pooledReader struct {
+	r *Reader
+}
+
+func newPooledReader(src io.Reader) *pooledReader {
+	r := NewReader(src)
+	r.buffers = encodingBuffers
+	return &pooledReader{r: r}
+}
+
+func (p *pooledReader) Read(b []byte) (int, error) {
+	if p.r == nil {
+		return 0, ErrClosed
+	}
+	return p.r.Read(b)
+}
+
+// ReadByte keeps gob from wrapping the Reader in a bufio.Reader, which
+// would read past the stream.
+func (p *pooledReader) ReadByte() (byte, error) {
+	if p.r == nil {
+		return 0, ErrClosed
+	}
+	return p.r.ReadByte()
+}
+
+// Close verifies the rest of the stream like Reader.Close and recycles the
+// buffers. Later calls return nil.
+func (p *pooledReader) Close() error {
+	if p.r == nil {
+		return nil
+	}
+	err := p.r.Close()
+	p.r = nil
+	return err
+}
+
+// GobEncoder is a gob.Encoder whose output is compressed. Values are
+// gathered into whole blocks, so Flush must be called for a peer to see
+// them before Close, which must be called to complete the stream.
+type GobEncoder struct {
+	*gob.Encoder
+	w *pooledWriter
+}
+
+func NewGobEncoder(w io.Writer) *GobEncoder {
+	pw := newPooledWriter(w)
+	return &GobEncoder{Encoder: gob.NewEncoder(pw), w: pw}
+}
+
+func (e *GobEncoder) Flush() error { return e.w.Flush() }
+
+// Close completes the stream without closing the underlying writer.
+func (e *GobEncoder) Close() error { return e.w.Close() }
+
+// GobDecoder is a gob.Decoder for the output of a GobEncoder.
+type GobDecoder struct {
+	*gob.Decoder
+	r *pooledReader
+}
+
+func NewGobDecoder(r io.Reader) *GobDecoder {
+	pr := newPooledReader(r)
+	return &GobDecoder{Decoder: gob.NewDecoder(pr), r: pr}
+}
+
+// Close reads and verifies the rest of the stream and releases the
+// decoder's buffers. It does not close the underlying reader.
+func (d *GobDecoder) Close() error { return d.r.Close() }
+
+// JSONEncoder is a json.Encoder whose output is compressed, with the same
+// Flush and Close rules as GobEncoder.
+type JSONEncoder struct {
+	*json.Encoder
+	w *pooledWriter
+}
+
+func NewJSONEncoder(w io.Writer) *JSONEncoder {
+	pw := newPooledWriter(w)
+	return &JSONEncoder{Encoder: json.NewEncoder(pw), w: pw}
+}
+
+func (e *JSONEncoder) Flush() error { return e.w.Flush() }
+
+// Close completes the stream without closing the underlying writer.
+func (e *JSONEncoder) Close() error { return e.w.Close() }
+
+// JSONDecoder is a json.Decoder for the output of a JSONEncoder.
+type JSONDecoder struct {
+	*json.Decoder
+	r *pooledReader
+}
+
+func NewJSONDecoder(r io.Reader) *JSONDecoder {
+	pr := newPooledReader(r)
+	return &JSONDecoder{Decoder: json.NewDecoder(pr), r: pr}
+}
+
+// Close reads and verifies the rest of the stream and releases the
+// decoder's buffers. It does not close the underlying reader.
+func (d *JSONDecoder) Close() error { return d.r.Close() }
@@ -0,0 +1,105 @@
+package lz4_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	lz4 "rzstd/src"
+	"rzstd/src/lz4test"
+)
+
+var errFault = errors.New("injected fault")
+
+func TestShortWrites(t *testing.T) {
+	data := testInput(300 << 10)
+	stream := compress(t, data, lz4.WithBlockSize(64<<10), lz4.WithDstWrapper(lz4test.ShortWrites(7)))
+	if got := decompress(t, stream); !bytes.Equal(got, data) {
+		t.Fatal("round trip through short writes does not match the input")
+	}
+}
+
+func TestFailedWriteSticks(t *testing.T) {
+	data := testInput(300 << 10)
+	var buf bytes.Buffer
+	w := lz4.NewWriter(&buf)
+	// The destination fails once and then works again
+	if err := w.Apply(lz4.WithBlockSize(64<<10), lz4.WithDstWrapper(lz4test.FailWrites(1000, errFault, 1))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); !errors.Is(err, errFault) {
+		t.Fatalf("Write = %v, want %v", err, errFault)
+	}
+	if _, err := w.Write(data[:10]); !errors.Is(err, errFault) {
+		t.Errorf("Write after the failure = %v, want %v", err, errFault)
+	}
+	if err := w.Close(); !errors.Is(err, errFault) {
+		t.Errorf("Close after the failure = %v, want %v", err, errFault)
+	}
+}
+
+func TestFailedReadSticks(t *testing.T) {
+	data := testInput(300 << 10)
+	stream := compress(t, data, lz4.WithBlockSize(64<<10))
+	r := lz4.NewReader(bytes.NewReader(stream))
+	if err := r.Apply(lz4.WithSrcWrapper(lz4test.FailReads(int64(len(stream)/2), errFault, 1))); err != nil {
+		t.Fatal(err)
+	}
+
+	var out []byte
+	buf := make([]byte, 4096)
+	var err error
+	for err == nil {
+		var n int
+		n, err = r.Read(buf)
+		out = append(out, buf[:n]...)
+	}
+	if !errors.Is(err, errFault) {
+		t.Fatalf("Read = %v, want %v", err, errFault)
+	}
+	if !bytes.HasPrefix(data, out) {
+		t.Fatal("bytes delivered before the fault do not match the input")
+	}
+	// The source works again, but the Reader lost its place in the frame,
+	// so it must not go on decoding
+	if n, err := r.Read(buf); n != 0 || !errors.Is(err, errFault) {
+		t.Errorf("Read after the fault = %d, %v, want 0, %v", n, err, errFault)
+	}
+}
+
+func TestOneByteReads(t *testing.T) {
+	data := testInput(200 << 10)
+	stream := compress(t, data, lz4.WithBlockSize(64<<10), lz4.WithBlockChecksum(), lz4.WithContentChecksum())
+	if got := decompress(t, stream, lz4.WithSrcWrapper(lz4test.OneByteReads())); !bytes.Equal(got, data) {
+		t.Fatal("round trip through one-byte reads does not match the input")
+	}
+}
+
+func TestEOFMidBlock(t *testing.T) {
+	data := testInput(300 << 10)
+	stream := compress(t, data, lz4.WithBlockSize(64<<10))
+	frames, err := lz4.Inspect(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := frames[0].Blocks[1]
+	cuts := map[string]int64{
+		"in size field":  b.Offset + 2,
+		"in block data":  b.Offset + 4 + int64(b.CompressedSize)/2,
+		"between blocks": b.Offset,
+	}
+	for name, cut := range cuts {
+		r := lz4.NewReader(bytes.NewReader(stream))
+		if err := r.Apply(lz4.WithSrcWrapper(lz4test.EOFAfter(cut))); err != nil {
+			t.Fatal(err)
+		}
+		out, err := io.ReadAll(r)
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%s: Read = %v, want %v", name, err, io.ErrUnexpectedEOF)
+		}
+		if !bytes.HasPrefix(data, out) {
+			t.Errorf("%s: bytes delivered before the end do not match the input", name)
+		}
+	}
+}
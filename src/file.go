@@ -0,0 +1,117 @@
+package lz4
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// CompressFile compresses the file src into dst with the given Writer
+// options. dst is written in whole blocks, synced to disk and given the
+// permissions and modification time of src. On error the partial dst is
+// removed.
+func CompressFile(src, dst string, options ...Option) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	w := NewWriter(out)
+	err = w.Apply(options...)
+	if err == nil {
+		_, err = w.ReadFrom(in)
+		if err != nil {
+			w.Abort()
+		}
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	return finishFile(out, fi, err)
+}
+
+// DecompressFile decompresses the file src into dst with the given Reader
+// options, preallocating dst like DecompressStream. dst is synced to disk
+// and given the permissions and modification time of src. On error the partial dst is removed.
+func DecompressFile(src, dst string, options ...Option) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	r := NewReader(in)
+	err = r.Apply(options...)
+	if err == nil {
+		err = copyDecompressed(r, out)
+	}
+	return finishFile(out, fi, err)
+}
+
+// copyDecompressed copies the output of r to dst. When dst is an *os.File
+// and the frame declares its content size, the file is preallocated before
+// the first write, so that it is laid out contiguously and a disk too small
+// for the output fails right away.
+func copyDecompressed(r *Reader, dst io.Writer) error {
+	start, size := int64(0), int64(-1)
+	if f, ok := dst.(*os.File); ok {
+		// An error reading the header is returned again by WriteTo
+		n, _ := r.Size()
+		// Pipes and terminals cannot seek and are not preallocated
+		if pos, err := f.Seek(0, io.SeekCurrent); err == nil && n > 0 {
+			start, size = pos, n
+			if err := preallocate(f, start+size); err != nil {
+				return err
+			}
+		}
+	}
+	written, err := r.WriteTo(dst)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && written < size {
+		// The frame was shorter than it declared
+		return dst.(*os.File).Truncate(start + written)
+	}
+	return nil
+}
+
+// finishFile syncs and closes out, the result of an operation on the file
+// described by fi that ended with err, and gives it the permissions and
+// modification time of that file. If anything failed, out is removed.
+func finishFile(out *os.File, fi os.FileInfo, err error) error {
+	if err == nil {
+		err = out.Sync()
+	}
+	if err == nil {
+		// The permissions given at creation are subject to the umask
+		err = out.Chmod(fi.Mode().Perm())
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chtimes(out.Name(), time.Time{}, fi.ModTime())
+	}
+	if err != nil {
+		os.Remove(out.Name())
+	}
+	return err
+}
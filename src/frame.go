@@ -13,14 +13,58 @@ const (
 	endMark = 0x00000000
 	flgByte = 0b01100000
 	bdType  = 0b01110000
+
+	skippableMagic     = 0x184D2A50
+	skippableMagicMask = 0xFFFFFFF0
 )
 
 func WriteFrameHeader(w io.Writer) error {
-	frameHeader := make([]byte, 7)
+	return writeFrameHeader(w, flgByte, bdType, 0, 0)
+}
+
+// blockSizeCodes maps the block maximum sizes of the format to their
+// selectors in the BD byte.
+var blockSizeCodes = map[int]byte{64 << 10: 4, 256 << 10: 5, 1 << 20: 6, 4 << 20: 7}
+
+// WithBlockSize makes a Writer cut its input into blocks of size bytes and
+// declare that maximum in its frame headers. size must be one of the sizes
+// of the format: 64KB, 256KB, 1MB or 4MB, the default. Smaller blocks need
+// less memory on both ends and let a reader start sooner, at some cost in
+// ratio.
+func WithBlockSize(size int) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			if _, ok := blockSizeCodes[size]; !ok {
+				return ErrInvalidBlockSize
+			}
+			w.blockSize = size
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// blockDescriptor returns the BD byte of the frames w writes.
+func (w *Writer) blockDescriptor() byte {
+	return blockSizeCodes[w.blockSize] << 4
+}
+
+// writeFrameHeader writes a frame header with the FLG byte flg and the BD
+// byte bd, followed by contentSize and dictID if flg has the content size
+// and dictionary ID flags.
+func writeFrameHeader(w io.Writer, flg, bd byte, contentSize uint64, dictID uint32) error {
+	frameHeader := make([]byte, 6, 19)
 	binary.LittleEndian.PutUint32(frameHeader[:4], magic)
-	frameHeader[4] = flgByte
-	frameHeader[5] = bdType
-	frameHeader[6] = getHeaderChecksum(frameHeader[4:6])
+	frameHeader[4] = flg
+	frameHeader[5] = bd
+	if flg&0x08 != 0 {
+		frameHeader = binary.LittleEndian.AppendUint64(frameHeader, contentSize)
+	}
+	if flg&0x01 != 0 {
+		frameHeader = binary.LittleEndian.AppendUint32(frameHeader, dictID)
+	}
+	frameHeader = append(frameHeader, getHeaderChecksum(frameHeader[4:]))
 	if _, err := w.Write(frameHeader); err != nil {
 		return err
 	}
@@ -36,6 +80,36 @@ func WriteFrameEndMark(w io.Writer) error {
 	return nil
 }
 
+func writeSkippableFrame(w io.Writer, nibble byte, payload []byte) error {
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint32(header[:4], skippableMagic|uint32(nibble&0x0F))
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(payload)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(payload); err != nil {
+		return err
+	}
+	return nil
+}
+
+func isSkippableMagic(m uint32) bool {
+	return m&skippableMagicMask == skippableMagic
+}
+
+// skipSkippable discards the size and payload of a skippable frame whose
+// magic number was just read.
+func (r *Reader) skipSkippable() error {
+	size, err := r.readUint32()
+	if err != nil {
+		return noEOF(err)
+	}
+	if _, err := io.CopyN(io.Discard, r.src, int64(size)); err != nil {
+		return noEOF(err)
+	}
+	return nil
+}
+
 func getHeaderChecksum(frameHeader []byte) byte {
 	x := xxHash32.New(0)
 	x.Write(frameHeader)
@@ -55,16 +129,47 @@ type DecodedFrameHeader struct {
 	BlockMaxSize          uint32
 }
 
+var (
+	ErrHeaderChecksum   = errors.New("frame header checksum mismatch")
+	ErrInvalidVersion   = errors.New("lz4: invalid version")
+	ErrInvalidBlockSize = errors.New("lz4: invalid block maximum size")
+)
+
+// ReadFrameHeader reads and verifies a frame header, including the optional
+// content size and dictionary ID fields. A frame of the legacy format has
+// just a magic number, 0x184C2102, which is returned in Magic with
+// independent blocks of up to 8MB and no flags.
 func ReadFrameHeader(r io.Reader) (*DecodedFrameHeader, error) {
+	header, checksumOK, err := readFrameHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if !checksumOK {
+		return nil, ErrHeaderChecksum
+	}
+	return header, nil
+}
 
-	header := make([]byte, 7)
+// readFrameHeader parses a frame header and reports whether its checksum,
+// which follows the optional fields, matches the frame descriptor.
+func readFrameHeader(r io.Reader) (*DecodedFrameHeader, bool, error) {
+	// Magic, FLG and BD, then up to 12 bytes of optional fields
+	header := make([]byte, 4, 18)
 	if _, err := io.ReadFull(r, header); err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	magicNum := binary.LittleEndian.Uint32(header[:4])
+	if magicNum == legacyMagic {
+		// The blocks follow the magic number right away
+		return &DecodedFrameHeader{Magic: legacyMagic, BlocksIndependentFlag: true, BlockMaxSize: legacyBlockSize}, true, nil
+	}
 	if magicNum != magic {
-		return nil, ErrCorrupted
+		return nil, false, ErrCorrupted
+	}
+	header = header[:6]
+	if _, err := io.ReadFull(r, header[4:]); err != nil {
+		return nil, false, noEOF(err)
 	}
 
 	flgByte := header[4]
@@ -72,7 +177,7 @@ func ReadFrameHeader(r io.Reader) (*DecodedFrameHeader, error) {
 
 	version := (flgByte >> 6) & 0x03
 	if version != 1 {
-		return nil, errors.New("lz4: invalid version")
+		return nil, false, ErrInvalidVersion
 	}
 
 	blocksIndependentFlag := (flgByte & 0x20) != 0
@@ -93,7 +198,7 @@ func ReadFrameHeader(r io.Reader) (*DecodedFrameHeader, error) {
 	case 7:
 		blockMaxSize = 4 << 20
 	default:
-		return nil, errors.New("lz4: invalid block maximum size")
+		return nil, false, ErrInvalidBlockSize
 	}
 
 	result := &DecodedFrameHeader{
@@ -108,20 +213,26 @@ func ReadFrameHeader(r io.Reader) (*DecodedFrameHeader, error) {
 	}
 
 	if contentSizeFlag {
-		contentSizeBytes := make([]byte, 8)
+		contentSizeBytes := header[len(header) : len(header)+8]
 		if _, err := io.ReadFull(r, contentSizeBytes); err != nil {
-			return nil, err
+			return nil, false, noEOF(err)
 		}
 		result.ContentSize = binary.LittleEndian.Uint64(contentSizeBytes)
+		header = header[:len(header)+8]
 	}
 
 	if dictIDFlag {
-		dictIDBytes := make([]byte, 4)
+		dictIDBytes := header[len(header) : len(header)+4]
 		if _, err := io.ReadFull(r, dictIDBytes); err != nil {
-			return nil, err
+			return nil, false, noEOF(err)
 		}
 		result.DictID = binary.LittleEndian.Uint32(dictIDBytes)
+		header = header[:len(header)+4]
 	}
 
-	return result, nil
+	var hc [1]byte
+	if _, err := io.ReadFull(r, hc[:]); err != nil {
+		return nil, false, noEOF(err)
+	}
+	return result, hc[0] == getHeaderChecksum(header[4:]), nil
 }
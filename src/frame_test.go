@@ -0,0 +1,80 @@
+package lz4_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	lz4 "rzstd/src"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+// TestBlockMaxSizes decodes frames of every block size one after another,
+// so the Reader's buffers have to grow and then serve smaller blocks.
+func TestBlockMaxSizes(t *testing.T) {
+	var stream, want []byte
+	for i, size := range []int{64 << 10, 4 << 20, 256 << 10, 1 << 20, 64 << 10} {
+		data := testInput(size + 1000*i)
+		stream = append(stream, compress(t, data, lz4.WithBlockSize(size))...)
+		want = append(want, data...)
+	}
+	if got := decompress(t, stream); !bytes.Equal(got, want) {
+		t.Fatal("round trip does not match the input")
+	}
+}
+
+func TestBlockAboveMaxSize(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 20000)
+	frame := compress(t, data, lz4.WithBlockSize(256<<10))
+
+	// A size field above the maximum of the frame
+	tooLarge := bytes.Clone(frame)
+	binary.LittleEndian.PutUint32(tooLarge[7:], 256<<10+1)
+	if _, err := io.ReadAll(lz4.NewReader(bytes.NewReader(tooLarge))); !errors.Is(err, lz4.ErrBlockTooLarge) {
+		t.Errorf("block size above the maximum: Read = %v, want %v", err, lz4.ErrBlockTooLarge)
+	}
+
+	// A block that fits in 64KB but decodes to more, under a header that
+	// declares 64KB blocks
+	overflow := bytes.Clone(frame)
+	overflow[5] = 0x40
+	overflow[6] = byte(xxHash32.Checksum(overflow[4:6], 0) >> 8)
+	if _, err := io.ReadAll(lz4.NewReader(bytes.NewReader(overflow))); !errors.Is(err, lz4.ErrBlockTooLarge) {
+		t.Errorf("block decoding past the maximum: Read = %v, want %v", err, lz4.ErrBlockTooLarge)
+	}
+}
+
+func TestBlockSize(t *testing.T) {
+	data := testInput(9 << 20 / 2)
+	for _, size := range []int{64 << 10, 256 << 10, 1 << 20, 4 << 20} {
+		stream := compress(t, data, lz4.WithBlockSize(size))
+		frames, err := lz4.Inspect(bytes.NewReader(stream))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := frames[0].Header.BlockMaxSize; got != uint32(size) {
+			t.Errorf("%d: header declares %d", size, got)
+		}
+		blocks := frames[0].Blocks
+		if want := (len(data) + size - 1) / size; len(blocks) != want {
+			t.Errorf("%d: got %d blocks, want %d", size, len(blocks), want)
+		}
+		for i, b := range blocks[:len(blocks)-1] {
+			if b.UncompressedSize != size {
+				t.Errorf("%d: block %d holds %d bytes", size, i, b.UncompressedSize)
+			}
+		}
+		if got := decompress(t, stream); !bytes.Equal(got, data) {
+			t.Fatalf("%d: round trip does not match the input", size)
+		}
+	}
+
+	for _, size := range []int{0, 1000, 128 << 10, 8 << 20} {
+		if err := lz4.NewWriter(io.Discard).Apply(lz4.WithBlockSize(size)); !errors.Is(err, lz4.ErrInvalidBlockSize) {
+			t.Errorf("WithBlockSize(%d) = %v, want %v", size, err, lz4.ErrInvalidBlockSize)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package lz4
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// CompressFS compresses every regular file under root in fsys, such as an
+// embed.FS or a zip.Reader, into a single stream on dst, with one section
+// per file named by its slash-separated path relative to root. Files are
+// added in lexical order, so the same tree always gives the same output;
+// OpenSection decompresses any one of them. If root is a file, its section
+// is named by its base name.
+func CompressFS(fsys fs.FS, root string, dst io.Writer, options ...Option) error {
+	w := NewWriter(dst)
+	if err := w.Apply(options...); err != nil {
+		return err
+	}
+	buf := make([]byte, 64*1024)
+	err := fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		section := path.Base(name)
+		if name != root {
+			section = strings.TrimPrefix(name, root+"/")
+			if root == "." {
+				section = name
+			}
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := w.StartSection(section); err != nil {
+			return err
+		}
+		_, err = io.CopyBuffer(w, struct{ io.Reader }{f}, buf)
+		return err
+	})
+	if err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,105 @@
+package lz4
+
+const (
+	maxLevel = 12
+	// chainSize entries follow the hash table in HC mode, one per position
+	// of the window, each holding the distance back to the previous
+	// position with the same hash, or 0
+	chainSize = 1 << 16
+)
+
+// compressBlockHC is compressBlockPrefix for the levels above the default.
+// Every position is linked into a hash chain, and up to params.searchDepth
+// earlier positions with the same hash are tried for the longest match. A
+// match is put off by a byte while the next position has a longer one.
+func compressBlockHC(src []byte, prefix int, dst []byte, hashTable *matchTable, params compressParams) (int, error) {
+	srcLen := len(src)
+	if srcLen == prefix {
+		return 0, nil
+	}
+	if srcLen-prefix < mfLimit+1 {
+		return emitLastLiterals(src[prefix:], dst, 0)
+	}
+
+	matchBase := minMatchLength
+	if params.minMatch > 0 {
+		matchBase = params.minMatch
+	}
+	minMatch, minOffset := matchBase, 1
+	if params.favorDecSpeed {
+		minMatch = max(minMatch, decSpeedMinMatch)
+		minOffset = decSpeedMinOffset
+	}
+
+	heads, chain := hashTable.entries[:hashSize], hashTable.entries[hashSize:hashSize+chainSize]
+	base := hashTable.startBlock(srcLen)
+
+	// Positions before next are linked, starting with the part of the
+	// prefix that matches can reach
+	next := max(0, prefix-maxOffset)
+	insert := func(pos int) {
+		for ; next <= pos; next++ {
+			h := hashAt(src, next)
+			delta := uint32(0)
+			if head := position(heads[h], base); head != noPosition && uint32(next)-head <= maxOffset {
+				delta = uint32(next) - head
+			}
+			chain[next&(chainSize-1)] = delta
+			heads[h] = base + uint32(next)
+		}
+	}
+	find := func(pos int) (ref, length int) {
+		insert(pos)
+		maxLen := srcLen - lastLiterals - pos
+		cand := pos
+		for n := 0; n < params.searchDepth; n++ {
+			delta := int(chain[cand&(chainSize-1)])
+			if delta == 0 || pos-(cand-delta) > maxOffset {
+				break
+			}
+			cand -= delta
+			if pos-cand < minOffset {
+				continue
+			}
+			l := matchLength(src, pos, cand, maxLen)
+			if l > length {
+				ref, length = cand, l
+				if l == maxLen {
+					break
+				}
+			}
+		}
+		return ref, length
+	}
+
+	dstPos := 0
+	anchor := prefix
+	srcPos := prefix
+	for srcPos <= srcLen-mfLimit {
+		ref, length := find(srcPos)
+		if length < minMatch {
+			srcPos++
+			continue
+		}
+		for srcPos+1 <= srcLen-mfLimit {
+			ref2, length2 := find(srcPos + 1)
+			if length2 <= length {
+				break
+			}
+			srcPos, ref, length = srcPos+1, ref2, length2
+		}
+
+		var err error
+		dstPos, err = emitSequence(src[anchor:srcPos], srcPos-ref, length-matchBase, dst, dstPos)
+		if err != nil {
+			return 0, err
+		}
+		srcPos += length
+		anchor = srcPos
+	}
+
+	if anchor < srcLen {
+		return emitLastLiterals(src[anchor:], dst, dstPos)
+	}
+	return dstPos, nil
+}
@@ -0,0 +1,59 @@
+package lz4_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	lz4 "rzstd/src"
+)
+
+var testWords = []string{
+	"the", "quick", "brown", "fox", "jumps", "over", "lazy", "dog", "lorem",
+	"ipsum", "dolor", "sit", "amet", "frame", "block", "stream", "match",
+	"literal", "offset", "window", "checksum", "header", "\n",
+}
+
+// testInput returns n bytes of text made of common words, which compresses
+// about as well as prose. The same n always gives the same text.
+func testInput(n int) []byte {
+	rng := rand.New(rand.NewSource(int64(n)))
+	var b bytes.Buffer
+	for b.Len() < n {
+		b.WriteString(testWords[rng.Intn(len(testWords))])
+		b.WriteByte(' ')
+	}
+	return b.Bytes()[:n]
+}
+
+// compress returns data compressed by a Writer with options.
+func compress(t *testing.T, data []byte, options ...lz4.Option) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := lz4.NewWriter(&buf)
+	if err := w.Apply(options...); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// decompress returns all of stream decoded by a Reader with options.
+func decompress(t *testing.T, stream []byte, options ...lz4.Option) []byte {
+	t.Helper()
+	r := lz4.NewReader(bytes.NewReader(stream))
+	if err := r.Apply(options...); err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	return out
+}
@@ -0,0 +1,124 @@
+package lz4
+
+import "io"
+
+// FrameInfo describes a frame of a stream, as listed by Inspect.
+type FrameInfo struct {
+	// Offset is the position of the magic number of the frame in the
+	// stream, and Size the number of bytes the frame takes up
+	Offset int64
+	Size   int64
+	Magic  uint32
+	// Header is nil for a skippable frame, which has no blocks
+	Header *DecodedFrameHeader
+	Blocks []BlockInfo
+	// UncompressedSize is the total of the uncompressed sizes of the blocks
+	UncompressedSize int64
+	// ContentChecksum is the checksum stored after the end mark if the
+	// header has ContentChecksumFlag set
+	ContentChecksum uint32
+}
+
+// BlockInfo describes a data block of a frame.
+type BlockInfo struct {
+	// Offset is the position of the size field of the block in the stream
+	Offset           int64
+	CompressedSize   int
+	UncompressedSize int
+	// Uncompressed is set for a block stored as is
+	Uncompressed bool
+	// Checksum is the stored checksum of the block if the header has
+	// BlocksChecksumFlag set
+	Checksum uint32
+}
+
+// Inspect lists the frames in r and the blocks of each, as lz4 --list does,
+// without decompressing them: the uncompressed size of a block is worked
+// out from its sequences alone. Checksums are reported as stored, not
+// verified. If the stream is damaged or cut short, Inspect returns the
+// frames listed up to that point along with the error.
+func Inspect(r io.Reader) ([]FrameInfo, error) {
+	walk := newFrameWalker(r)
+	var frames []FrameInfo
+	for {
+		m, offset, err := walk.magic()
+		if err == io.EOF {
+			return frames, nil
+		} else if err != nil {
+			return frames, err
+		}
+		f := FrameInfo{Offset: offset, Magic: m}
+
+		if isSkippableMagic(m) {
+			if err := walk.skip(); err != nil {
+				return frames, err
+			}
+			f.Size = walk.pos() - f.Offset
+			frames = append(frames, f)
+			continue
+		}
+
+		header, checksumOK, err := walk.readHeader(m)
+		if err == nil && !checksumOK {
+			err = ErrHeaderChecksum
+		}
+		if err != nil {
+			return frames, err
+		}
+		f.Header = header
+		err = inspectBlocks(walk, &f)
+		f.Size = walk.pos() - f.Offset
+		frames = append(frames, f)
+		if err != nil {
+			return frames, err
+		}
+	}
+}
+
+// inspectBlocks lists the blocks of f, the current frame of walk, and reads
+// its content checksum.
+func inspectBlocks(walk *frameWalker, f *FrameInfo) error {
+	for {
+		block, err := walk.block()
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			break
+		}
+		b := BlockInfo{
+			Offset:           block.Offset,
+			CompressedSize:   len(block.Data),
+			UncompressedSize: len(block.Data),
+			Uncompressed:     block.Uncompressed,
+			Checksum:         block.Checksum,
+		}
+		if !b.Uncompressed {
+			if b.UncompressedSize, err = decodedSize(f.Header, block.Data); err != nil {
+				return err
+			}
+		}
+		f.Blocks = append(f.Blocks, b)
+		f.UncompressedSize += int64(b.UncompressedSize)
+	}
+	sum, err := walk.endFrame()
+	f.ContentChecksum = sum
+	return err
+}
+
+// decodedSize works out the uncompressed size of a compressed block of a
+// frame with header h from its sequences alone.
+func decodedSize(h *DecodedFrameHeader, block []byte) (int, error) {
+	// Matches may reach back into the dictionary or the previous blocks
+	history := 0
+	if !h.BlocksIndependentFlag || h.DictIDFlag {
+		history = maxDictSize
+	}
+	d := &SequenceDecoder{src: block, minMatch: minMatchLength, dstPos: history}
+	for d.Next() {
+	}
+	if err := d.Err(); err != nil {
+		return 0, err
+	}
+	return d.DecodedSize() - history, nil
+}
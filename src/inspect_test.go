@@ -0,0 +1,73 @@
+package lz4_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	lz4 "rzstd/src"
+)
+
+func TestInspect(t *testing.T) {
+	random := make([]byte, 64<<10)
+	rand.New(rand.NewSource(1)).Read(random)
+	text := testInput(100 << 10)
+	first := compress(t, append(bytes.Clone(random), text...), lz4.WithBlockSize(64<<10), lz4.WithBlockChecksum(), lz4.WithContentChecksum())
+	meta := skippable(0xA, 4, []byte("meta"))
+	legacy := legacyFrame(t, text)
+	stream := bytes.Join([][]byte{first, meta, legacy}, nil)
+
+	frames, err := lz4.Inspect(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		magic  uint32
+		size   int
+		blocks []int
+	}{
+		{0x184D2204, len(first), []int{64 << 10, 64 << 10, 36 << 10}},
+		{0x184D2A5A, len(meta), nil},
+		{0x184C2102, len(legacy), []int{100 << 10}},
+	}
+	if len(frames) != len(want) {
+		t.Fatalf("got %d frames, want %d", len(frames), len(want))
+	}
+	offset := int64(0)
+	for i, f := range frames {
+		w := want[i]
+		if f.Magic != w.magic || f.Offset != offset || f.Size != int64(w.size) {
+			t.Errorf("frame %d: magic %08x at %d, %d bytes; want %08x at %d, %d bytes", i, f.Magic, f.Offset, f.Size, w.magic, offset, w.size)
+		}
+		if (f.Header == nil) != (w.blocks == nil) || len(f.Blocks) != len(w.blocks) {
+			t.Errorf("frame %d: header %v, %d blocks, want %d", i, f.Header != nil, len(f.Blocks), len(w.blocks))
+			continue
+		}
+		total := int64(0)
+		for j, b := range f.Blocks {
+			if b.UncompressedSize != w.blocks[j] {
+				t.Errorf("frame %d block %d: %d bytes uncompressed, want %d", i, j, b.UncompressedSize, w.blocks[j])
+			}
+			total += int64(b.UncompressedSize)
+		}
+		if f.UncompressedSize != total {
+			t.Errorf("frame %d: UncompressedSize %d, blocks add up to %d", i, f.UncompressedSize, total)
+		}
+		offset += f.Size
+	}
+	if !frames[0].Blocks[0].Uncompressed || frames[0].Blocks[1].Uncompressed {
+		t.Error("the random block and only it should be stored raw")
+	}
+
+	// A stream cut short lists the frames up to the cut, the last one
+	// partly
+	frames, err = lz4.Inspect(bytes.NewReader(stream[:len(first)+len(meta)+10]))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Inspect of a truncated stream = %v", err)
+	}
+	if len(frames) != 3 || frames[2].Magic != 0x184C2102 {
+		t.Errorf("Inspect of a truncated stream listed %d frames, want 3", len(frames))
+	}
+}
@@ -0,0 +1,147 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	lz4 "rzstd/src"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+// Reader looks up records in a store. It is safe for concurrent use.
+type Reader struct {
+	src     io.ReaderAt
+	blocks  []blockRef
+	records int64
+
+	// The last block decoded, since lookups tend to be close together
+	mu     sync.Mutex
+	cached int
+	block  []byte
+}
+
+// Open reads the index of the store of size bytes in src.
+func Open(src io.ReaderAt, size int64) (*Reader, error) {
+	if size < trailerSize {
+		return nil, ErrNotStore
+	}
+	var t [trailerSize]byte
+	if _, err := src.ReadAt(t[:], size-trailerSize); err != nil {
+		return nil, err
+	}
+	p := t[8:]
+	if binary.LittleEndian.Uint32(t[:]) != trailerMagic ||
+		binary.LittleEndian.Uint32(t[4:]) != uint32(len(p)) ||
+		string(p[:4]) != trailerTag ||
+		xxHash32.Checksum(p[:len(p)-4], 0) != binary.LittleEndian.Uint32(p[len(p)-4:]) {
+		return nil, ErrNotStore
+	}
+	offset := int64(binary.LittleEndian.Uint64(p[4:]))
+	length := int64(binary.LittleEndian.Uint64(p[12:]))
+	if offset < 0 || length < 0 || offset+length > size-trailerSize {
+		return nil, fmt.Errorf("%w: index out of bounds", lz4.ErrCorrupted)
+	}
+	index, err := readFrame(src, offset, length)
+	if err != nil {
+		return nil, fmt.Errorf("index: %w", err)
+	}
+
+	r := &Reader{src: src, records: int64(binary.LittleEndian.Uint64(p[20:])), cached: -1}
+	for len(index) > 0 {
+		var b blockRef
+		key, n := readBytes(index)
+		if n <= 0 {
+			return nil, fmt.Errorf("%w: invalid index", lz4.ErrCorrupted)
+		}
+		b.lastKey = key
+		index = index[n:]
+		off, n1 := binary.Uvarint(index)
+		if n1 <= 0 {
+			return nil, fmt.Errorf("%w: invalid index", lz4.ErrCorrupted)
+		}
+		l, n2 := binary.Uvarint(index[n1:])
+		if n2 <= 0 || off+l > uint64(offset) {
+			return nil, fmt.Errorf("%w: invalid index", lz4.ErrCorrupted)
+		}
+		b.offset, b.length = int64(off), int64(l)
+		index = index[n1+n2:]
+		r.blocks = append(r.blocks, b)
+	}
+	return r, nil
+}
+
+// Len returns the number of records in the store.
+func (r *Reader) Len() int64 {
+	return r.records
+}
+
+// Get returns the value stored under key, or ErrNotFound. It decompresses
+// at most one block.
+func (r *Reader) Get(key []byte) ([]byte, error) {
+	i := sort.Search(len(r.blocks), func(i int) bool {
+		return bytes.Compare(r.blocks[i].lastKey, key) >= 0
+	})
+	if i == len(r.blocks) {
+		return nil, ErrNotFound
+	}
+
+	r.mu.Lock()
+	block := r.block
+	if r.cached != i {
+		b := r.blocks[i]
+		var err error
+		if block, err = readFrame(r.src, b.offset, b.length); err != nil {
+			r.mu.Unlock()
+			return nil, fmt.Errorf("block %d: %w", i, err)
+		}
+		r.cached, r.block = i, block
+	}
+	r.mu.Unlock()
+
+	for len(block) > 0 {
+		kl, n1 := binary.Uvarint(block)
+		if n1 <= 0 {
+			break
+		}
+		vl, n2 := binary.Uvarint(block[n1:])
+		if n2 <= 0 {
+			break
+		}
+		block = block[n1+n2:]
+		if kl > uint64(len(block)) || vl > uint64(len(block))-kl {
+			break
+		}
+		k, v := block[:kl], block[kl:kl+vl]
+		switch bytes.Compare(k, key) {
+		case 0:
+			return bytes.Clone(v), nil
+		case 1:
+			return nil, ErrNotFound
+		}
+		block = block[kl+vl:]
+	}
+	if len(block) > 0 {
+		return nil, fmt.Errorf("%w: invalid record in block %d", lz4.ErrCorrupted, i)
+	}
+	return nil, ErrNotFound
+}
+
+// readFrame decompresses the frame of length bytes at offset in src.
+func readFrame(src io.ReaderAt, offset, length int64) ([]byte, error) {
+	return io.ReadAll(lz4.NewReader(io.NewSectionReader(src, offset, length)))
+}
+
+// readBytes decodes a length-prefixed byte string from the start of p and
+// returns it with the number of bytes it took, or 0 if p is malformed.
+func readBytes(p []byte) ([]byte, int) {
+	l, n := binary.Uvarint(p)
+	if n <= 0 || l > uint64(len(p)-n) {
+		return nil, 0
+	}
+	return p[n : n+int(l)], n + int(l)
+}
@@ -0,0 +1,152 @@
+// Package kv stores key-value records in a file of LZ4 frames: records are
+// gathered into blocks of about BlockSize bytes, each compressed as its own
+// frame, and a compressed index of the last key of every block lets Get
+// decompress just the block that can hold a key. The file is an ordinary
+// LZ4 stream ending in a skippable frame that locates the index.
+package kv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	lz4 "rzstd/src"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+const (
+	// BlockSize is the uncompressed size past which a block is closed.
+	BlockSize = 64 * 1024
+
+	trailerMagic = 0x184D2A50 | lz4.KVTrailerNibble
+	trailerTag   = "RZKV"
+	// Skippable frame header, tag, index offset (8), index length (8),
+	// record count (8) and a checksum of the payload (4)
+	trailerSize = 8 + 4 + 8 + 8 + 8 + 4
+)
+
+var (
+	ErrKeyOrder = errors.New("keys must be added in increasing order")
+	ErrNotFound = errors.New("key not found")
+	ErrNotStore = errors.New("not a key-value store")
+)
+
+// blockRef locates a block and the largest key it holds.
+type blockRef struct {
+	lastKey []byte
+	offset  int64
+	length  int64
+}
+
+// Writer writes a store. Keys must be added in strictly increasing
+// byte-wise order.
+type Writer struct {
+	dst     *lz4.CountingWriter
+	w       *lz4.Writer
+	block   []byte
+	lastKey []byte
+	blocks  []blockRef
+	records int64
+	err     error
+}
+
+func NewWriter(dst io.Writer) *Writer {
+	cw := lz4.NewCountingWriter(dst)
+	return &Writer{dst: cw, w: lz4.NewWriter(cw)}
+}
+
+// Put adds a record.
+func (w *Writer) Put(key, value []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.records > 0 && bytes.Compare(key, w.lastKey) <= 0 {
+		return ErrKeyOrder
+	}
+	w.block = binary.AppendUvarint(w.block, uint64(len(key)))
+	w.block = binary.AppendUvarint(w.block, uint64(len(value)))
+	w.block = append(w.block, key...)
+	w.block = append(w.block, value...)
+	w.lastKey = append(w.lastKey[:0], key...)
+	w.records++
+	if len(w.block) >= BlockSize {
+		return w.flushBlock()
+	}
+	return nil
+}
+
+func (w *Writer) flushBlock() error {
+	if len(w.block) == 0 {
+		return nil
+	}
+	offset := w.dst.Count()
+	if err := w.writeFrame(w.block); err != nil {
+		return err
+	}
+	w.blocks = append(w.blocks, blockRef{
+		lastKey: bytes.Clone(w.lastKey),
+		offset:  offset,
+		length:  w.dst.Count() - offset,
+	})
+	w.block = w.block[:0]
+	return nil
+}
+
+// writeFrame compresses p as a frame of its own.
+func (w *Writer) writeFrame(p []byte) error {
+	err := w.w.BeginFrame()
+	if err == nil {
+		_, err = w.w.Write(p)
+	}
+	if err == nil {
+		err = w.w.EndFrame()
+	}
+	if err != nil {
+		w.err = err
+	}
+	return err
+}
+
+// Close writes the last block, the index and the trailer. It does not close
+// the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.flushBlock(); err != nil {
+		return err
+	}
+
+	var index []byte
+	for _, b := range w.blocks {
+		index = binary.AppendUvarint(index, uint64(len(b.lastKey)))
+		index = append(index, b.lastKey...)
+		index = binary.AppendUvarint(index, uint64(b.offset))
+		index = binary.AppendUvarint(index, uint64(b.length))
+	}
+	offset := w.dst.Count()
+	if err := w.writeFrame(index); err != nil {
+		return err
+	}
+	length := w.dst.Count() - offset
+	if err := w.w.Close(); err != nil {
+		w.err = err
+		return err
+	}
+
+	trailer := binary.LittleEndian.AppendUint32(nil, trailerMagic)
+	trailer = binary.LittleEndian.AppendUint32(trailer, trailerSize-8)
+	trailer = append(trailer, trailerTag...)
+	trailer = binary.LittleEndian.AppendUint64(trailer, uint64(offset))
+	trailer = binary.LittleEndian.AppendUint64(trailer, uint64(length))
+	trailer = binary.LittleEndian.AppendUint64(trailer, uint64(w.records))
+	trailer = binary.LittleEndian.AppendUint32(trailer, xxHash32.Checksum(trailer[8:], 0))
+	_, err := w.dst.Write(trailer)
+	w.err = lz4.ErrClosed
+	if err != nil {
+		w.err = err
+	}
+	return err
+}
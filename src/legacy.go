@@ -0,0 +1,34 @@
+package lz4
+
+import "io"
+
+const (
+	// legacyMagic starts a frame of the legacy format of old lz4 tools and
+	// Linux kernel images: a magic number followed by blocks of up to
+	// legacyBlockSize bytes, each preceded by its compressed size, with no
+	// descriptor, checksums or end mark
+	legacyMagic     = 0x184C2102
+	legacyBlockSize = 8 << 20
+)
+
+// legacyBound is the largest compressed size of a legacy block. Any larger
+// size is the magic number of the next frame.
+var legacyBound = uint32(compressBound(legacyBlockSize))
+
+// readLegacySize reads the compressed size of the next block of a legacy
+// frame, or returns 0 where the frame ends: at the end of the input, or at
+// another frame, whose magic number is left in r.word for readNextHeader.
+func (r *Reader) readLegacySize() (uint32, error) {
+	size, err := r.readUint32()
+	if err == io.EOF {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if size > legacyBound {
+		r.magicRead = true
+		return 0, nil
+	}
+	return size, nil
+}
@@ -0,0 +1,51 @@
+package lz4_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	lz4 "rzstd/src"
+)
+
+// legacyFrame returns chunks as a frame of the legacy format: its magic
+// number followed by each chunk as a block preceded by its size.
+func legacyFrame(t *testing.T, chunks ...[]byte) []byte {
+	t.Helper()
+	frame := binary.LittleEndian.AppendUint32(nil, 0x184C2102)
+	for _, c := range chunks {
+		block := make([]byte, lz4.CompressBlockBound(len(c)))
+		n, err := lz4.CompressBlock(c, block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frame = binary.LittleEndian.AppendUint32(frame, uint32(n))
+		frame = append(frame, block[:n]...)
+	}
+	return frame
+}
+
+func TestLegacyFrames(t *testing.T) {
+	a, b, c := testInput(100<<10), testInput(10<<10), testInput(50<<10)
+	// Legacy frames one after another, as cat makes them, then a frame of
+	// the current format
+	stream := append(legacyFrame(t, a, b), legacyFrame(t, c)...)
+	stream = append(stream, compress(t, a)...)
+	want := bytes.Join([][]byte{a, b, c, a}, nil)
+	if got := decompress(t, stream); !bytes.Equal(got, want) {
+		t.Fatalf("legacy frames decode to %d bytes, want %d", len(got), len(want))
+	}
+
+	header, err := lz4.ReadFrameHeader(bytes.NewReader(stream))
+	if err != nil || header.Magic != 0x184C2102 || !header.BlocksIndependentFlag {
+		t.Errorf("ReadFrameHeader = %+v, %v", header, err)
+	}
+
+	truncated := legacyFrame(t, a)
+	truncated = truncated[:len(truncated)-10]
+	if _, err := io.ReadAll(lz4.NewReader(bytes.NewReader(truncated))); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated legacy block: Read = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
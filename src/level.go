@@ -0,0 +1,71 @@
+package lz4
+
+import "errors"
+
+const (
+	defaultLevel = 1
+	// minLevel reaches maxAcceleration and a 4KB hash table
+	minLevel = -5
+)
+
+var (
+	ErrInvalidLevel        = errors.New("invalid compression level")
+	ErrInvalidAcceleration = errors.New("invalid acceleration")
+)
+
+// WithLevel sets the compression level of a Writer. Level 1 is the
+// default. Levels from 0 down to -5 are turbo levels for links faster than
+// the CPU: each one doubles the acceleration of the match search, starting
+// at 2, and halves the hash table, so compression approaches memcpy speed
+// at a cost of several points of ratio. Levels 2 to 12 are HC levels, which
+// chain every position and try 2, 4 and up to 2048 earlier ones for each
+// match, trading compression speed for ratio; decompression is as fast as
+// ever.
+func WithLevel(level int) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			if level < minLevel || level > maxLevel {
+				return ErrInvalidLevel
+			}
+			w.level = level
+			w.params.acceleration, w.params.tableLog, w.params.searchDepth = 1, 0, 0
+			if level < defaultLevel {
+				w.params.acceleration = min(2<<(defaultLevel-1-level), maxAcceleration)
+				w.params.tableLog = hashLog - (defaultLevel - level)
+			}
+			if w.acceleration != 0 {
+				w.params.acceleration = w.acceleration
+			}
+			if level > defaultLevel {
+				w.params.searchDepth = 1 << (level - 1)
+				if len(w.hashTable.entries) < hashSize+chainSize {
+					w.hashTable = newHashTable(w.params)
+				}
+			}
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// WithAcceleration sets how fast the match search of a Writer skips through
+// data that does not compress, as the acceleration of the reference
+// encoder does: after every 64 positions without a match the step grows by
+// one, starting from n. 1 is the default, and larger values trade ratio for
+// speed. It takes precedence over the acceleration of the turbo levels of
+// WithLevel; the HC levels search every position regardless.
+func WithAcceleration(n int) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			if n < 1 {
+				return ErrInvalidAcceleration
+			}
+			w.acceleration = n
+			w.params.acceleration = n
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
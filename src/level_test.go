@@ -0,0 +1,61 @@
+package lz4_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	lz4 "rzstd/src"
+)
+
+func TestHCLevels(t *testing.T) {
+	data := testInput(1 << 20)
+	fast := len(compress(t, data))
+	sizes := map[int]int{}
+	for level := 2; level <= 12; level++ {
+		stream := compress(t, data, lz4.WithLevel(level))
+		if got := decompress(t, stream); !bytes.Equal(got, data) {
+			t.Fatalf("level %d: round trip does not match the input", level)
+		}
+		sizes[level] = len(stream)
+	}
+	if sizes[2] >= fast || sizes[9] > sizes[2] || sizes[12] > sizes[9] {
+		t.Errorf("sizes: level 1 %d, 2 %d, 9 %d, 12 %d; want each at most the one before", fast, sizes[2], sizes[9], sizes[12])
+	}
+
+	for _, level := range []int{-6, 13} {
+		if err := lz4.NewWriter(io.Discard).Apply(lz4.WithLevel(level)); !errors.Is(err, lz4.ErrInvalidLevel) {
+			t.Errorf("WithLevel(%d) = %v, want %v", level, err, lz4.ErrInvalidLevel)
+		}
+	}
+}
+
+func TestAcceleration(t *testing.T) {
+	data := testInput(1 << 20)
+	sizes := map[int]int{}
+	for _, acc := range []int{1, 4, 64} {
+		stream := compress(t, data, lz4.WithAcceleration(acc))
+		if got := decompress(t, stream); !bytes.Equal(got, data) {
+			t.Fatalf("acceleration %d: round trip does not match the input", acc)
+		}
+		sizes[acc] = len(stream)
+	}
+	if sizes[4] < sizes[1] || sizes[64] < sizes[4] {
+		t.Errorf("sizes %v grow smaller with more acceleration", sizes)
+	}
+	// The default is acceleration 1
+	if n := len(compress(t, data)); n != sizes[1] {
+		t.Errorf("default compresses to %d bytes, acceleration 1 to %d", n, sizes[1])
+	}
+	// An explicit acceleration takes precedence over that of a turbo level,
+	// which still has its smaller hash table
+	turbo := len(compress(t, data, lz4.WithLevel(-5)))
+	if n := len(compress(t, data, lz4.WithLevel(-5), lz4.WithAcceleration(1))); n >= turbo {
+		t.Errorf("level -5 with acceleration 1 compresses to %d bytes, without %d", n, turbo)
+	}
+
+	if err := lz4.NewWriter(io.Discard).Apply(lz4.WithAcceleration(0)); !errors.Is(err, lz4.ErrInvalidAcceleration) {
+		t.Errorf("WithAcceleration(0) = %v, want %v", err, lz4.ErrInvalidAcceleration)
+	}
+}
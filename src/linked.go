@@ -0,0 +1,42 @@
+package lz4
+
+import "errors"
+
+var ErrLinkedCheckpoint = errors.New("checkpoints within a frame are not supported with linked blocks")
+
+// WithLinkedBlocks makes a Writer clear the block independence flag of its
+// frames and let matches reach up to 64KB back into the previous blocks of
+// the frame, as lz4 -BD does. This improves the ratio of small blocks, but a
+// block can then only be decoded after the ones before it.
+//
+// Match offsets are 16 bits, so redundancy further apart than 64KB, as in
+// concatenated logs, is not found. A larger history would need a
+// preprocessing layer that other LZ4 decoders cannot undo, and is not
+// provided.
+func WithLinkedBlocks() Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			w.linked = true
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// slideWindow returns the last 64KB of window followed by data, the history
+// the next linked block may reference. It reuses buf, which window may
+// alias.
+func slideWindow(buf, window, data []byte) []byte {
+	if len(data) >= maxDictSize {
+		return append(buf[:0], data[len(data)-maxDictSize:]...)
+	}
+	if cap(buf) < maxDictSize {
+		buf = make([]byte, 0, maxDictSize)
+	}
+	keep := min(len(window), maxDictSize-len(data))
+	buf = buf[:keep+len(data)]
+	copy(buf, window[len(window)-keep:])
+	copy(buf[keep:], data)
+	return buf
+}
@@ -0,0 +1,51 @@
+package lz4_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	lz4 "rzstd/src"
+)
+
+func TestLinkedBlocks(t *testing.T) {
+	// Random text repeated every 48KB, which only blocks that see the
+	// previous one can match
+	pattern := make([]byte, 48<<10)
+	rand.New(rand.NewSource(1)).Read(pattern)
+	data := bytes.Repeat(pattern, 6)
+
+	linked := compress(t, data, lz4.WithBlockSize(64<<10), lz4.WithLinkedBlocks())
+	header, err := lz4.ReadFrameHeader(bytes.NewReader(linked))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.BlocksIndependentFlag {
+		t.Error("block independence flag is set")
+	}
+	if independent := compress(t, data, lz4.WithBlockSize(64<<10)); len(linked) >= len(independent)/2 {
+		t.Errorf("linked frame is %d bytes, independent %d", len(linked), len(independent))
+	}
+	// Blocks that depend on each other are decoded in order even when the
+	// Reader may decode ahead
+	for _, concurrency := range []int{1, 4} {
+		if got := decompress(t, linked, lz4.WithConcurrency(concurrency)); !bytes.Equal(got, data) {
+			t.Fatalf("concurrency %d: round trip does not match the input", concurrency)
+		}
+	}
+}
+
+func TestLinkedCheckpoint(t *testing.T) {
+	w := lz4.NewWriter(io.Discard)
+	if err := w.Apply(lz4.WithBlockSize(64<<10), lz4.WithLinkedBlocks()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(testInput(100 << 10)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Checkpoint(); !errors.Is(err, lz4.ErrLinkedCheckpoint) {
+		t.Errorf("Checkpoint within a linked frame = %v, want %v", err, lz4.ErrLinkedCheckpoint)
+	}
+}
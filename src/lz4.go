@@ -3,12 +3,18 @@ package lz4
 import (
 	"encoding/binary"
 	"errors"
+	"hash"
 	"io"
+	"math/bits"
+	"time"
+	"unsafe"
+
+	"github.com/pierrec/xxHash/xxHash32"
 )
 
 const (
 	minMatchLength = 4
-	maxMatchLength = 0xFFFF
+	maxMinMatch    = 0xFFFF
 	maxOffset      = 0xFFFF
 	hashLog        = 16
 	hashSize       = 1 << hashLog
@@ -16,134 +22,391 @@ const (
 
 	defaultBlockSize = 4 * 1024 * 1024
 	maxBlockSize     = 4 * 1024 * 1024
+
+	hash64      = bits.UintSize == 64
+	prime5Bytes = 889523592379
+	prime8Bytes = 0xCF1BBCDCB7A56463
+
+	longHashLog  = 12
+	longHashSize = 1 << longHashLog
+
+	// The block format requires the last match to start at least mfLimit
+	// bytes before the end of the block and the last lastLiterals bytes to
+	// be literals, so blocks shorter than mfLimit+1 are all literals.
+	mfLimit      = 12
+	lastLiterals = 5
+
+	decSpeedMinMatch  = 8
+	decSpeedMinOffset = 8
+
+	skipTrigger = 6
 )
 
 var (
 	ErrBlockTooLarge = errors.New("block size too large")
 	ErrCorrupted     = errors.New("corrupted input")
+	ErrAborted       = errors.New("writer aborted")
+	ErrClosed        = errors.New("stream is closed")
 )
 
 type Writer struct {
-	dst           io.Writer
+	dst           *CountingWriter
 	blockSize     int
-	hashTable     []uint32
+	hashTable     *matchTable
+	params        compressParams
+	pool          *WorkerPool
+	buffers       BufferPool
 	headerWritten bool
+	blocksInFrame int
+	frames        int
+	consumed      int64
+	alignment     int
+	err           error
+	sections      []Section
+	sectionOpen   bool
+	metadata      []skippableFrame
+	seekable      bool
+	seekIndex     []seekEntry
+	closed        bool
+	stats         Stats
+	adaptive      bool
+	// adaptStep is the step of adaptLadder for the next block, or -1
+	// before the first. adaptProbe is set while a block at adaptRaw is
+	// compressed to measure it, and adaptSpeed holds the last speed
+	// measured at every step.
+	adaptStep      int
+	adaptProbe     bool
+	adaptRawBlocks int
+	adaptSpeed     [len(adaptLadder)]float64
+
+	targetThroughput float64
+	flushTimeout     time.Duration
+	digest           hash.Hash
+	parity           *parityEncoder
+	partSize         int64
+	level            int
+	acceleration     int
+	budget           *memoryBudget
+	checksumInterval int
+	// cumulative hashes everything written when checksumInterval is set;
+	// sinceChecksum counts the blocks since its last checkpoint
+	cumulative     hash.Hash32
+	checksumBlocks int64
+	sinceChecksum  int
+	// content hashes the current frame when contentChecksum is set
+	contentChecksum bool
+	content         *xxh32State
+	blockChecksum   bool
+	// contentSize is declared in the header of the first frame unless
+	// negative
+	contentSize int64
+	// dict is the dictionary blocks are compressed against; window holds it
+	// or, with linked blocks, the history of the frame followed by the block
+	// being compressed
+	dict    []byte
+	dictID  uint32
+	window  []byte
+	linked  bool
+	history []byte
+	// pending buffers input until it fills a block; spare is the input
+	// buffer of a finished background block, and compressed the scratch
+	// space of blocks compressed in the foreground
+	pending    []byte
+	spare      []byte
+	compressed []byte
+	word       [8]byte
+	// jobs are the blocks being compressed in the background, in order,
+	// holding queued bytes of input
+	concurrency int
+	jobs        []*blockJob
+	queued      int64
+	compressors chan *compressor
+
+	codec       Codec
+	codecWriter io.WriteCloser
+}
+
+type compressParams struct {
+	minMatch      int
+	favorDecSpeed bool
+	dualHash      bool
+	// acceleration enables the skip heuristic of the reference encoder:
+	// after every 1<<skipTrigger consecutive misses the search step grows
+	// by one, starting from acceleration. 0 searches every position; Writers
+	// start at 1.
+	acceleration int
+	// tableLog limits the hash table to 1<<tableLog entries; 0 uses all of
+	// them
+	tableLog int
+	// searchDepth enables the hash chain matcher of the HC levels, which
+	// tries up to searchDepth earlier positions for every match
+	searchDepth int
 }
 
 type Reader struct {
-	src         io.Reader
+	src         *CountingReader
 	blockSize   int
 	buffer      []byte
 	leftover    []byte
+	leftoverBuf []byte
 	leftoverPos int
 	eof         bool
 	headerRead  bool
+	pool        *WorkerPool
+	buffers     BufferPool
+	recovery    func(SkippedRange)
+	partial     bool
+	pendingErr  error
+	err         error
+	closed      bool
+	header      *DecodedFrameHeader
+	checksum    hash.Hash32
+	expected    int64
+	delivered   int64
+	resolver    func(id uint32) ([]byte, error)
+	dict        []byte
+	budget      *memoryBudget
+	codec       Codec
+	codecReader io.Reader
+	// hashing is closed once the checksum has taken in the last block,
+	// whose buffer hashingBuf is released then
+	hashing    <-chan struct{}
+	hashingBuf []byte
+	// cumulative is the running checksum of a stream with checkpoints
+	cumulative     hash.Hash32
+	checksumBlocks int64
+	checksumSize   int64
+	// frameSize counts the bytes decoded from the current frame
+	frameSize int64
+	// window backs dict once linked blocks extend it
+	window []byte
+	// spares are block buffers kept for the next blocks, so that steady
+	// reading allocates nothing
+	spares [][]byte
+	// word receives the 32-bit fields of the frame
+	word [4]byte
+	// ahead are the blocks read ahead with WithConcurrency, up to the end
+	// mark of the frame once frameRead is set
+	concurrency int
+	ahead       []*decodedBlock
+	frameRead   bool
+	// singleFrame stops the Reader at the end of the first frame
+	singleFrame bool
+	// magicRead is set when word holds the magic number of the frame after
+	// a legacy one
+	magicRead bool
 }
 
 func hashSequence(seq uint32) uint32 {
 	return (seq * 2654435761) >> hashShift
 }
 
+func hashSequence5(seq uint64) uint32 {
+	return uint32(((seq << 24) * prime5Bytes) >> (64 - hashLog))
+}
+
+func hashSequence8(seq uint64) uint32 {
+	return uint32((seq * prime8Bytes) >> (64 - longHashLog))
+}
+
+// hashAt hashes 5 bytes at src[pos:] on 64-bit platforms when a full 64-bit
+// load is possible, and 4 bytes otherwise.
+func hashAt(src []byte, pos int) uint32 {
+	if hash64 && pos+8 <= len(src) {
+		return hashSequence5(binary.LittleEndian.Uint64(src[pos:]))
+	}
+	return hashSequence(binary.LittleEndian.Uint32(src[pos:]))
+}
+
+// matchLength returns how many bytes, up to limit, src[pos:] has in common
+// with src[ref:]. It compares 8 bytes at a time and locates the first
+// difference from the trailing zeros of their xor.
+func matchLength(src []byte, pos, ref, limit int) int {
+	n := 0
+	for n+8 <= limit {
+		if diff := binary.LittleEndian.Uint64(src[pos+n:]) ^ binary.LittleEndian.Uint64(src[ref+n:]); diff != 0 {
+			return n + bits.TrailingZeros64(diff)>>3
+		}
+		n += 8
+	}
+	for n < limit && src[pos+n] == src[ref+n] {
+		n++
+	}
+	return n
+}
+
+// matchTable indexes earlier positions of the input by hash. Entries hold
+// positions offset by the base of the block that stored them. The base
+// grows by the length of every block, so the entries of earlier blocks fall
+// below it and read as empty, and the table is only cleared when the
+// offsets would overflow.
+type matchTable struct {
+	entries []uint32
+	base    uint32
+}
+
+// noPosition is the position of an empty entry.
+const noPosition = 0xFFFFFFFF
+
+func newMatchTable(size int) *matchTable {
+	return &matchTable{entries: make([]uint32, size)}
+}
+
+// startBlock returns the base of the positions of a block of n bytes.
+func (t *matchTable) startBlock(n int) uint32 {
+	if t.base == 0 || uint64(t.base)+uint64(n) > uint64(^uint32(0)) {
+		clear(t.entries)
+		t.base = 1
+	}
+	base := t.base
+	t.base += uint32(n)
+	return base
+}
+
+// position decodes an entry stored relative to base, which is noPosition
+// if an earlier block stored it.
+func position(entry, base uint32) uint32 {
+	if entry < base {
+		return noPosition
+	}
+	return entry - base
+}
+
+func newHashTable(params compressParams) *matchTable {
+	if params.searchDepth > 0 {
+		// The chain takes the place of the long table
+		return newMatchTable(hashSize + chainSize)
+	}
+	if params.dualHash {
+		return newMatchTable(hashSize + longHashSize)
+	}
+	return newMatchTable(hashSize)
+}
+
 func NewWriter(dst io.Writer) *Writer {
+	return newWriter(dst, newMatchTable(hashSize))
+}
+
+// newWriter returns a Writer that uses hashTable, which must have at least
+// hashSize entries.
+func newWriter(dst io.Writer, hashTable *matchTable) *Writer {
 	return &Writer{
-		dst:           dst,
+		dst:           NewCountingWriter(dst),
 		blockSize:     defaultBlockSize,
-		hashTable:     make([]uint32, hashSize),
+		hashTable:     hashTable,
+		buffers:       heapPool{},
+		params:        compressParams{acceleration: 1},
+		level:         defaultLevel,
 		headerWritten: false,
+		contentSize:   -1,
 	}
 }
 
-func compressBlock(src, dst []byte, hashTable []uint32) (int, error) {
+func compressBlock(src, dst []byte, hashTable *matchTable, params compressParams) (int, error) {
+	return compressBlockPrefix(src, 0, dst, hashTable, params)
+}
+
+// compressBlockPrefix compresses src[prefix:] as a block whose matches may
+// also reach back into src[:prefix], such as a preset dictionary.
+func compressBlockPrefix(src []byte, prefix int, dst []byte, hashTable *matchTable, params compressParams) (int, error) {
 	srcLen := len(src)
-	if srcLen == 0 {
+	if srcLen == prefix {
 		return 0, nil
 	}
-
-	for i := range hashTable {
-		hashTable[i] = 0xFFFFFFFF
+	if srcLen-prefix < mfLimit+1 {
+		return emitLastLiterals(src[prefix:], dst, 0)
 	}
 
-	dstPos := 0
-	anchor := 0
-	srcPos := 0
-
-	for srcPos <= srcLen-minMatchLength {
-		seq := binary.LittleEndian.Uint32(src[srcPos:])
-		h := hashSequence(seq) & (hashSize - 1)
-		ref := hashTable[h]
-		hashTable[h] = uint32(srcPos)
+	matchBase := minMatchLength
+	if params.minMatch > 0 {
+		matchBase = params.minMatch
+	}
+	minMatch := matchBase
+	minOffset := uint32(1)
+	if params.favorDecSpeed {
+		minMatch = max(minMatch, decSpeedMinMatch)
+		minOffset = decSpeedMinOffset
+	}
 
-		if ref == 0xFFFFFFFF || uint32(srcPos)-ref > maxOffset {
-			srcPos++
-			continue
-		}
+	// Turbo levels use only the start of the table, which stays in cache
+	mask := uint32(hashSize - 1)
+	if params.tableLog > 0 {
+		mask = 1<<params.tableLog - 1
+	}
+	table := hashTable.entries
+	base := hashTable.startBlock(srcLen)
+
+	// With dualHash the table is followed by a smaller one indexing 8-byte
+	// sequences, which is consulted first so long matches win over short ones.
+	var longTable []uint32
+	if params.dualHash {
+		longTable = table[hashSize:]
+	}
 
-		matchLen := 0
-		maxLen := srcLen - srcPos
-		if maxLen > maxMatchLength {
-			maxLen = maxMatchLength
-		}
-		for matchLen < maxLen && src[srcPos+matchLen] == src[int(ref)+matchLen] {
-			matchLen++
+	// Index the part of the prefix that matches can reach
+	for i := max(0, prefix-maxOffset); i < prefix; i++ {
+		table[hashAt(src, i)&mask] = base + uint32(i)
+		if longTable != nil {
+			longTable[hashSequence8(binary.LittleEndian.Uint64(src[i:]))] = base + uint32(i)
 		}
+	}
 
-		if matchLen < minMatchLength {
-			srcPos++
-			continue
+	dstPos := 0
+	anchor := prefix
+	srcPos := prefix
+	lastOffset := 0
+
+	step, searchMatchNb := 1, params.acceleration<<skipTrigger
+
+	for srcPos <= srcLen-mfLimit {
+		h := hashAt(src, srcPos) & mask
+		ref := position(table[h], base)
+		table[h] = base + uint32(srcPos)
+
+		if longTable != nil && srcPos+8 <= srcLen {
+			seq := binary.LittleEndian.Uint64(src[srcPos:])
+			lh := hashSequence8(seq)
+			lref := position(longTable[lh], base)
+			longTable[lh] = base + uint32(srcPos)
+			if lref != noPosition && uint32(srcPos)-lref <= maxOffset &&
+				binary.LittleEndian.Uint64(src[lref:]) == seq {
+				ref = lref
+			}
 		}
 
-		literalLen := srcPos - anchor
-		token := byte(0)
-		if literalLen < 15 {
-			token = byte(literalLen << 4)
-		} else {
-			token = 0xF0
+		// Structured data tends to repeat with a fixed stride, so the offset of
+		// the previous match is tried before anything the tables suggest.
+		if lastOffset > 0 && binary.LittleEndian.Uint32(src[srcPos-lastOffset:]) == binary.LittleEndian.Uint32(src[srcPos:]) {
+			ref = uint32(srcPos - lastOffset)
 		}
 
-		matchLenCode := matchLen - minMatchLength
-		if matchLenCode < 15 {
-			token |= byte(matchLenCode)
-		} else {
-			token |= 0x0F
-		}
-
-		if dstPos+1+literalLen+2 > len(dst) {
-			return 0, ErrBlockTooLarge
+		if ref == noPosition || uint32(srcPos)-ref > maxOffset || uint32(srcPos)-ref < minOffset {
+			if params.acceleration > 0 {
+				step = searchMatchNb >> skipTrigger
+				searchMatchNb++
+			}
+			srcPos += step
+			continue
 		}
 
-		dst[dstPos] = token
-		dstPos++
+		matchLen := matchLength(src, srcPos, int(ref), srcLen-lastLiterals-srcPos)
 
-		if literalLen >= 15 {
-			remaining := literalLen - 15
-			for remaining >= 255 {
-				dst[dstPos] = 255
-				dstPos++
-				remaining -= 255
+		if matchLen < minMatch {
+			if params.acceleration > 0 {
+				step = searchMatchNb >> skipTrigger
+				searchMatchNb++
 			}
-			dst[dstPos] = byte(remaining)
-			dstPos++
-		}
-
-		if literalLen > 0 {
-			copy(dst[dstPos:], src[anchor:srcPos])
-			dstPos += literalLen
+			srcPos += step
+			continue
 		}
+		searchMatchNb = params.acceleration << skipTrigger
 
 		offset := srcPos - int(ref)
-		dst[dstPos] = byte(offset)
-		dst[dstPos+1] = byte(offset >> 8)
-		dstPos += 2
-
-		if matchLenCode >= 15 {
-			remaining := matchLenCode - 15
-			for remaining >= 255 {
-				dst[dstPos] = 255
-				dstPos++
-				remaining -= 255
-			}
-			dst[dstPos] = byte(remaining)
-			dstPos++
+		lastOffset = offset
+		var err error
+		dstPos, err = emitSequence(src[anchor:srcPos], offset, matchLen-matchBase, dst, dstPos)
+		if err != nil {
+			return 0, err
 		}
 
 		srcPos += matchLen
@@ -151,101 +414,607 @@ func compressBlock(src, dst []byte, hashTable []uint32) (int, error) {
 	}
 
 	if anchor < srcLen {
-		literalLen := srcLen - anchor
-		token := byte(0)
-		if literalLen < 15 {
-			token = byte(literalLen << 4)
-		} else {
-			token = 0xF0
-		}
+		return emitLastLiterals(src[anchor:], dst, dstPos)
+	}
+
+	return dstPos, nil
+}
+
+// emitLastLiterals writes lits as the final, match-less sequence of a block
+// starting at dst[dstPos:] and returns the new end of the block.
+func emitLastLiterals(lits, dst []byte, dstPos int) (int, error) {
+	literalLen := len(lits)
+	if dstPos+1+lengthBytes(literalLen)+literalLen > len(dst) {
+		return 0, ErrBlockTooLarge
+	}
 
-		if dstPos+1+literalLen > len(dst) {
-			return 0, ErrBlockTooLarge
+	if literalLen < 15 {
+		dst[dstPos] = byte(literalLen << 4)
+		dstPos++
+	} else {
+		dst[dstPos] = 0xF0
+		dstPos++
+		remaining := literalLen - 15
+		for remaining >= 255 {
+			dst[dstPos] = 255
+			dstPos++
+			remaining -= 255
 		}
+		dst[dstPos] = byte(remaining)
+		dstPos++
+	}
+
+	copy(dst[dstPos:], lits)
+	return dstPos + literalLen, nil
+}
+
+// emitSequence writes the literals lits followed by a match at offset whose
+// length exceeds the minimum by matchLenCode, starting at dst[dstPos:], and
+// returns the new end of the block.
+func emitSequence(lits []byte, offset, matchLenCode int, dst []byte, dstPos int) (int, error) {
+	literalLen := len(lits)
+	token := byte(0)
+	if literalLen < 15 {
+		token = byte(literalLen << 4)
+	} else {
+		token = 0xF0
+	}
+	if matchLenCode < 15 {
+		token |= byte(matchLenCode)
+	} else {
+		token |= 0x0F
+	}
+
+	if dstPos+1+lengthBytes(literalLen)+literalLen+2+lengthBytes(matchLenCode) > len(dst) {
+		return 0, ErrBlockTooLarge
+	}
+
+	dst[dstPos] = token
+	dstPos++
 
-		dst[dstPos] = token
+	if literalLen >= 15 {
+		remaining := literalLen - 15
+		for remaining >= 255 {
+			dst[dstPos] = 255
+			dstPos++
+			remaining -= 255
+		}
+		dst[dstPos] = byte(remaining)
 		dstPos++
+	}
 
-		if literalLen >= 15 {
-			remaining := literalLen - 15
-			for remaining >= 255 {
-				dst[dstPos] = 255
-				dstPos++
-				remaining -= 255
-			}
-			dst[dstPos] = byte(remaining)
+	copy(dst[dstPos:], lits)
+	dstPos += literalLen
+
+	dst[dstPos] = byte(offset)
+	dst[dstPos+1] = byte(offset >> 8)
+	dstPos += 2
+
+	if matchLenCode >= 15 {
+		remaining := matchLenCode - 15
+		for remaining >= 255 {
+			dst[dstPos] = 255
 			dstPos++
+			remaining -= 255
 		}
+		dst[dstPos] = byte(remaining)
+		dstPos++
+	}
+	return dstPos, nil
+}
 
-		copy(dst[dstPos:], src[anchor:srcLen])
-		dstPos += literalLen
+func lengthBytes(n int) int {
+	if n < 15 {
+		return 0
 	}
+	return (n-15)/255 + 1
+}
 
-	return dstPos, nil
+// WriteHeader sends the frame header to the underlying writer right away,
+// so a peer can see the start of the stream before any payload exists.
+// Calling it after the header has been written is a no-op.
+func (w *Writer) WriteHeader() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.codec != nil {
+		return w.startCodec()
+	}
+	if w.headerWritten {
+		return nil
+	}
+	if w.frames == 0 {
+		if err := w.checkSeekable(); err != nil {
+			return err
+		}
+		if err := w.writeMetadata(); err != nil {
+			return err
+		}
+	}
+	if w.checksumInterval > 0 && w.cumulative == nil {
+		w.cumulative = xxHash32.New(0)
+		if err := w.writeChecksumFrame(); err != nil {
+			return err
+		}
+	}
+	if err := w.alignOutput(); err != nil {
+		return err
+	}
+	if err := w.alignPart(); err != nil {
+		return err
+	}
+	if err := writeFrameHeader(w.dst, w.frameFlags(), w.blockDescriptor(), uint64(w.contentSize), w.dictID); err != nil {
+		w.err = err
+		return err
+	}
+	w.headerWritten = true
+	w.blocksInFrame = 0
+	if w.contentChecksum {
+		w.content = newXXH32()
+	}
+	return nil
 }
 
-func (w *Writer) Write(p []byte) (int, error) {
+func (w *Writer) writeBlock(src, compressed []byte) error {
+	if h := w.blockHash(); h != nil && w.partSize == 0 {
+		// Hash the block while it compresses
+		defer func(done <-chan struct{}) { <-done }(hashAsync(h, src))
+	}
 
-	if !w.headerWritten {
-		if err := WriteFrameHeader(w.dst); err != nil {
-			return 0, err
+	w.pool.acquire()
+	start := time.Now()
+	n, err := w.compress(src, compressed)
+	elapsed := time.Since(start)
+	w.pace(len(src), elapsed)
+	w.pool.release()
+	if err != nil {
+		return err
+	}
+	w.adapt(len(src), n, elapsed)
+	return w.emitBlock(src, compressed[:n])
+}
+
+// emitBlock writes compressed, the block compressed from src, or src itself
+// if that is not larger.
+func (w *Writer) emitBlock(src, compressed []byte) error {
+	frames := w.frames
+	n := len(compressed)
+	// Like the reference encoder, store the block as is when compressing
+	// does not make it smaller
+	block, size := compressed, uint32(n)
+	raw := n >= len(src)
+	if raw {
+		block, size = src, uint32(len(src))|0x80000000
+	}
+
+	// The size and the checksum are staged in w.word, as local buffers
+	// would escape to the heap through w.dst
+	sizeBuf, sum := w.word[:4], w.word[4:4]
+	if w.blockChecksum {
+		sum = binary.LittleEndian.AppendUint32(sum, xxHash32.Checksum(block, 0))
+	}
+	if err := w.fitPart(4 + len(block) + len(sum)); err != nil {
+		return err
+	}
+	if w.linked && w.frames != frames {
+		// The block moved to a new frame, whose blocks cannot reference
+		// those of the last one
+		n, err := w.compress(src, compressed[:cap(compressed)])
+		if err != nil {
+			return err
+		}
+		return w.emitBlock(src, compressed[:n])
+	}
+	if w.partSize != 0 {
+		// The block may have moved to a new frame, so only now can it be
+		// added to the checksums of its frame
+		if h := w.blockHash(); h != nil {
+			h.Write(src)
 		}
-		w.headerWritten = true
+	}
+	offset := w.dst.n
+	if w.seekable {
+		w.seekIndex = append(w.seekIndex, seekEntry{compressed: offset, uncompressed: w.consumed})
+	}
+	binary.LittleEndian.PutUint32(sizeBuf, size)
+	if _, err := w.dst.Write(sizeBuf); err != nil {
+		return err
+	}
+
+	if _, err := w.dst.Write(block); err != nil {
+		return err
+	}
+	if _, err := w.dst.Write(sum); err != nil {
+		return err
+	}
+	w.blocksInFrame++
+	w.consumed += int64(len(src))
+	w.stats.countBlock(len(src), n, len(block), raw)
+	w.dst.countBlock(len(block), len(src))
+	w.checksumBlocks++
+	w.sinceChecksum++
+	if w.parity != nil {
+		w.parity.add(offset, sizeBuf, block, sum)
+	}
+	return nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.codec != nil && w.err == nil {
+		return w.writeCodec(p)
+	}
+	if err := w.WriteHeader(); err != nil {
+		return 0, err
+	}
+	if err := w.checkContentSize(len(p)); err != nil {
+		w.err = err
+		return 0, err
 	}
 
 	totalWritten := 0
 	for len(p) > 0 {
-		chunkSize := w.blockSize
-		if chunkSize > len(p) {
-			chunkSize = len(p)
+		if len(w.pending) == 0 && len(p) >= w.blockSize {
+			// Whole blocks are compressed straight from p
+			var err error
+			if w.parallel() {
+				err = w.queueBlock(append(w.inputBuffer(), p[:w.blockSize]...))
+			} else {
+				err = w.putBlock(p[:w.blockSize])
+			}
+			if err != nil {
+				return totalWritten, err
+			}
+			totalWritten += w.blockSize
+			p = p[w.blockSize:]
+			continue
+		}
+
+		if w.pending == nil {
+			w.pending = w.inputBuffer()
+		}
+		chunkSize := min(len(p), w.blockSize-len(w.pending))
+		w.pending = append(w.pending, p[:chunkSize]...)
+		totalWritten += chunkSize
+		p = p[chunkSize:]
+		if len(w.pending) >= w.blockSize {
+			if err := w.putPending(); err != nil {
+				return totalWritten, err
+			}
 		}
+	}
+
+	return totalWritten, nil
+}
 
-		worstCaseSize := chunkSize + (chunkSize / 255) + 16
-		compressed := make([]byte, worstCaseSize)
-		n, err := compressBlock(p[:chunkSize], compressed, w.hashTable)
+// ReadFrom compresses everything read from src until io.EOF, reading it
+// straight into the block buffer rather than through an intermediate one,
+// and returns the number of bytes read. It is used by io.Copy.
+func (w *Writer) ReadFrom(src io.Reader) (int64, error) {
+	if w.codec != nil && w.err == nil {
+		// Hide ReadFrom so the copy goes through Write
+		return io.Copy(struct{ io.Writer }{w}, src)
+	}
+	if err := w.WriteHeader(); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for {
+		if w.pending == nil {
+			w.pending = w.inputBuffer()
+		}
+		n, err := src.Read(w.pending[len(w.pending):w.blockSize])
+		if n > 0 {
+			if err := w.checkContentSize(n); err != nil {
+				w.err = err
+				return total, err
+			}
+			w.pending = w.pending[:len(w.pending)+n]
+			total += int64(n)
+			if len(w.pending) >= w.blockSize {
+				if err := w.putPending(); err != nil {
+					return total, err
+				}
+			}
+		}
+		if err == io.EOF {
+			return total, nil
+		}
 		if err != nil {
-			return totalWritten, err
+			return total, err
 		}
+	}
+}
+
+// putPending compresses the buffered input, if any, as the next block.
+func (w *Writer) putPending() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	src := w.pending
+	w.pending = nil
+	if w.parallel() {
+		// The block takes over the buffer
+		return w.queueBlock(src)
+	}
+	err := w.putBlock(src)
+	w.pending = src[:0]
+	return err
+}
+
+// inputBuffer returns an empty buffer for a block of input, reusing the one
+// a finished background block handed back if possible.
+func (w *Writer) inputBuffer() []byte {
+	if b := w.spare; cap(b) >= w.blockSize {
+		w.spare = nil
+		return b[:0]
+	}
+	// Leave room for the scratch buffer under a memory limit
+	return getBufferReserving(w.buffers, w.blockSize, compressBound(w.blockSize))[:0]
+}
 
-		var sizeBuf [4]byte
-		binary.LittleEndian.PutUint32(sizeBuf[:], uint32(n))
-		if _, err := w.dst.Write(sizeBuf[:]); err != nil {
-			return totalWritten, err
+// compressBuffer returns room for compressing a block of n bytes. Without a
+// memory limit the Writer keeps one buffer for the worst case of a whole
+// block, so that compressing allocates nothing once it is warmed up; under
+// a limit the buffer comes from the pool and has to be handed back.
+func (w *Writer) compressBuffer(n int) []byte {
+	bound := compressBound(n)
+	if w.budget != nil {
+		return getBuffer(w.buffers, bound)
+	}
+	if cap(w.compressed) < bound {
+		if w.compressed != nil {
+			w.buffers.Put(w.compressed)
 		}
+		w.compressed = w.buffers.Get(compressBound(max(n, w.blockSize)))
+	}
+	return w.compressed[:bound]
+}
+
+// releasePending drops the content of the pending block and keeps its
+// buffer as the spare one, or hands it back under a memory limit.
+func (w *Writer) releasePending() {
+	switch {
+	case w.pending == nil:
+		return
+	case w.budget == nil && w.spare == nil:
+		w.spare = w.pending[:0]
+	default:
+		w.buffers.Put(w.pending)
+	}
+	w.pending = nil
+}
+
+// putBlock compresses src and writes it as the next block.
+func (w *Writer) putBlock(src []byte) error {
+	if err := w.beginBlock(); err != nil {
+		return err
+	}
+	compressed := w.compressBuffer(len(src))
+	err := w.writeBlock(src, compressed)
+	if w.budget != nil {
+		w.buffers.Put(compressed)
+	}
+	if err != nil {
+		w.err = err
+		return err
+	}
+	return w.endBlock()
+}
 
-		if _, err := w.dst.Write(compressed[:n]); err != nil {
-			return totalWritten, err
+// beginBlock starts the frame the next block goes into: a new one if every
+// block gets its own, otherwise the current one.
+func (w *Writer) beginBlock() error {
+	if w.alignment > 0 && w.blocksInFrame > 0 {
+		if err := w.endFrame(); err != nil {
+			return err
 		}
+	}
+	return w.WriteHeader()
+}
 
-		totalWritten += chunkSize
-		p = p[chunkSize:]
+// endBlock ends the frame after a block that completes a checksum
+// interval.
+func (w *Writer) endBlock() error {
+	if w.checksumInterval > 0 && w.sinceChecksum >= w.checksumInterval {
+		return w.endFrame()
 	}
+	return nil
+}
 
-	return totalWritten, nil
+// compressBound returns the largest size a block of n bytes can compress
+// to.
+func compressBound(n int) int {
+	return n + n/255 + 16
 }
 
-func (w *Writer) Close() error {
+// WriteString compresses the bytes of s without copying them into a []byte
+// first. This is safe because Write neither modifies nor retains p.
+func (w *Writer) WriteString(s string) (int, error) {
+	return w.Write(unsafe.Slice(unsafe.StringData(s), len(s)))
+}
+
+// Flush makes everything written so far decodable by the peer without
+// ending the frame: the header, the partial block buffered by Write and any
+// blocks queued by WithConcurrency are written, and the underlying writer is
+// flushed if it supports it, as bufio.Writer and http.ResponseWriter do.
+// Every Flush of a partial block costs compression ratio, so it suits
+// protocols where latency matters more than block fill.
+func (w *Writer) Flush() error {
+	if err := w.drain(); err != nil {
+		return err
+	}
+	if err := w.WriteHeader(); err != nil {
+		return err
+	}
+	var err error
+	switch f := w.dst.w.(type) {
+	case interface{ Flush() error }:
+		err = f.Flush()
+	case interface{ Flush() }:
+		f.Flush()
+	}
+	if err != nil {
+		w.err = err
+	}
+	return err
+}
+
+// EndFrame terminates the current frame. The next Write or BeginFrame starts
+// a new frame, so a single stream can hold several independently decodable
+// frames.
+func (w *Writer) EndFrame() error {
+	if err := w.drain(); err != nil {
+		return err
+	}
+	return w.endFrame()
+}
+
+func (w *Writer) endFrame() error {
+	if err := w.WriteHeader(); err != nil {
+		return err
+	}
+	if w.contentSize >= 0 && w.frames == 0 && w.consumed != w.contentSize {
+		w.err = &SizeMismatchError{Expected: w.contentSize, Actual: w.consumed}
+		return w.err
+	}
+	if err := WriteFrameEndMark(w.dst); err != nil {
+		w.err = err
+		return err
+	}
+	if err := w.writeContentChecksum(); err != nil {
+		w.err = err
+		return err
+	}
+	w.headerWritten = false
+	w.frames++
+	if w.cumulative != nil {
+		return w.writeChecksumFrame()
+	}
+	return nil
+}
+
+// BeginFrame ends the current frame, if any, and writes the header of a new
+// one.
+func (w *Writer) BeginFrame() error {
+	if err := w.drain(); err != nil {
+		return err
+	}
+	if w.headerWritten {
+		if err := w.endFrame(); err != nil {
+			return err
+		}
+	}
+	return w.WriteHeader()
+}
 
-	if !w.headerWritten {
-		if err := WriteFrameHeader(w.dst); err != nil {
+// Close ends the current frame and writes the section index, if any, which
+// completes the stream. Once any call on the Writer has failed, the first
+// error is returned by every later Write and by Close, and nothing more is
+// written to the underlying writer. Close may be called more than once; the
+// later calls return the result of the first, and Write after Close fails
+// with ErrClosed.
+func (w *Writer) Close() error {
+	if w.closed {
+		if w.err == ErrClosed {
+			return nil
+		}
+		return w.err
+	}
+	w.closed = true
+	defer w.releasePending()
+	if w.err != nil {
+		return w.err
+	}
+	if w.codec != nil {
+		return w.closeCodec()
+	}
+	if err := w.drain(); err != nil {
+		return err
+	}
+	if w.headerWritten || w.frames == 0 {
+		if err := w.endFrame(); err != nil {
 			return err
 		}
-		w.headerWritten = true
 	}
+	if err := w.writeDigest(); err != nil {
+		w.err = err
+		return err
+	}
+	if err := w.writeParity(); err != nil {
+		w.err = err
+		return err
+	}
+	if err := w.writeSeekIndex(); err != nil {
+		w.err = err
+		return err
+	}
+	if err := w.writeSectionIndex(); err != nil {
+		w.err = err
+		return err
+	}
+	w.err = ErrClosed
+	return nil
+}
 
-	return WriteFrameEndMark(w.dst)
+// CloseWithError stops the Writer without completing the stream: the
+// output keeps what was already written, but the current frame gets no end
+// mark and no section index is written, so decoders fail with
+// io.ErrUnexpectedEOF instead of accepting truncated data. Every later call,
+// including Close, returns err, or ErrAborted if err is nil. It has no
+// effect on a closed Writer.
+func (w *Writer) CloseWithError(err error) {
+	if w.closed {
+		return
+	}
+	w.closed = true
+	if err == nil {
+		err = ErrAborted
+	}
+	if w.err == nil {
+		w.err = err
+	}
+	w.drain()
+	w.releasePending()
+}
+
+// Abort is CloseWithError(ErrAborted).
+func (w *Writer) Abort() {
+	w.CloseWithError(ErrAborted)
 }
 
 func NewReader(src io.Reader) *Reader {
 	return &Reader{
-		src:        src,
+		src:        NewCountingReader(src),
 		blockSize:  defaultBlockSize,
-		buffer:     make([]byte, maxBlockSize),
+		buffers:    heapPool{},
 		headerRead: false,
+		expected:   -1,
 	}
 }
 
-func decompressBlock(src, dst []byte) (int, error) {
+// NewReaderN returns a Reader for a stream known to decompress to exactly
+// expected bytes. If it turns out shorter or longer, Read fails with a
+// *SizeMismatchError instead of io.EOF, and never returns bytes past
+// expected.
+func NewReaderN(src io.Reader, expected int64) *Reader {
+	r := NewReader(src)
+	r.expected = expected
+	return r
+}
+
+func decompressBlock(src, dst []byte, minMatch int) (int, error) {
+	return decompressBlockDict(src, dst, nil, minMatch)
+}
+
+// decompressBlockDict decompresses a block whose matches may reach back
+// into dict, the data preceding the block.
+//
+// Bounds are checked as remaining space, e.g. litLen > srcLen-srcPos
+// rather than srcPos+litLen > srcLen, so that no sum can overflow, and
+// length extensions stop accumulating as soon as they exceed what is left
+// of the source or the destination.
+func decompressBlockDict(src, dst, dict []byte, minMatch int) (int, error) {
 	srcLen := len(src)
 	dstLen := len(dst)
 	srcPos := 0
@@ -268,16 +1037,19 @@ func decompressBlock(src, dst []byte) (int, error) {
 				b := src[srcPos]
 				srcPos++
 				litLen += int(b)
+				if litLen > srcLen-srcPos {
+					return dstPos, io.ErrUnexpectedEOF
+				}
 				if b != 255 {
 					break
 				}
 			}
 		}
 
-		if srcPos+litLen > srcLen {
+		if litLen > srcLen-srcPos {
 			return dstPos, io.ErrUnexpectedEOF
 		}
-		if dstPos+litLen > dstLen {
+		if litLen > dstLen-dstPos {
 			return dstPos, ErrBlockTooLarge
 		}
 		if litLen > 0 {
@@ -290,12 +1062,12 @@ func decompressBlock(src, dst []byte) (int, error) {
 			break
 		}
 
-		if srcPos+2 > srcLen {
+		if srcLen-srcPos < 2 {
 			return dstPos, io.ErrUnexpectedEOF
 		}
 		offset := int(binary.LittleEndian.Uint16(src[srcPos:]))
 		srcPos += 2
-		if offset == 0 || offset > dstPos {
+		if offset == 0 || offset > dstPos+len(dict) {
 			return dstPos, ErrCorrupted
 		}
 
@@ -308,19 +1080,28 @@ func decompressBlock(src, dst []byte) (int, error) {
 				b := src[srcPos]
 				srcPos++
 				matchLen += int(b)
+				if matchLen > dstLen-dstPos {
+					return dstPos, ErrBlockTooLarge
+				}
 				if b != 255 {
 					break
 				}
 			}
 		}
-		matchLen += minMatchLength
+		matchLen += minMatch
 
-		if dstPos+matchLen > dstLen {
+		if matchLen > dstLen-dstPos {
 			return dstPos, ErrBlockTooLarge
 		}
 		ref := dstPos - offset
 		if ref < 0 {
-			return dstPos, ErrCorrupted
+			// The match starts in the dictionary and may continue into
+			// the block
+			n := copy(dst[dstPos:dstPos+min(matchLen, -ref)], dict[len(dict)+ref:])
+			dstPos += n
+			matchLen -= n
+			ref = 0
+			offset = dstPos
 		}
 
 		if offset >= matchLen {
@@ -338,18 +1119,364 @@ func decompressBlock(src, dst []byte) (int, error) {
 	return dstPos, nil
 }
 
+// readUint32 reads a little-endian 32-bit field of the frame into r.word,
+// since a local buffer would escape to the heap through r.src.
+func (r *Reader) readUint32() (uint32, error) {
+	if _, err := io.ReadFull(r.src, r.word[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(r.word[:]), nil
+}
+
+func (r *Reader) releaseLeftover() {
+	r.waitHash()
+	if r.leftoverBuf != nil {
+		r.putBlockBuffer(r.leftoverBuf)
+		r.leftoverBuf = nil
+	}
+	r.leftover = nil
+	r.leftoverPos = 0
+}
+
+// startFrame prepares for the blocks of the frame described by header,
+// sizing the block buffers to its maximum block size.
+func (r *Reader) startFrame(header *DecodedFrameHeader) error {
+	r.header = header
+	r.frameSize = 0
+	r.frameRead = false
+	r.blockSize = int(header.BlockMaxSize)
+	if header.Magic == legacyMagic {
+		// Room for a compressed block as well
+		r.blockSize = int(legacyBound)
+	}
+	if len(r.buffer) < r.blockSize {
+		if r.buffer != nil {
+			r.buffers.Put(r.buffer)
+		}
+		if r.budget == nil {
+			r.buffer = r.getBlockBuffer()
+		} else {
+			// Compressed blocks are held while they decode into a second
+			// buffer
+			r.buffer = getBufferReserving(r.buffers, r.blockSize, r.blockSize)
+		}
+	}
+	r.checksum = nil
+	if header.ContentChecksumFlag {
+		r.checksum = xxHash32.New(0)
+	}
+	return r.loadDictionary(header)
+}
+
+// atEndMark finishes the frame whose end mark was just read and starts the
+// next one, reporting whether there is one.
+func (r *Reader) atEndMark() (bool, error) {
+	if err := r.endFrame(); err != nil {
+		return false, err
+	}
+	if r.cumulative != nil {
+		return r.nextFrame()
+	}
+	if r.singleFrame {
+		return false, nil
+	}
+	header, err := r.readNextHeader()
+	if header == nil || err != nil {
+		return false, err
+	}
+	return true, r.startFrame(header)
+}
+
+// endFrame reads and verifies the content checksum that follows the end
+// mark of a frame that has one.
+func (r *Reader) endFrame() error {
+	r.waitHash()
+	if r.checksContentSize() && uint64(r.frameSize) != r.header.ContentSize {
+		return &SizeMismatchError{Expected: int64(r.header.ContentSize), Actual: r.frameSize}
+	}
+	if !r.header.ContentChecksumFlag {
+		return nil
+	}
+	stored, err := r.readUint32()
+	if err != nil {
+		return noEOF(err)
+	}
+	if r.checksum == nil {
+		return nil
+	}
+	if computed := r.checksum.Sum32(); stored != computed {
+		return &ChecksumMismatchError{Stored: stored, Computed: computed}
+	}
+	return nil
+}
+
+// Close reads and discards the rest of the frame, so that a caller who only
+// read a prefix still learns whether the stream is intact: decode errors, a
+// missing end mark and a content checksum mismatch are all reported. It then
+// releases the Reader's buffers. Close may be called more than once; later
+// calls return the result of the first, and Read after Close fails with
+// ErrClosed.
+func (r *Reader) Close() error {
+	if r.closed {
+		if r.err == ErrClosed {
+			return nil
+		}
+		return r.err
+	}
+	r.closed = true
+
+	if r.err == nil && !r.eof {
+		buf := make([]byte, 64*1024)
+		for {
+			if _, err := r.Read(buf); err != nil {
+				break
+			}
+		}
+	}
+	r.dropBlocks()
+	r.releaseLeftover()
+	if r.buffer != nil {
+		r.buffers.Put(r.buffer)
+		r.buffer = nil
+	}
+	r.releaseSpares()
+	if r.err != nil {
+		return r.err
+	}
+	r.err = ErrClosed
+	return nil
+}
+
+func (r *Reader) finish() {
+	r.waitHash()
+	r.eof = true
+	// Kept for the next stream if the Reader is Reset
+	r.putBlockBuffer(r.buffer)
+	r.buffer = nil
+}
+
+// getBlockBuffer returns a buffer for a block of the current frame, reusing
+// a spare one if possible.
+func (r *Reader) getBlockBuffer() []byte {
+	for len(r.spares) > 0 {
+		b := r.spares[len(r.spares)-1]
+		r.spares = r.spares[:len(r.spares)-1]
+		if cap(b) >= r.blockSize {
+			return b[:r.blockSize]
+		}
+		r.buffers.Put(b)
+	}
+	return getBuffer(r.buffers, r.blockSize)
+}
+
+// putBlockBuffer keeps b, if not nil, for a later block. Under a memory limit
+// it is handed back to the pool right away, so other consumers can use it.
+func (r *Reader) putBlockBuffer(b []byte) {
+	switch {
+	case b == nil:
+	case r.budget == nil && len(r.spares) < 2*max(r.concurrency, 1):
+		r.spares = append(r.spares, b)
+	default:
+		r.buffers.Put(b)
+	}
+}
+
+// releaseSpares hands the spare block buffers back to the pool.
+func (r *Reader) releaseSpares() {
+	for _, b := range r.spares {
+		r.buffers.Put(b)
+	}
+	r.spares = nil
+}
+
+// Read decompresses into p. Once a read fails, the same error is returned
+// by every later call, since the position in the stream is lost; a stream
+// that ends early fails with io.ErrUnexpectedEOF, which also matches
+// ErrMissingEndMark when the stream ends between blocks.
 func (r *Reader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.read(p)
+	r.delivered += int64(n)
+	if r.expected >= 0 {
+		n, err = r.checkSize(n, err)
+	}
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *Reader) checkSize(n int, err error) (int, error) {
+	if excess := r.delivered - r.expected; excess > 0 {
+		return n - int(excess), &SizeMismatchError{Expected: r.expected, Actual: r.delivered}
+	}
+	if err == io.EOF && r.delivered < r.expected {
+		return n, &SizeMismatchError{Expected: r.expected, Actual: r.delivered}
+	}
+	return n, err
+}
+
+// ReadByte returns the next decompressed byte. It is served straight from
+// the current block, so the Reader can back byte-oriented decoders such as
+// binary.ReadUvarint without a bufio.Reader in between.
+func (r *Reader) ReadByte() (byte, error) {
+	if r.err == nil && r.leftoverPos < len(r.leftover) && (r.expected < 0 || r.delivered < r.expected) {
+		b := r.leftover[r.leftoverPos]
+		r.leftoverPos++
+		r.delivered++
+		if r.leftoverPos == len(r.leftover) {
+			r.releaseLeftover()
+		}
+		return b, nil
+	}
+
+	var b [1]byte
+	for {
+		// Read returns no data at a frame boundary; keep going until a byte
+		// or an error arrives
+		n, err := r.Read(b[:])
+		if n == 1 {
+			return b[0], nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// WriteTo writes the decompressed stream to dst until its end, handing dst
+// each block as it is decoded instead of copying it through a caller's
+// buffer, and returns the number of bytes written. It is used by io.Copy.
+// Errors from dst are returned without failing the Reader, which keeps
+// what dst did not take for the next call.
+func (r *Reader) WriteTo(dst io.Writer) (int64, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.codec != nil || r.expected >= 0 {
+		// Hide WriteTo so the copy goes through Read
+		return io.Copy(dst, struct{ io.Reader }{r})
+	}
+
+	var total int64
+	if r.leftoverPos < len(r.leftover) {
+		n, err := dst.Write(r.leftover[r.leftoverPos:])
+		r.leftoverPos += n
+		r.delivered += int64(n)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+		r.releaseLeftover()
+	}
+	if !r.eof && !r.headerRead {
+		if err := r.readHeader(); err != nil {
+			if err == io.EOF {
+				return total, nil
+			}
+			r.err = err
+			return total, err
+		}
+	}
+	for !r.eof {
+		data, decompressed, err := r.nextData(nil)
+		if err != nil {
+			r.err = err
+			return total, err
+		}
+		if r.eof {
+			break
+		}
+		n, err := dst.Write(data)
+		r.delivered += int64(n)
+		total += int64(n)
+		if err != nil {
+			if n < len(data) {
+				r.leftover, r.leftoverBuf, r.leftoverPos = data, decompressed, n
+			} else {
+				r.putBlockBuffer(decompressed)
+			}
+			return total, err
+		}
+		if decompressed != nil && r.hashing != nil {
+			r.hashingBuf = decompressed
+		} else {
+			r.putBlockBuffer(decompressed)
+		}
+	}
+	return total, nil
+}
+
+// readHeader reads the header of the first frame, unless ReadHeader has,
+// and prepares for its blocks.
+func (r *Reader) readHeader() error {
+	if r.header == nil {
+		header, err := r.readFirstHeader()
+		if err != nil {
+			return err
+		}
+		r.header = header
+	}
+
+	if err := r.startFrame(r.header); err != nil {
+		return err
+	}
+	r.headerRead = true
+	return nil
+}
+
+// ReadHeader reads the header of the first frame from the source right
+// away, so that Header and Size can describe the stream before any data is
+// decoded. Options can still be applied until the first Read, for instance
+// WithDictionary for the DictID of the header. Calling it after the header
+// has been read is a no-op, and an error reading it is returned again by
+// every later Read.
+func (r *Reader) ReadHeader() error {
+	if r.header != nil || r.codec != nil {
+		return nil
+	}
+	if r.err != nil {
+		return r.err
+	}
+	header, err := r.readFirstHeader()
+	if err != nil {
+		if err != io.EOF {
+			r.err = err
+		}
+		return err
+	}
+	r.header = header
+	return nil
+}
+
+// Header returns the header of the current frame, reading the header of
+// the first frame if Read has not yet. It is nil for a stream of another
+// codec. The header changes as Read moves on to the frames concatenated
+// after the first one.
+func (r *Reader) Header() (*DecodedFrameHeader, error) {
+	if err := r.ReadHeader(); err != nil {
+		return nil, err
+	}
+	if r.header == nil {
+		return nil, r.err
+	}
+	return r.header, nil
+}
+
+func (r *Reader) read(p []byte) (int, error) {
 	if r.eof {
 		return 0, io.EOF
 	}
+	if r.codec != nil {
+		return r.readCodec(p)
+	}
 
 	if !r.headerRead {
-		_, err := ReadFrameHeader(r.src)
-		if err != nil {
+		if err := r.readHeader(); err != nil {
 			return 0, err
 		}
-
-		r.headerRead = true
 	}
 
 	totalRead := 0
@@ -364,8 +1491,7 @@ func (r *Reader) Read(p []byte) (int, error) {
 		r.leftoverPos += toCopy
 
 		if r.leftoverPos >= len(r.leftover) {
-			r.leftover = nil
-			r.leftoverPos = 0
+			r.releaseLeftover()
 		}
 
 		if totalRead >= len(p) {
@@ -373,48 +1499,20 @@ func (r *Reader) Read(p []byte) (int, error) {
 		}
 	}
 
-	for totalRead < len(p) && !r.eof {
-
-		var sizeBuf [4]byte
-		if _, err := io.ReadFull(r.src, sizeBuf[:]); err != nil {
-			if err == io.EOF && totalRead > 0 {
-				break
-			}
+	// Stop after the first block that yields data rather than waiting for
+	// more input, so a peer's flushed blocks are delivered immediately
+	for totalRead == 0 && len(p) > 0 && !r.eof {
+		data, decompressed, err := r.nextData(p[totalRead:])
+		if err != nil {
 			return totalRead, err
 		}
-
-		compressedSize := binary.LittleEndian.Uint32(sizeBuf[:])
-
-		if compressedSize == 0 {
-			r.eof = true
+		if r.eof {
 			break
 		}
-
-		uncompressed := (compressedSize & 0x80000000) != 0
-		if uncompressed {
-			compressedSize &^= 0x80000000
-		}
-
-		if compressedSize > uint32(len(r.buffer)) {
-			return totalRead, ErrBlockTooLarge
-		}
-
-		if _, err := io.ReadFull(r.src, r.buffer[:compressedSize]); err != nil {
-			return totalRead, err
-		}
-
-		var data []byte
-		if uncompressed {
-
-			data = r.buffer[:compressedSize]
-		} else {
-
-			decompressed := make([]byte, r.blockSize)
-			n, err := decompressBlock(r.buffer[:compressedSize], decompressed)
-			if err != nil {
-				return totalRead, err
-			}
-			data = decompressed[:n]
+		if len(data) > 0 && &data[0] == &p[totalRead] {
+			// Decoded in place
+			totalRead += len(data)
+			break
 		}
 
 		toCopy := len(data)
@@ -423,6 +1521,7 @@ func (r *Reader) Read(p []byte) (int, error) {
 			toCopy = remaining
 
 			r.leftover = data[toCopy:]
+			r.leftoverBuf = decompressed
 			r.leftoverPos = 0
 		}
 
@@ -433,49 +1532,199 @@ func (r *Reader) Read(p []byte) (int, error) {
 
 			break
 		}
+		if decompressed != nil && r.hashing != nil {
+			r.hashingBuf = decompressed
+		} else {
+			r.putBlockBuffer(decompressed)
+		}
 	}
 
 	return totalRead, nil
 }
 
-func CompressStream(src io.Reader, dst io.Writer) error {
-	w := NewWriter(dst)
-	defer w.Close()
-
-	buf := make([]byte, 64*1024)
+// nextData decodes blocks until one yields data, which it returns along with
+// the buffer holding it if that has to be released. A compressed block is
+// decoded straight into dst if dst can hold any block of the frame. At the
+// end of the stream it returns no data and sets r.eof.
+func (r *Reader) nextData(dst []byte) (data, decompressed []byte, err error) {
 	for {
-		n, err := src.Read(buf)
-		if n > 0 {
-			if _, err := w.Write(buf[:n]); err != nil {
-				return err
+		direct := false
+		stored := 0
+		if r.pendingErr != nil {
+			return nil, nil, r.pendingErr
+		}
+		// Recovery stops where the input ends
+		if r.eof {
+			return nil, nil, nil
+		}
+
+		// The block is read into the buffer the last one may still be
+		// hashed from
+		r.waitHash()
+		if r.parallel() {
+			b, err := r.nextBlock()
+			if err != nil {
+				return nil, nil, err
+			}
+			if b == nil {
+				more, err := r.atEndMark()
+				if err != nil {
+					return nil, nil, err
+				}
+				if more {
+					continue
+				}
+				r.finish()
+				return nil, nil, nil
+			}
+			data, decompressed, stored = b.data, b.buf, b.size
+		} else {
+			blockStart := r.src.n
+			legacy := r.header.Magic == legacyMagic
+			var compressedSize uint32
+			var err error
+			if legacy {
+				compressedSize, err = r.readLegacySize()
+				err = noEOF(err)
+			} else {
+				compressedSize, err = r.readUint32()
+				err = noEndMark(err)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			sizeField := r.word
+
+			if compressedSize == 0 {
+				more, err := r.atEndMark()
+				if err != nil {
+					return nil, nil, err
+				}
+				if more {
+					continue
+				}
+				r.finish()
+				return nil, nil, nil
+			}
+
+			// Legacy blocks are always compressed, and may grow past the
+			// maximum block size
+			uncompressed := !legacy && (compressedSize&0x80000000) != 0
+			if uncompressed {
+				compressedSize &^= 0x80000000
+			}
+
+			if !legacy && compressedSize > r.header.BlockMaxSize {
+				if r.recovery != nil {
+					if err := r.resync(blockStart, ErrBlockTooLarge, r.corruptBlock(sizeField, nil)); err != nil {
+						return nil, nil, err
+					}
+					continue
+				}
+				return nil, nil, ErrBlockTooLarge
+			}
+
+			if n, err := io.ReadFull(r.src, r.buffer[:compressedSize]); err != nil {
+				if !r.partial || err != io.ErrUnexpectedEOF {
+					return nil, nil, err
+				}
+				// Salvage what the truncated block still decodes to
+				compressedSize = uint32(n)
+				r.pendingErr = err
+			} else if err := r.checkBlock(r.buffer[:compressedSize]); err != nil {
+				if r.recovery != nil {
+					if err := r.resync(blockStart, err, r.corruptBlock(sizeField, r.buffer[:compressedSize])); err != nil {
+						return nil, nil, err
+					}
+					continue
+				}
+				return nil, nil, err
+			}
+
+			stored = int(compressedSize)
+			if uncompressed {
+				data = r.buffer[:compressedSize]
+			} else {
+				// A block may not decode to more than the frame's maximum
+				out := dst
+				direct = len(out) >= r.blockSize
+				if direct {
+					out = out[:r.blockSize]
+				} else {
+					decompressed = r.getBlockBuffer()
+					out = decompressed
+				}
+				r.pool.acquire()
+				n, err := decompressBlockDict(r.buffer[:compressedSize], out, r.dict, minMatchLength)
+				r.pool.release()
+				if err != nil && r.partial && r.recovery == nil {
+					// Deliver the bytes decoded before the error, then the error
+					if r.pendingErr == nil {
+						r.pendingErr = err
+					}
+					err = nil
+				}
+				if err != nil {
+					r.putBlockBuffer(decompressed)
+					if r.recovery != nil {
+						if err := r.resync(blockStart, err, r.corruptBlock(sizeField, r.buffer[:compressedSize])); err != nil {
+							return nil, nil, err
+						}
+						continue
+					}
+					return nil, nil, err
+				}
+				data = out[:n]
 			}
 		}
-		if err == io.EOF {
-			break
+		if err := r.addFrameSize(len(data)); err != nil {
+			r.putBlockBuffer(decompressed)
+			return nil, nil, err
 		}
-		if err != nil {
-			return err
+		r.src.countBlock(stored, len(data))
+		if !r.header.BlocksIndependentFlag {
+			// The next block may reference the end of this one
+			r.window = slideWindow(r.window, r.dict, data)
+			r.dict = r.window
+		}
+		if h := r.blockHash(); h != nil {
+			if direct {
+				// The caller owns dst as soon as the block is returned
+				h.Write(data)
+			} else {
+				// Hash the block while the caller consumes it
+				r.hashing = hashAsync(h, data)
+			}
+		}
+		if r.cumulative != nil {
+			r.checksumBlocks++
+			r.checksumSize += int64(len(data))
 		}
+
+		return data, decompressed, nil
 	}
-	return nil
 }
 
-func DecompressStream(src io.Reader, dst io.Writer) error {
+func CompressStream(src io.Reader, dst io.Writer, options ...Option) error {
+	w := NewWriter(dst)
+	if err := w.Apply(options...); err != nil {
+		return err
+	}
+
+	if _, err := w.ReadFrom(src); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// DecompressStream decompresses src into dst. If dst is an *os.File and
+// the frame declares its content size, the file is extended to it before
+// anything is written.
+func DecompressStream(src io.Reader, dst io.Writer, options ...Option) error {
 	r := NewReader(src)
-	buf := make([]byte, 64*1024)
-	for {
-		n, err := r.Read(buf)
-		if n > 0 {
-			if _, err := dst.Write(buf[:n]); err != nil {
-				return err
-			}
-		}
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
+	if err := r.Apply(options...); err != nil {
+		return err
 	}
-	return nil
+	return copyDecompressed(r, dst)
 }
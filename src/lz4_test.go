@@ -0,0 +1,259 @@
+package lz4_test
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	lz4 "rzstd/src"
+	"rzstd/src/lz4test"
+)
+
+// TestFlush checks that Write buffers up to a full block and that Flush
+// makes a partial block readable, through a bufio.Writer, before the frame
+// ends.
+func TestFlush(t *testing.T) {
+	data := testInput(100 << 10)
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	w := lz4.NewWriter(bw)
+	if err := w.Apply(lz4.WithBlockSize(64 << 10)); err != nil {
+		t.Fatal(err)
+	}
+	written := 0
+	for _, end := range []int{1000, 1001, 90 << 10} {
+		if _, err := w.Write(data[written:end]); err != nil {
+			t.Fatal(err)
+		}
+		// Only full blocks are written before the Flush, each starting
+		// after the last flushed one
+		if err := bw.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		full := written + (end-written)/(64<<10)*(64<<10)
+		if got := len(decompressPrefix(t, buf.Bytes())); got != full {
+			t.Fatalf("before Flush at %d: %d bytes readable, want %d", end, got, full)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if got := decompressPrefix(t, buf.Bytes()); !bytes.Equal(got, data[:end]) {
+			t.Fatalf("after Flush at %d: %d bytes readable", end, len(got))
+		}
+		written = end
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); !errors.Is(err, lz4.ErrClosed) {
+		t.Errorf("Flush after Close = %v, want %v", err, lz4.ErrClosed)
+	}
+}
+
+// decompressPrefix returns what a Reader delivers from stream before it
+// runs out of input.
+func decompressPrefix(t *testing.T, stream []byte) []byte {
+	t.Helper()
+	got, err := io.ReadAll(lz4.NewReader(bytes.NewReader(stream)))
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestReadFromWriteTo(t *testing.T) {
+	data := testInput(300 << 10)
+	options := []lz4.Option{lz4.WithBlockSize(64 << 10), lz4.WithContentChecksum()}
+	want := compress(t, data, options...)
+
+	// ReadFrom fills whole blocks however the source splits its reads
+	var buf bytes.Buffer
+	w := lz4.NewWriter(&buf)
+	if err := w.Apply(options...); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := io.Copy(w, iotest.HalfReader(bytes.NewReader(data))); err != nil || n != int64(len(data)) {
+		t.Fatalf("ReadFrom = %d, %v", n, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Error("ReadFrom output differs from that of Write")
+	}
+
+	// WriteTo keeps what a failing destination did not take for the next
+	// call
+	r := lz4.NewReader(bytes.NewReader(want))
+	var out bytes.Buffer
+	dst := lz4test.FailWrites(100<<10, errFault, 1)(&out)
+	if _, err := r.WriteTo(dst); !errors.Is(err, errFault) {
+		t.Fatalf("WriteTo = %v, want %v", err, errFault)
+	}
+	if n, err := r.WriteTo(dst); err != nil || out.Len() != len(data) {
+		t.Fatalf("WriteTo after the failure = %d, %v; %d bytes in all", n, err, out.Len())
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Error("WriteTo output does not match the input")
+	}
+
+	// An error from the source of ReadFrom is returned as is
+	w = lz4.NewWriter(io.Discard)
+	if _, err := w.ReadFrom(io.MultiReader(bytes.NewReader(data), iotest.ErrReader(errFault))); !errors.Is(err, errFault) {
+		t.Errorf("ReadFrom of a failing source = %v, want %v", err, errFault)
+	}
+}
+
+// TestReaderAllocs checks that a reused Reader allocates nothing per block,
+// whether it decodes into its own buffers or straight into a large p: a
+// stream of four times as many blocks costs no more allocations.
+func TestReaderAllocs(t *testing.T) {
+	options := []lz4.Option{lz4.WithBlockSize(64 << 10), lz4.WithContentChecksum(), lz4.WithBlockChecksum()}
+	short, long := compress(t, testInput(1<<20), options...), compress(t, testInput(4<<20), options...)
+	br := bytes.NewReader(nil)
+	r := lz4.NewReader(br)
+	for _, size := range []int{4096, 1 << 20} {
+		p := make([]byte, size)
+		allocs := func(stream []byte) float64 {
+			return testing.AllocsPerRun(5, func() {
+				br.Reset(stream)
+				r.Reset(br)
+				for {
+					_, err := r.Read(p)
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+			})
+		}
+		if a, b := allocs(short), allocs(long); b > a {
+			t.Errorf("reads of %d bytes: %v allocations for 16 blocks, %v for 64", size, a, b)
+		}
+	}
+}
+
+// TestWriterAllocs checks that a reused Writer allocates nothing per block,
+// whatever the size of the writes.
+func TestWriterAllocs(t *testing.T) {
+	short, long := testInput(1<<20), testInput(4<<20)
+	w := lz4.NewWriter(io.Discard)
+	if err := w.Apply(lz4.WithBlockSize(64<<10), lz4.WithContentChecksum(), lz4.WithBlockChecksum()); err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{4096, 1 << 20} {
+		allocs := func(data []byte) float64 {
+			return testing.AllocsPerRun(5, func() {
+				w.Reset(io.Discard)
+				for p := data; len(p) > 0; p = p[min(size, len(p)):] {
+					if _, err := w.Write(p[:min(size, len(p))]); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+		if a, b := allocs(short), allocs(long); b > a {
+			t.Errorf("writes of %d bytes: %v allocations for 16 blocks, %v for 64", size, a, b)
+		}
+	}
+}
+
+// TestConcatenatedFrames decodes frames of different settings one after
+// another, with empty frames and a skippable frame between them.
+func TestConcatenatedFrames(t *testing.T) {
+	parts := []struct {
+		data    []byte
+		options []lz4.Option
+	}{
+		{testInput(100 << 10), []lz4.Option{lz4.WithBlockSize(64 << 10), lz4.WithContentChecksum()}},
+		{nil, nil},
+		{testInput(70 << 10), []lz4.Option{lz4.WithBlockSize(64 << 10), lz4.WithLinkedBlocks(), lz4.WithBlockChecksum()}},
+		{testInput(300 << 10), []lz4.Option{lz4.WithContentSize(300 << 10)}},
+	}
+	var stream, want []byte
+	for i, p := range parts {
+		stream = append(stream, compress(t, p.data, p.options...)...)
+		want = append(want, p.data...)
+		if i == 1 {
+			stream = append(stream, skippable(0xA, 3, []byte("abc"))...)
+		}
+	}
+	for _, concurrency := range []int{1, 4} {
+		if got := decompress(t, stream, lz4.WithConcurrency(concurrency)); !bytes.Equal(got, want) {
+			t.Errorf("concurrency %d: frames decode to %d bytes, want %d", concurrency, len(got), len(want))
+		}
+	}
+	r := lz4.NewReader(bytes.NewReader(stream))
+	for i, b := range want {
+		c, err := r.ReadByte()
+		if err != nil || c != b {
+			t.Fatalf("ReadByte %d = %q, %v, want %q", i, c, err, b)
+		}
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Errorf("ReadByte at the end = %v, want EOF", err)
+	}
+
+	// Data after the frames that is not a frame is ignored, as by the
+	// reference decoder, but a frame with a bad header is not
+	garbage := append(bytes.Clone(stream), "not a frame"...)
+	if got := decompress(t, garbage); !bytes.Equal(got, want) {
+		t.Errorf("frames followed by garbage decode to %d bytes, want %d", len(got), len(want))
+	}
+	bad := append(bytes.Clone(stream), compress(t, []byte("more"))...)
+	bad[len(stream)+6] ^= 1
+	if _, err := io.ReadAll(lz4.NewReader(bytes.NewReader(bad))); !errors.Is(err, lz4.ErrHeaderChecksum) {
+		t.Errorf("frame with a bad header after the others: Read = %v, want %v", err, lz4.ErrHeaderChecksum)
+	}
+}
+
+// TestReaderHeader reads the header of a frame before its data, supplies
+// the dictionary it names, and follows the header into the next frame. A
+// bad header is reported again by Read.
+func TestReaderHeader(t *testing.T) {
+	dict := testInput(10 << 10)
+	first, second := testInput(100<<10), testInput(1000)
+	stream := append(
+		compress(t, first, lz4.WithDictionary(9, dict), lz4.WithContentSize(int64(len(first)))),
+		compress(t, second, lz4.WithBlockSize(256<<10))...)
+
+	r := lz4.NewReader(bytes.NewReader(stream))
+	if err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+	h, err := r.Header()
+	if err != nil || !h.DictIDFlag || h.DictID != 9 || h.ContentSize != uint64(len(first)) {
+		t.Fatalf("Header = %+v, %v", h, err)
+	}
+	// The dictionary named by the header can still be supplied
+	if err := r.Apply(lz4.WithDictionary(h.DictID, dict)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(r, make([]byte, len(first)+1)); err != nil {
+		t.Fatal(err)
+	}
+	if h, err := r.Header(); err != nil || h.DictIDFlag || h.BlockMaxSize != 256<<10 {
+		t.Errorf("Header in the second frame = %+v, %v", h, err)
+	}
+
+	if err := lz4.NewReader(bytes.NewReader(nil)).ReadHeader(); err != io.EOF {
+		t.Errorf("ReadHeader of an empty stream = %v, want EOF", err)
+	}
+	bad := bytes.Clone(stream)
+	bad[4] ^= 0x80
+	r = lz4.NewReader(bytes.NewReader(bad))
+	if err := r.ReadHeader(); !errors.Is(err, lz4.ErrInvalidVersion) {
+		t.Fatalf("ReadHeader of a bad header = %v, want %v", err, lz4.ErrInvalidVersion)
+	}
+	if _, err := r.Read(make([]byte, 10)); !errors.Is(err, lz4.ErrInvalidVersion) {
+		t.Errorf("Read after a bad header = %v, want %v", err, lz4.ErrInvalidVersion)
+	}
+}
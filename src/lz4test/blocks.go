@@ -0,0 +1,60 @@
+package lz4test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	lz4 "rzstd/src"
+)
+
+// BlockVector is a hostile raw block aimed at one of the bounds checks of
+// the block decoder. Err is the error decoding Block into DstSize bytes must
+// fail with.
+type BlockVector struct {
+	Name    string
+	Block   []byte
+	DstSize int
+	Err     error
+}
+
+// Check decodes v.Block and returns an error unless it fails with v.Err.
+// A decoder that over-reads or overflows a length panics instead.
+func (v BlockVector) Check() error {
+	_, err := lz4.DecompressBlockMinMatch(v.Block, make([]byte, v.DstSize), 4)
+	if !errors.Is(err, v.Err) {
+		return fmt.Errorf("%s: got %v, want %v", v.Name, err, v.Err)
+	}
+	return nil
+}
+
+// AdversarialBlocks returns a vector for every bounds check of the block
+// decoder.
+func AdversarialBlocks() []BlockVector {
+	// A literal 'a' followed by a match of itself at offset 1
+	match := func(token byte) []byte { return []byte{token, 'a', 1, 0} }
+	run := func(prefix []byte, n int, end ...byte) []byte {
+		b := append(prefix, bytes.Repeat([]byte{255}, n)...)
+		return append(b, end...)
+	}
+
+	return []BlockVector{
+		{"truncated literal length", []byte{0xF0}, 64, io.ErrUnexpectedEOF},
+		{"literal length past source", []byte{0xF0, 200, 'a'}, 1 << 10, io.ErrUnexpectedEOF},
+		// Accumulating the run would take far more than the block to
+		// describe, so the decoder must give up on the first bytes
+		{"long literal length run", run([]byte{0xF0}, 1<<16, 0), 1 << 20, io.ErrUnexpectedEOF},
+		{"literals past destination", []byte{0x50, 'a', 'b', 'c', 'd', 'e'}, 4, lz4.ErrBlockTooLarge},
+		{"empty destination", []byte{0x10, 'a'}, 0, lz4.ErrBlockTooLarge},
+		{"truncated offset", []byte{0x10, 'a', 1}, 64, io.ErrUnexpectedEOF},
+		{"zero offset", []byte{0x10, 'a', 0, 0}, 64, lz4.ErrCorrupted},
+		{"offset before block start", []byte{0x10, 'a', 2, 0}, 64, lz4.ErrCorrupted},
+		{"maximum offset in short block", []byte{0x10, 'a', 255, 255}, 64, lz4.ErrCorrupted},
+		{"truncated match length", match(0x1F), 64, io.ErrUnexpectedEOF},
+		{"match past destination", append(match(0x1F), 16), 20, lz4.ErrBlockTooLarge},
+		{"minimum match past destination", match(0x10), 4, lz4.ErrBlockTooLarge},
+		{"long match length run", run(match(0x1F), 1<<12, 0), 1 << 16, lz4.ErrBlockTooLarge},
+		{"token after full destination", append(match(0x10), 0x10, 'b'), 5, lz4.ErrBlockTooLarge},
+	}
+}
@@ -0,0 +1,210 @@
+// Package lz4test generates corrupted LZ4 frames for testing decoders.
+package lz4test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	lz4 "rzstd/src"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+var ErrNotSingleFrame = errors.New("input is not a single valid frame")
+
+// Vector is a corrupted variant of a valid frame. Err is the problem
+// lz4.Validate is expected to report first, or nil if the corruption must be
+// detected but the exact problem depends on the input.
+type Vector struct {
+	Name string
+	Data []byte
+	Err  error
+}
+
+// Check validates v.Data and returns an error unless the expected problem
+// is reported.
+func (v Vector) Check() error {
+	report, err := lz4.Validate(bytes.NewReader(v.Data))
+	if err != nil {
+		return fmt.Errorf("%s: %w", v.Name, err)
+	}
+	if report.OK() {
+		return fmt.Errorf("%s: corruption not detected", v.Name)
+	}
+	if got := report.Problems[0].Err; v.Err != nil && !errors.Is(got, v.Err) {
+		return fmt.Errorf("%s: got %v, want %v", v.Name, got, v.Err)
+	}
+	return nil
+}
+
+// frameLayout locates the parts of a frame that the vectors corrupt.
+type frameLayout struct {
+	header     *lz4.DecodedFrameHeader
+	headerSize int
+	// Offset of the first block's size field, and of the end mark
+	firstBlock int
+	endMark    int
+}
+
+func parseLayout(frame []byte) (*frameLayout, error) {
+	r := bytes.NewReader(frame)
+	header, err := lz4.ReadFrameHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotSingleFrame, err)
+	}
+	l := &frameLayout{header: header, headerSize: len(frame) - r.Len()}
+	l.firstBlock = l.headerSize
+
+	pos := l.firstBlock
+	for {
+		if pos+4 > len(frame) {
+			return nil, ErrNotSingleFrame
+		}
+		size := binary.LittleEndian.Uint32(frame[pos:])
+		if size == 0 {
+			break
+		}
+		pos += 4 + int(size&^0x80000000)
+		if header.BlocksChecksumFlag {
+			pos += 4
+		}
+	}
+	l.endMark = pos
+	end := pos + 4
+	if header.ContentChecksumFlag {
+		end += 4
+	}
+	if end != len(frame) {
+		return nil, ErrNotSingleFrame
+	}
+	return l, nil
+}
+
+// CorruptFrame returns systematically corrupted variants of frame, which
+// must be exactly one valid LZ4 frame: bit flips in the magic number and
+// frame descriptor, truncated headers, oversized block sizes and match
+// offsets, bad block and content checksums, truncated blocks and a missing
+// end mark.
+func CorruptFrame(frame []byte) ([]Vector, error) {
+	l, err := parseLayout(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	var vectors []Vector
+	add := func(name string, want error, data []byte) {
+		vectors = append(vectors, Vector{Name: name, Data: data, Err: want})
+	}
+	modified := func(f func(b []byte)) []byte {
+		b := bytes.Clone(frame)
+		f(b)
+		return b
+	}
+
+	add("magic bit flip", lz4.ErrCorrupted, modified(func(b []byte) { b[0] ^= 1 }))
+
+	// The descriptor runs from FLG to the header checksum
+	for pos := 4; pos < l.headerSize; pos++ {
+		for bit := 0; bit < 8; bit++ {
+			var want error
+			switch {
+			case pos == 4 && bit >= 6:
+				want = lz4.ErrInvalidVersion
+			case pos == l.headerSize-1:
+				want = lz4.ErrHeaderChecksum
+			}
+			add(fmt.Sprintf("header byte %d bit %d flip", pos, bit), want,
+				modified(func(b []byte) { b[pos] ^= 1 << bit }))
+		}
+	}
+
+	for n := 4; n < l.headerSize; n++ {
+		add(fmt.Sprintf("header truncated to %d bytes", n), io.ErrUnexpectedEOF, frame[:n:n])
+	}
+
+	if l.firstBlock == l.endMark {
+		// An empty frame has no blocks to corrupt
+		add("missing end mark", lz4.ErrMissingEndMark, frame[:l.endMark:l.endMark])
+		return vectors, nil
+	}
+
+	sizeField := binary.LittleEndian.Uint32(frame[l.firstBlock:])
+	blockSize := int(sizeField &^ 0x80000000)
+	data := l.firstBlock + 4
+
+	add("block size above maximum", lz4.ErrBlockTooLarge, modified(func(b []byte) {
+		binary.LittleEndian.PutUint32(b[l.firstBlock:], sizeField&0x80000000|(l.header.BlockMaxSize+1))
+	}))
+	add("block truncated", io.ErrUnexpectedEOF, frame[:data+blockSize/2:data+blockSize/2])
+
+	if sizeField&0x80000000 == 0 {
+		if pos, ok := firstMatchOffset(frame[data : data+blockSize]); ok {
+			add("match offset beyond output", lz4.ErrCorrupted, modified(func(b []byte) {
+				binary.LittleEndian.PutUint16(b[data+pos:], 0xFFFF)
+				if l.header.BlocksChecksumFlag {
+					sum := xxHash32.Checksum(b[data:data+blockSize], 0)
+					binary.LittleEndian.PutUint32(b[data+blockSize:], sum)
+				}
+			}))
+		}
+	}
+
+	if l.header.BlocksChecksumFlag {
+		add("block checksum bit flip", lz4.ErrBlockChecksum,
+			modified(func(b []byte) { b[data+blockSize] ^= 1 }))
+	}
+	if l.header.ContentChecksumFlag {
+		add("content checksum bit flip", lz4.ErrContentChecksum,
+			modified(func(b []byte) { b[len(b)-1] ^= 1 }))
+	}
+	add("missing end mark", lz4.ErrMissingEndMark, frame[:l.endMark:l.endMark])
+	return vectors, nil
+}
+
+// firstMatchOffset returns the position in block of the first match offset
+// that can be made to point before the start of the output.
+func firstMatchOffset(block []byte) (int, bool) {
+	pos, out := 0, 0
+	for pos < len(block) {
+		token := block[pos]
+		pos++
+
+		litLen := int(token >> 4)
+		if litLen == 15 {
+			for pos < len(block) {
+				b := block[pos]
+				pos++
+				litLen += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+		pos += litLen
+		out += litLen
+		if pos+2 > len(block) {
+			return 0, false
+		}
+		if out < 0xFFFF {
+			return pos, true
+		}
+
+		pos += 2
+		matchLen := int(token & 0x0F)
+		if matchLen == 15 {
+			for pos < len(block) {
+				b := block[pos]
+				pos++
+				matchLen += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+		out += matchLen + 4
+	}
+	return 0, false
+}
@@ -0,0 +1,100 @@
+package lz4test
+
+import (
+	"io"
+	"testing/iotest"
+)
+
+// The helpers below return wrappers for lz4.WithDstWrapper and
+// lz4.WithSrcWrapper that inject I/O faults into a Writer or a Reader.
+
+// ShortWrites makes every write pass at most max bytes through while
+// reporting no error, violating the io.Writer contract. A Writer must still
+// write a complete stream by passing on the rest.
+func ShortWrites(max int) func(io.Writer) io.Writer {
+	return func(w io.Writer) io.Writer {
+		return &shortWriter{w: w, max: max}
+	}
+}
+
+type shortWriter struct {
+	w   io.Writer
+	max int
+}
+
+func (s *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > s.max {
+		p = p[:s.max]
+	}
+	return s.w.Write(p)
+}
+
+// FailWrites makes the writes that would take the output past n bytes fail
+// with err, times times, after which writes succeed again. The failing
+// writes pass nothing through.
+func FailWrites(n int64, err error, times int) func(io.Writer) io.Writer {
+	return func(w io.Writer) io.Writer {
+		return &failingWriter{w: w, limit: n, err: err, times: times}
+	}
+}
+
+type failingWriter struct {
+	w       io.Writer
+	written int64
+	limit   int64
+	err     error
+	times   int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if f.times > 0 && f.written+int64(len(p)) > f.limit {
+		f.times--
+		return 0, f.err
+	}
+	n, err := f.w.Write(p)
+	f.written += int64(n)
+	return n, err
+}
+
+// FailReads makes the reads that start at or past n bytes fail with err,
+// times times, after which reads succeed again.
+func FailReads(n int64, err error, times int) func(io.Reader) io.Reader {
+	return func(r io.Reader) io.Reader {
+		return &failingReader{r: r, limit: n, err: err, times: times}
+	}
+}
+
+type failingReader struct {
+	r     io.Reader
+	read  int64
+	limit int64
+	err   error
+	times int
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if f.times > 0 && f.read >= f.limit {
+		f.times--
+		return 0, f.err
+	}
+	if rest := f.limit - f.read; f.times > 0 && int64(len(p)) > rest {
+		// Stop at the fault so it hits at exactly n bytes
+		p = p[:rest]
+	}
+	n, err := f.r.Read(p)
+	f.read += int64(n)
+	return n, err
+}
+
+// EOFAfter truncates the input to n bytes, for example in the middle of a
+// block.
+func EOFAfter(n int64) func(io.Reader) io.Reader {
+	return func(r io.Reader) io.Reader {
+		return io.LimitReader(r, n)
+	}
+}
+
+// OneByteReads makes every read return at most one byte.
+func OneByteReads() func(io.Reader) io.Reader {
+	return iotest.OneByteReader
+}
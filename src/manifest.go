@@ -0,0 +1,109 @@
+package lz4
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ManifestEntry describes one archived file. Checksum is the xxHash32 and
+// SHA256 the SHA-256 of the uncompressed contents.
+type ManifestEntry struct {
+	Src            string
+	Dst            string
+	Size           int64
+	CompressedSize int64
+	ModTime        time.Time
+	Checksum       uint32
+	SHA256         [32]byte
+}
+
+// Ratio returns the compressed size as a fraction of the original size.
+func (e ManifestEntry) Ratio() float64 {
+	if e.Size == 0 {
+		return 0
+	}
+	return float64(e.CompressedSize) / float64(e.Size)
+}
+
+// Manifest lists archived files, for example those compressed by one
+// CompressFiles call, in the order of their specs.
+type Manifest struct {
+	Files []ManifestEntry
+}
+
+// manifestLine is the JSON form of a ManifestEntry. Checksums are hex
+// strings so that the file stays readable and diffable.
+type manifestLine struct {
+	Src            string    `json:"src"`
+	Dst            string    `json:"dst"`
+	Size           int64     `json:"size"`
+	CompressedSize int64     `json:"compressed_size"`
+	ModTime        time.Time `json:"mtime"`
+	XXH32          string    `json:"xxh32"`
+	SHA256         string    `json:"sha256"`
+}
+
+// WriteManifest writes m as JSON lines, one object per file:
+//
+//	{"src":"a.txt","dst":"a.txt.lz4","size":200000,"compressed_size":83374,
+//	 "mtime":"2024-05-01T12:00:00Z","xxh32":"0c3a51f2","sha256":"9f86d0..."}
+//
+// Appending the output of several calls to one file yields a valid
+// manifest.
+func WriteManifest(w io.Writer, m Manifest) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, e := range m.Files {
+		line := manifestLine{
+			Src:            e.Src,
+			Dst:            e.Dst,
+			Size:           e.Size,
+			CompressedSize: e.CompressedSize,
+			ModTime:        e.ModTime,
+			XXH32:          fmt.Sprintf("%08x", e.Checksum),
+			SHA256:         hex.EncodeToString(e.SHA256[:]),
+		}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadManifest parses a manifest written by WriteManifest.
+func ReadManifest(r io.Reader) (Manifest, error) {
+	var m Manifest
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var line manifestLine
+		if err := dec.Decode(&line); err == io.EOF {
+			return m, nil
+		} else if err != nil {
+			return m, fmt.Errorf("manifest entry %d: %w", n, err)
+		}
+
+		e := ManifestEntry{
+			Src:            line.Src,
+			Dst:            line.Dst,
+			Size:           line.Size,
+			CompressedSize: line.CompressedSize,
+			ModTime:        line.ModTime,
+		}
+		sum, err := strconv.ParseUint(line.XXH32, 16, 32)
+		if err != nil {
+			return m, fmt.Errorf("manifest entry %d: invalid xxh32 %q", n, line.XXH32)
+		}
+		e.Checksum = uint32(sum)
+		sha, err := hex.DecodeString(line.SHA256)
+		if err != nil || len(sha) != len(e.SHA256) {
+			return m, fmt.Errorf("manifest entry %d: invalid sha256 %q", n, line.SHA256)
+		}
+		copy(e.SHA256[:], sha)
+		m.Files = append(m.Files, e)
+	}
+}
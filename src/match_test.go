@@ -0,0 +1,29 @@
+package lz4
+
+import "testing"
+
+// TestMatchLength compares matchLength with a byte-by-byte count for a
+// difference at every position around the 8-byte steps, and for limits
+// that end inside a step.
+func TestMatchLength(t *testing.T) {
+	const n = 40
+	for diff := 0; diff <= n; diff++ {
+		src := make([]byte, 2*n)
+		for i := range n {
+			src[i] = byte(i)
+			src[n+i] = byte(i)
+		}
+		if diff < n {
+			src[n+diff] ^= 0x80
+		}
+		for limit := 0; limit <= n; limit++ {
+			want := 0
+			for want < limit && src[want] == src[n+want] {
+				want++
+			}
+			if got := matchLength(src, n, 0, limit); got != want {
+				t.Errorf("difference at %d, limit %d: matchLength = %d, want %d", diff, limit, got, want)
+			}
+		}
+	}
+}
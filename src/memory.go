@@ -0,0 +1,112 @@
+package lz4
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrInvalidMemoryLimit = errors.New("invalid memory limit")
+
+// WithMemoryLimit caps the memory held in block buffers, from queued input
+// and compression scratch space to compressed and decoded blocks, at n
+// bytes. A buffer request that would exceed the limit waits until others are
+// returned, so a pipeline whose source outpaces its sink is throttled rather
+// than growing without bound. The limit is shared by every Writer, Reader
+// and AsyncWriter the same Option value is applied to, for example all the
+// workers of CompressFiles. A single request larger than the limit is
+// served once nothing else is held.
+func WithMemoryLimit(n int64) Option {
+	if n <= 0 {
+		return func(applier) error { return ErrInvalidMemoryLimit }
+	}
+	b := &memoryBudget{limit: n}
+	b.cond = sync.NewCond(&b.mu)
+	return func(a applier) error {
+		switch rw := a.(type) {
+		case *Writer:
+			rw.budget = b
+			rw.buffers = &limitedPool{pool: rw.buffers, budget: b}
+			return nil
+		case *Reader:
+			rw.budget = b
+			rw.buffers = &limitedPool{pool: rw.buffers, budget: b}
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// memoryBudget is a weighted semaphore over bytes of buffer memory.
+type memoryBudget struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int64
+	used  int64
+	// floor raises the limit to the largest request plus headroom granted
+	// so far, so a consumer can always get the scratch space it reserved
+	// room for
+	floor int64
+}
+
+// acquire waits until n bytes fit with headroom bytes to spare.
+func (b *memoryBudget) acquire(n, headroom int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if headroom > 0 {
+		b.floor = max(b.floor, n+headroom)
+	}
+	for b.used > 0 && b.used+n+headroom > max(b.limit, b.floor) {
+		b.cond.Wait()
+	}
+	b.used += n
+}
+
+// charge accounts for n more bytes without waiting.
+func (b *memoryBudget) charge(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used += n
+}
+
+func (b *memoryBudget) release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	b.cond.Broadcast()
+}
+
+// limitedPool charges the buffers of pool against a memory budget by their
+// capacity.
+type limitedPool struct {
+	pool   BufferPool
+	budget *memoryBudget
+}
+
+func (p *limitedPool) Get(size int) []byte {
+	return p.get(size, 0)
+}
+
+func (p *limitedPool) get(size, headroom int) []byte {
+	p.budget.acquire(int64(size), int64(headroom))
+	buf := p.pool.Get(size)
+	if extra := cap(buf) - size; extra > 0 {
+		p.budget.charge(int64(extra))
+	}
+	return buf
+}
+
+func (p *limitedPool) Put(buf []byte) {
+	p.pool.Put(buf)
+	p.budget.release(int64(cap(buf)))
+}
+
+// getBufferReserving returns a buffer that is held while a second one of
+// headroom bytes is needed, such as queued input waiting for compression
+// scratch space. Under a memory limit it waits until both fit, so holders
+// cannot starve each other.
+func getBufferReserving(p BufferPool, size, headroom int) []byte {
+	if lp, ok := p.(*limitedPool); ok {
+		return lp.get(size, headroom)[:size]
+	}
+	return getBuffer(p, size)
+}
@@ -0,0 +1,183 @@
+package lz4
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrOptionNotApplicable = errors.New("option not applicable")
+	ErrOptionAfterStart    = errors.New("options must be applied before the stream starts")
+)
+
+// Option configures a Writer or a Reader, in the same way as the options of
+// github.com/pierrec/lz4.
+type Option func(applier) error
+
+type applier interface {
+	Apply(...Option) error
+	private()
+}
+
+func (*Writer) private() {}
+
+func (w *Writer) Apply(options ...Option) error {
+	if w.headerWritten {
+		return ErrOptionAfterStart
+	}
+	for _, o := range options {
+		if err := o(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (*Reader) private() {}
+
+func (r *Reader) Apply(options ...Option) error {
+	if r.headerRead {
+		return ErrOptionAfterStart
+	}
+	for _, o := range options {
+		if err := o(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithFavorDecSpeed makes the compressor skip short matches and matches with
+// tiny offsets, which are the slowest sequences to decode, at some cost in
+// ratio.
+func WithFavorDecSpeed() Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			w.params.favorDecSpeed = true
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// WithDualHash adds a second, smaller hash table indexing 8-byte sequences
+// that is checked before the regular one, so the compressor prefers long
+// matches while still finding 4-byte ones.
+func WithDualHash() Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			w.params.dualHash = true
+			w.hashTable = newHashTable(w.params)
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// WithWorkerPool attaches a Writer or a Reader to a shared WorkerPool.
+func WithWorkerPool(p *WorkerPool) Option {
+	return func(a applier) error {
+		switch rw := a.(type) {
+		case *Writer:
+			rw.pool = p
+			return nil
+		case *Reader:
+			rw.pool = p
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// WithBufferPool makes a Writer or a Reader take its block-sized buffers
+// from p instead of allocating them.
+func WithBufferPool(p BufferPool) Option {
+	return func(a applier) error {
+		switch rw := a.(type) {
+		case *Writer:
+			rw.buffers = p
+			if rw.budget != nil {
+				rw.buffers = &limitedPool{pool: p, budget: rw.budget}
+			}
+			return nil
+		case *Reader:
+			rw.buffers = p
+			if rw.budget != nil {
+				rw.buffers = &limitedPool{pool: p, budget: rw.budget}
+			}
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// WithFlushTimeout makes buffered data visible downstream once writes pause
+// for d: an AsyncWriter wrapping the Writer queues its partial block and
+// flushes the Writer when it has caught up.
+func WithFlushTimeout(d time.Duration) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			w.flushTimeout = d
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// WithDstWrapper replaces the destination of a Writer with wrap(dst). It is
+// a seam for intercepting the compressed output, for example to inject
+// faults with the helpers of package lz4test.
+func WithDstWrapper(wrap func(io.Writer) io.Writer) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			w.dst.w = wrap(w.dst.w)
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// WithSrcWrapper replaces the source of a Reader with wrap(src).
+func WithSrcWrapper(wrap func(io.Reader) io.Reader) Option {
+	return func(a applier) error {
+		switch r := a.(type) {
+		case *Reader:
+			r.src.r = wrap(r.src.r)
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// WithTee makes a Writer send its compressed output to every writer in
+// extra as well as to its destination, failing if any of them fails.
+func WithTee(extra ...io.Writer) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			w.dst.w = io.MultiWriter(append([]io.Writer{w.dst.w}, extra...)...)
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// WithSingleFrame makes a Reader stop at the end mark of the first frame
+// instead of going on to the frames concatenated after it, and leaves its
+// source right after that frame, so callers that store other data between
+// frames can take over from there.
+func WithSingleFrame() Option {
+	return func(a applier) error {
+		switch r := a.(type) {
+		case *Reader:
+			r.singleFrame = true
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
@@ -0,0 +1,268 @@
+package lz4
+
+import (
+	"io"
+	"runtime"
+)
+
+// WithConcurrency makes a Writer compress up to n blocks at the same time,
+// each on its own goroutine with its own hash table, while still writing
+// them to the destination in order. The output is the same as with a
+// single goroutine. Write returns once a block is queued, so an error
+// compressing it is returned by a later call. Linked blocks, WithAdaptive
+// and WithTargetThroughput depend on the previous block and keep
+// compressing one block at a time, as does WithMemoryLimit, since queued
+// blocks could hold the memory the next one waits for.
+//
+// A Reader reads up to n blocks ahead and decodes them in the background,
+// delivering them in order. Frames with linked blocks, WithRecovery,
+// WithReturnPartialOnError and WithMemoryLimit keep it decoding one block
+// at a time. If n is not positive, GOMAXPROCS is used.
+func WithConcurrency(n int) Option {
+	if n < 1 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	return func(a applier) error {
+		switch rw := a.(type) {
+		case *Writer:
+			rw.concurrency = n
+			rw.compressors = make(chan *compressor, n)
+			return nil
+		case *Reader:
+			rw.concurrency = n
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// blockJob is a block being compressed in the background by c.
+type blockJob struct {
+	src        []byte
+	c          *compressor
+	compressed []byte
+	n          int
+	err        error
+	done       chan struct{}
+}
+
+// compressor is the scratch space of a goroutine compressing a block. It is
+// reused once the block is written, along with the buffer the block was
+// compressed into.
+type compressor struct {
+	hashTable  *matchTable
+	window     []byte
+	compressed []byte
+}
+
+// parallel reports whether blocks are compressed in the background.
+func (w *Writer) parallel() bool {
+	return w.concurrency > 1 && !w.linked && !w.adaptive && w.targetThroughput == 0 && w.budget == nil
+}
+
+// queueBlock starts compressing src, a buffer from w.buffers that the block
+// takes over, first writing the oldest queued block if as many as allowed
+// are in flight.
+func (w *Writer) queueBlock(src []byte) error {
+	if len(w.jobs) >= w.concurrency {
+		if err := w.finishJob(); err != nil {
+			w.buffers.Put(src)
+			return err
+		}
+	}
+	if w.err != nil {
+		w.buffers.Put(src)
+		return w.err
+	}
+
+	var c *compressor
+	select {
+	case c = <-w.compressors:
+	default:
+		c = &compressor{hashTable: newHashTable(w.params)}
+	}
+	j := &blockJob{src: src, c: c, done: make(chan struct{})}
+	if bound := compressBound(len(src)); cap(c.compressed) >= bound {
+		j.compressed = c.compressed[:bound]
+	} else {
+		if c.compressed != nil {
+			w.buffers.Put(c.compressed)
+			c.compressed = nil
+		}
+		j.compressed = getBuffer(w.buffers, bound)
+	}
+	params := w.blockParams()
+	go func() {
+		defer close(j.done)
+		w.pool.acquire()
+		j.n, c.window, j.err = compressAfter(j.src, w.dict, j.compressed, c.hashTable, c.window, params)
+		w.pool.release()
+	}()
+	w.jobs = append(w.jobs, j)
+	w.queued += int64(len(src))
+	return nil
+}
+
+// finishJob waits for the oldest queued block and writes it, unless the
+// Writer has failed.
+func (w *Writer) finishJob() error {
+	j := w.jobs[0]
+	copy(w.jobs, w.jobs[1:])
+	w.jobs = w.jobs[:len(w.jobs)-1]
+	<-j.done
+	w.queued -= int64(len(j.src))
+	defer w.recycleJob(j)
+
+	if w.err != nil {
+		return w.err
+	}
+	err := j.err
+	if err == nil {
+		err = w.beginBlock()
+	}
+	if err == nil {
+		if h := w.blockHash(); h != nil && w.partSize == 0 {
+			h.Write(j.src)
+		}
+		err = w.emitBlock(j.src, j.compressed[:j.n])
+	}
+	if err == nil {
+		err = w.endBlock()
+	}
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return err
+}
+
+// recycleJob makes the buffers and the compressor of a written block
+// available to the next ones.
+func (w *Writer) recycleJob(j *blockJob) {
+	if w.spare == nil {
+		w.spare = j.src
+	} else {
+		w.buffers.Put(j.src)
+	}
+	j.c.compressed = j.compressed
+	w.compressors <- j.c
+}
+
+// drain writes the pending block, unless the Writer has failed, and every
+// queued block.
+func (w *Writer) drain() error {
+	var err error
+	if w.err == nil {
+		err = w.putPending()
+	}
+	for len(w.jobs) > 0 {
+		if jerr := w.finishJob(); err == nil {
+			err = jerr
+		}
+	}
+	return err
+}
+
+// decodedBlock is a block read ahead by a Reader and decoded in the
+// background from compressed into buf, which data is part of. Stored blocks
+// are delivered from the buffer they were read into.
+type decodedBlock struct {
+	// size is the stored size of the block
+	size       int
+	compressed []byte
+	buf        []byte
+	data       []byte
+	end        bool
+	err        error
+	done       chan struct{}
+}
+
+// parallel reports whether the blocks of the current frame are decoded in
+// the background.
+func (r *Reader) parallel() bool {
+	return r.concurrency > 1 && r.header.BlocksIndependentFlag && r.header.Magic != legacyMagic && r.recovery == nil && !r.partial && r.budget == nil
+}
+
+// nextBlock returns the next block of the frame, or nil at its end mark.
+func (r *Reader) nextBlock() (*decodedBlock, error) {
+	for len(r.ahead) < r.concurrency && !r.frameRead {
+		b, last := r.readAhead()
+		r.ahead = append(r.ahead, b)
+		r.frameRead = last
+	}
+	b := r.ahead[0]
+	copy(r.ahead, r.ahead[1:])
+	r.ahead = r.ahead[:len(r.ahead)-1]
+	<-b.done
+	r.putBlockBuffer(b.compressed)
+	if b.err != nil {
+		r.putBlockBuffer(b.buf)
+		return nil, b.err
+	}
+	if b.end {
+		return nil, nil
+	}
+	return b, nil
+}
+
+// readAhead reads the next block of the frame and starts decoding it. It
+// reports whether nothing follows the block, because it is the end mark or
+// could not be read.
+func (r *Reader) readAhead() (*decodedBlock, bool) {
+	b := &decodedBlock{done: make(chan struct{})}
+	fail := func(err error) (*decodedBlock, bool) {
+		b.err = err
+		close(b.done)
+		return b, true
+	}
+
+	size, err := r.readUint32()
+	if err != nil {
+		return fail(noEndMark(err))
+	}
+	if size == 0 {
+		b.end = true
+		close(b.done)
+		return b, true
+	}
+	uncompressed := size&0x80000000 != 0
+	size &^= 0x80000000
+	if size > r.header.BlockMaxSize {
+		return fail(ErrBlockTooLarge)
+	}
+	b.size = int(size)
+
+	b.compressed = r.getBlockBuffer()[:size]
+	if _, err := io.ReadFull(r.src, b.compressed); err != nil {
+		return fail(noEOF(err))
+	}
+	if err := r.checkBlock(b.compressed); err != nil {
+		return fail(err)
+	}
+	if uncompressed {
+		// The block is delivered from its own buffer
+		b.buf, b.data, b.compressed = b.compressed, b.compressed, nil
+		close(b.done)
+		return b, false
+	}
+
+	b.buf = r.getBlockBuffer()
+	dict := r.dict
+	go func() {
+		defer close(b.done)
+		r.pool.acquire()
+		n, err := decompressBlockDict(b.compressed, b.buf, dict, minMatchLength)
+		r.pool.release()
+		b.data, b.err = b.buf[:n], err
+	}()
+	return b, false
+}
+
+// dropBlocks waits for the blocks read ahead and releases their buffers.
+func (r *Reader) dropBlocks() {
+	for _, b := range r.ahead {
+		<-b.done
+		r.putBlockBuffer(b.compressed)
+		r.putBlockBuffer(b.buf)
+	}
+	r.ahead = nil
+}
@@ -0,0 +1,118 @@
+package lz4_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	lz4 "rzstd/src"
+	"rzstd/src/lz4test"
+)
+
+// TestParallelWriter checks that blocks compressed on several goroutines
+// come out the same as on one, whatever the sizes of the writes.
+func TestParallelWriter(t *testing.T) {
+	data := testInput(1<<20 + 12345)
+	options := []lz4.Option{lz4.WithBlockSize(64 << 10), lz4.WithBlockChecksum(), lz4.WithContentChecksum()}
+	want := compress(t, data, options...)
+	for _, chunk := range []int{1000, 64 << 10, 300 << 10, len(data)} {
+		var buf bytes.Buffer
+		w := lz4.NewWriter(&buf)
+		if err := w.Apply(append(options, lz4.WithConcurrency(4))...); err != nil {
+			t.Fatal(err)
+		}
+		for p := data; len(p) > 0; {
+			n := min(chunk, len(p))
+			if _, err := w.Write(p[:n]); err != nil {
+				t.Fatal(err)
+			}
+			p = p[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("writes of %d bytes: output differs from a single goroutine's", chunk)
+		}
+	}
+}
+
+// TestParallelWriterError fails the destination while blocks are queued.
+// The error comes back from a later call and sticks.
+func TestParallelWriterError(t *testing.T) {
+	data := testInput(1 << 20)
+	var buf bytes.Buffer
+	w := lz4.NewWriter(&buf)
+	err := w.Apply(lz4.WithBlockSize(64<<10), lz4.WithConcurrency(4), lz4.WithDstWrapper(lz4test.FailWrites(200<<10, errFault, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p := data; len(p) > 0 && err == nil; p = p[64<<10:] {
+		_, err = w.Write(p[:64<<10])
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if !errors.Is(err, errFault) {
+		t.Fatalf("got %v, want %v", err, errFault)
+	}
+	if err := w.Close(); !errors.Is(err, errFault) {
+		t.Errorf("Close after the failure = %v, want %v", err, errFault)
+	}
+}
+
+func TestParallelReader(t *testing.T) {
+	data := testInput(1<<20 + 12345)
+	independent := compress(t, data, lz4.WithBlockSize(64<<10), lz4.WithBlockChecksum())
+	linked := compress(t, data, lz4.WithBlockSize(64<<10), lz4.WithLinkedBlocks())
+	stream := append(bytes.Clone(independent), linked...)
+	want := append(bytes.Clone(data), data...)
+
+	for _, size := range []int{1, 4096, 1 << 20} {
+		r := lz4.NewReader(bytes.NewReader(stream))
+		if err := r.Apply(lz4.WithConcurrency(4)); err != nil {
+			t.Fatal(err)
+		}
+		var got []byte
+		p := make([]byte, size)
+		for {
+			n, err := r.Read(p)
+			got = append(got, p[:n]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("reads of %d bytes do not match the input", size)
+		}
+	}
+
+	// A bad block is reported after the blocks before it are delivered,
+	// although the ones after it were already read
+	frames, err := lz4.Inspect(bytes.NewReader(independent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := frames[0].Blocks[5]
+	corrupt := bytes.Clone(independent)
+	binary.LittleEndian.PutUint32(corrupt[b.Offset:], 1<<20)
+	r := lz4.NewReader(bytes.NewReader(corrupt))
+	if err := r.Apply(lz4.WithConcurrency(4)); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if _, err := io.Copy(&out, r); !errors.Is(err, lz4.ErrBlockTooLarge) {
+		t.Fatalf("Read = %v, want %v", err, lz4.ErrBlockTooLarge)
+	}
+	if !bytes.Equal(out.Bytes(), data[:5*64<<10]) {
+		t.Errorf("delivered %d bytes before the bad block, want %d", out.Len(), 5*64<<10)
+	}
+	if _, err := r.Read(make([]byte, 10)); !errors.Is(err, lz4.ErrBlockTooLarge) {
+		t.Errorf("Read after the error = %v, want %v", err, lz4.ErrBlockTooLarge)
+	}
+}
@@ -0,0 +1,446 @@
+package lz4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+const (
+	parityTag = "RZPA"
+	// A Cauchy code over GF(2^8) has at most 256 shards in a group
+	maxShards = 256
+)
+
+var (
+	ErrParityShards     = errors.New("invalid number of parity shards")
+	ErrParityCheckpoint = errors.New("checkpoints are not supported with parity")
+)
+
+// WithParity makes a Writer protect every group of data consecutive blocks
+// with parity Reed–Solomon shards, so Repair can rebuild up to parity
+// damaged blocks per group. The shards are stored in skippable frames at
+// the end of the stream and are held in memory until Close, which takes
+// about parity/data of the compressed size. Frame headers are not
+// protected.
+func WithParity(data, parity int) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			if data < 1 || parity < 1 || data+parity > maxShards {
+				return ErrParityShards
+			}
+			w.parity = &parityEncoder{data: data, parity: parity}
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// parityBlock locates a protected block: its size field and data as stored
+// in the stream.
+type parityBlock struct {
+	Offset   int64
+	Length   uint32
+	Checksum uint32
+}
+
+type parityEncoder struct {
+	data, parity int
+	blocks       []parityBlock
+	shards       [][]byte
+	frames       [][]byte
+}
+
+// add feeds the stored bytes of the block at offset, split in parts, to the
+// parity of the current group.
+func (e *parityEncoder) add(offset int64, parts ...[]byte) {
+	if e.shards == nil {
+		e.shards = make([][]byte, e.parity)
+	}
+	h := xxHash32.New(0)
+	pos := 0
+	for _, p := range parts {
+		h.Write(p)
+		for j := range e.shards {
+			if len(e.shards[j]) < pos+len(p) {
+				e.shards[j] = append(e.shards[j], make([]byte, pos+len(p)-len(e.shards[j]))...)
+			}
+			gfMulAdd(e.shards[j][pos:], p, parityCoef(j, len(e.blocks)))
+		}
+		pos += len(p)
+	}
+	e.blocks = append(e.blocks, parityBlock{Offset: offset, Length: uint32(pos), Checksum: h.Sum32()})
+	if len(e.blocks) == e.data {
+		e.endGroup()
+	}
+}
+
+// endGroup stores the parity frame payload of the current group:
+//
+//	tag, block count (2), parity count (2), shard length (4),
+//	per block: offset (8), length (4), checksum (4),
+//	per parity shard: checksum (4),
+//	checksum of the above (4), parity shards.
+func (e *parityEncoder) endGroup() {
+	if len(e.blocks) == 0 {
+		return
+	}
+	length := len(e.shards[0])
+	p := []byte(parityTag)
+	p = binary.LittleEndian.AppendUint16(p, uint16(len(e.blocks)))
+	p = binary.LittleEndian.AppendUint16(p, uint16(e.parity))
+	p = binary.LittleEndian.AppendUint32(p, uint32(length))
+	for _, b := range e.blocks {
+		p = binary.LittleEndian.AppendUint64(p, uint64(b.Offset))
+		p = binary.LittleEndian.AppendUint32(p, b.Length)
+		p = binary.LittleEndian.AppendUint32(p, b.Checksum)
+	}
+	for _, s := range e.shards {
+		p = binary.LittleEndian.AppendUint32(p, xxHash32.Checksum(s, 0))
+	}
+	p = binary.LittleEndian.AppendUint32(p, xxHash32.Checksum(p, 0))
+	for _, s := range e.shards {
+		p = append(p, s...)
+	}
+	e.frames = append(e.frames, p)
+	e.blocks = e.blocks[:0]
+	e.shards = nil
+}
+
+func (w *Writer) writeParity() error {
+	if w.parity == nil {
+		return nil
+	}
+	w.parity.endGroup()
+	for _, p := range w.parity.frames {
+		if err := writeSkippableFrame(w.dst, parityNibble, p); err != nil {
+			return err
+		}
+	}
+	w.parity.frames = nil
+	return nil
+}
+
+// RepairReport is the outcome of Repair.
+type RepairReport struct {
+	Groups   int
+	Damaged  int
+	Repaired int
+	// Offsets of the damaged blocks that could not be rebuilt
+	Unrecoverable []int64
+}
+
+// OK reports whether every protected block is intact or was rebuilt.
+func (r RepairReport) OK() bool {
+	return len(r.Unrecoverable) == 0
+}
+
+// Repair checks the blocks of a stream written with WithParity against the
+// checksums in its parity frames and rewrites the damaged ones in place.
+// f holds size bytes. Parity frames are found by their signature, so they
+// are located even when damage elsewhere breaks the frame structure.
+func Repair(f interface {
+	io.ReaderAt
+	io.WriterAt
+}, size int64) (RepairReport, error) {
+	var report RepairReport
+	groups, err := findParityGroups(f, size)
+	if err != nil {
+		return report, err
+	}
+	for _, g := range groups {
+		report.Groups++
+		if err := g.repair(f, size, &report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+type parityGroup struct {
+	blocks    []parityBlock
+	checksums []uint32
+	length    int
+	// Offset of the first parity shard
+	offset int64
+}
+
+// findParityGroups scans for parity frames, reading size bytes of r in
+// chunks that overlap by the length of the signature.
+func findParityGroups(r io.ReaderAt, size int64) ([]*parityGroup, error) {
+	var magic [4]byte
+	binary.LittleEndian.PutUint32(magic[:], skippableMagic|parityNibble)
+	const sigLen = skippableHeaderSize + len(parityTag)
+
+	var groups []*parityGroup
+	buf := make([]byte, 1<<20)
+	for pos := int64(0); pos+int64(sigLen) <= size; {
+		n, err := r.ReadAt(buf[:min(int64(len(buf)), size-pos)], pos)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		chunk := buf[:n]
+		next := pos + int64(n-sigLen) + 1
+		for i := 0; i+sigLen <= len(chunk); {
+			k := bytes.Index(chunk[i:], magic[:])
+			if k < 0 || i+k+sigLen > len(chunk) {
+				break
+			}
+			i += k
+			if string(chunk[i+skippableHeaderSize:i+sigLen]) == parityTag {
+				frameSize := int64(binary.LittleEndian.Uint32(chunk[i+4:]))
+				g, err := readParityGroup(r, pos+int64(i)+skippableHeaderSize, frameSize)
+				if err != nil {
+					return nil, err
+				}
+				if g != nil {
+					groups = append(groups, g)
+					next = pos + int64(i) + skippableHeaderSize + frameSize
+					break
+				}
+			}
+			i++
+		}
+		if next <= pos {
+			next = pos + 1
+		}
+		pos = next
+	}
+	return groups, nil
+}
+
+// readParityGroup parses the parity frame payload of frameSize bytes at
+// offset. It returns nil if the metadata is damaged or the match was a
+// false positive.
+func readParityGroup(r io.ReaderAt, offset, frameSize int64) (*parityGroup, error) {
+	var head [12]byte
+	if _, err := r.ReadAt(head[:], offset); err != nil {
+		return nil, nilOnEOF(err)
+	}
+	blocks := int(binary.LittleEndian.Uint16(head[4:]))
+	parity := int(binary.LittleEndian.Uint16(head[6:]))
+	length := int64(binary.LittleEndian.Uint32(head[8:]))
+	metaLen := int64(len(head) + blocks*16 + parity*4)
+	if blocks == 0 || parity == 0 || blocks+parity > maxShards || metaLen+4+int64(parity)*length != frameSize {
+		return nil, nil
+	}
+
+	meta := make([]byte, metaLen+4)
+	if _, err := r.ReadAt(meta, offset); err != nil {
+		return nil, nilOnEOF(err)
+	}
+	if xxHash32.Checksum(meta[:metaLen], 0) != binary.LittleEndian.Uint32(meta[metaLen:]) {
+		return nil, nil
+	}
+
+	g := &parityGroup{length: int(length), offset: offset + metaLen + 4}
+	p := meta[len(head):]
+	for i := 0; i < blocks; i++ {
+		g.blocks = append(g.blocks, parityBlock{
+			Offset:   int64(binary.LittleEndian.Uint64(p)),
+			Length:   binary.LittleEndian.Uint32(p[8:]),
+			Checksum: binary.LittleEndian.Uint32(p[12:]),
+		})
+		p = p[16:]
+	}
+	for j := 0; j < parity; j++ {
+		g.checksums = append(g.checksums, binary.LittleEndian.Uint32(p))
+		p = p[4:]
+	}
+	return g, nil
+}
+
+func nilOnEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// repair rebuilds the damaged blocks of g from its intact blocks and parity
+// shards.
+func (g *parityGroup) repair(f interface {
+	io.ReaderAt
+	io.WriterAt
+}, size int64, report *RepairReport) error {
+	// read returns the length bytes at offset, zero padded to the shard
+	// length, and whether they match checksum
+	read := func(offset int64, length int, checksum uint32) ([]byte, bool, error) {
+		shard := make([]byte, g.length)
+		if offset < 0 || length > g.length || offset+int64(length) > size {
+			return shard, false, nil
+		}
+		if _, err := f.ReadAt(shard[:length], offset); err != nil && err != io.EOF {
+			return nil, false, err
+		}
+		return shard, xxHash32.Checksum(shard[:length], 0) == checksum, nil
+	}
+
+	data := make([][]byte, len(g.blocks))
+	var damaged []int
+	for i, b := range g.blocks {
+		shard, ok, err := read(b.Offset, int(b.Length), b.Checksum)
+		if err != nil {
+			return err
+		}
+		data[i] = shard
+		if !ok {
+			damaged = append(damaged, i)
+		}
+	}
+	if len(damaged) == 0 {
+		return nil
+	}
+	report.Damaged += len(damaged)
+
+	var rows []int
+	var parity [][]byte
+	for j, sum := range g.checksums {
+		if len(rows) == len(damaged) {
+			break
+		}
+		shard, ok, err := read(g.offset+int64(j*g.length), g.length, sum)
+		if err != nil {
+			return err
+		}
+		if ok {
+			rows = append(rows, j)
+			parity = append(parity, shard)
+		}
+	}
+	if len(rows) < len(damaged) {
+		for _, i := range damaged {
+			report.Unrecoverable = append(report.Unrecoverable, g.blocks[i].Offset)
+		}
+		return nil
+	}
+
+	// Each parity shard minus the intact blocks leaves a combination of the
+	// damaged ones; solving the system recovers them
+	isDamaged := make([]bool, len(g.blocks))
+	for _, i := range damaged {
+		isDamaged[i] = true
+	}
+	matrix := make([][]byte, len(rows))
+	for r, j := range rows {
+		for i := range g.blocks {
+			if !isDamaged[i] {
+				gfMulAdd(parity[r], data[i], parityCoef(j, i))
+			}
+		}
+		matrix[r] = make([]byte, len(damaged))
+		for c, i := range damaged {
+			matrix[r][c] = parityCoef(j, i)
+		}
+	}
+	inverse, ok := gfInvert(matrix)
+	if !ok {
+		return fmt.Errorf("%w: singular parity matrix", ErrCorrupted)
+	}
+
+	for c, i := range damaged {
+		b := g.blocks[i]
+		shard := make([]byte, g.length)
+		for r := range rows {
+			gfMulAdd(shard, parity[r], inverse[c][r])
+		}
+		if xxHash32.Checksum(shard[:b.Length], 0) != b.Checksum {
+			report.Unrecoverable = append(report.Unrecoverable, b.Offset)
+			continue
+		}
+		if _, err := f.WriteAt(shard[:b.Length], b.Offset); err != nil {
+			return err
+		}
+		report.Repaired++
+	}
+	return nil
+}
+
+// Arithmetic in GF(2^8) with the polynomial x^8+x^4+x^3+x^2+1. Addition is
+// XOR; multiplication goes through logarithm tables.
+var gfExp, gfLog = gfTables()
+
+func gfTables() (exp [510]byte, log [256]byte) {
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		exp[i+255] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	return exp, log
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// gfMulAdd adds c*src to dst.
+func gfMulAdd(dst, src []byte, c byte) {
+	if c == 0 {
+		return
+	}
+	lc := int(gfLog[c])
+	for i, b := range src {
+		if b != 0 {
+			dst[i] ^= gfExp[lc+int(gfLog[b])]
+		}
+	}
+}
+
+// parityCoef is the Cauchy matrix entry for parity shard j and block i.
+// Block indexes count up from 0 and parity indexes down from 255, so the
+// sum is never zero, and every square submatrix is invertible.
+func parityCoef(j, i int) byte {
+	return gfInv(byte(255-j) ^ byte(i))
+}
+
+// gfInvert returns the inverse of the square matrix m, which it destroys.
+func gfInvert(m [][]byte) ([][]byte, bool) {
+	n := len(m)
+	inv := make([][]byte, n)
+	for i := range inv {
+		inv[i] = make([]byte, n)
+		inv[i][i] = 1
+	}
+	for col := 0; col < n; col++ {
+		pivot := col
+		for pivot < n && m[pivot][col] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		inv[col], inv[pivot] = inv[pivot], inv[col]
+
+		scale := gfInv(m[col][col])
+		for k := 0; k < n; k++ {
+			m[col][k] = gfMul(m[col][k], scale)
+			inv[col][k] = gfMul(inv[col][k], scale)
+		}
+		for row := 0; row < n; row++ {
+			if row != col && m[row][col] != 0 {
+				c := m[row][col]
+				gfMulAdd(m[row], m[col], c)
+				gfMulAdd(inv[row], inv[col], c)
+			}
+		}
+	}
+	return inv, true
+}
@@ -0,0 +1,117 @@
+package lz4_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	lz4 "rzstd/src"
+)
+
+// repair runs Repair on stream in a file and returns the report and the
+// file contents afterwards.
+func repair(t *testing.T, stream []byte) (lz4.RepairReport, []byte) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stream.lz4")
+	if err := os.WriteFile(path, stream, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	report, err := lz4.Repair(f, int64(len(stream)))
+	if err != nil {
+		t.Fatalf("Repair: %v", err)
+	}
+	repaired, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report, repaired
+}
+
+// TestParityRepair protects 16 blocks in groups of 4 with 2 parity shards
+// each, and damages blocks, parity shards and parity metadata.
+func TestParityRepair(t *testing.T) {
+	data := testInput(1 << 20)
+	stream := compress(t, data, lz4.WithBlockSize(64<<10), lz4.WithParity(4, 2))
+	if got := decompress(t, stream); !bytes.Equal(got, data) {
+		t.Fatalf("decompressed %d bytes, want %d", len(got), len(data))
+	}
+	frames, err := lz4.Inspect(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := frames[0].Blocks
+	parity := frames[1:]
+	if len(blocks) != 16 || len(parity) != 4 {
+		t.Fatalf("got %d blocks and %d parity frames, want 16 and 4", len(blocks), len(parity))
+	}
+	damage := func(offsets ...int64) []byte {
+		b := bytes.Clone(stream)
+		for _, off := range offsets {
+			b[off+10] ^= 0xFF
+		}
+		return b
+	}
+	// The first parity shard follows the skippable frame header, 12 bytes
+	// of group fields, 16 per block, 4 per shard and the metadata checksum
+	shard := func(group int) int64 { return parity[group].Offset + 8 + 12 + 4*16 + 2*4 + 4 }
+
+	tests := []struct {
+		name    string
+		damaged []int64
+		// left is the damage Repair cannot undo
+		left   []int64
+		report lz4.RepairReport
+	}{
+		{"intact", nil, nil, lz4.RepairReport{Groups: 4}},
+		{"two blocks of a group and one of another",
+			[]int64{blocks[0].Offset, blocks[3].Offset, blocks[9].Offset}, nil,
+			lz4.RepairReport{Groups: 4, Damaged: 3, Repaired: 3}},
+		{"a block and a parity shard of its group",
+			[]int64{blocks[5].Offset, shard(1)}, []int64{shard(1)},
+			lz4.RepairReport{Groups: 4, Damaged: 1, Repaired: 1}},
+		{"more blocks than parity shards",
+			[]int64{blocks[12].Offset, blocks[13].Offset, blocks[14].Offset},
+			[]int64{blocks[12].Offset, blocks[13].Offset, blocks[14].Offset},
+			lz4.RepairReport{Groups: 4, Damaged: 3, Unrecoverable: []int64{blocks[12].Offset, blocks[13].Offset, blocks[14].Offset}}},
+		// The group is not found, so its damaged block goes unnoticed
+		{"parity metadata and a block of its group",
+			[]int64{parity[2].Offset + 8, blocks[8].Offset}, []int64{parity[2].Offset + 8, blocks[8].Offset},
+			lz4.RepairReport{Groups: 3}},
+	}
+	for _, tt := range tests {
+		report, repaired := repair(t, damage(tt.damaged...))
+		if report.Groups != tt.report.Groups || report.Damaged != tt.report.Damaged || report.Repaired != tt.report.Repaired ||
+			!slices.Equal(report.Unrecoverable, tt.report.Unrecoverable) {
+			t.Errorf("%s: Repair = %+v, want %+v", tt.name, report, tt.report)
+		}
+		if report.OK() != (tt.report.Unrecoverable == nil) {
+			t.Errorf("%s: OK = %v", tt.name, report.OK())
+		}
+		if !bytes.Equal(repaired, damage(tt.left...)) {
+			t.Errorf("%s: the stream after Repair is not as expected", tt.name)
+		}
+	}
+}
+
+func TestParityOptions(t *testing.T) {
+	for _, shards := range [][2]int{{0, 1}, {1, 0}, {200, 57}} {
+		if err := lz4.NewWriter(nil).Apply(lz4.WithParity(shards[0], shards[1])); !errors.Is(err, lz4.ErrParityShards) {
+			t.Errorf("WithParity(%d, %d) = %v, want %v", shards[0], shards[1], err, lz4.ErrParityShards)
+		}
+	}
+	w := lz4.NewWriter(new(bytes.Buffer))
+	if err := w.Apply(lz4.WithParity(4, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Checkpoint(); !errors.Is(err, lz4.ErrParityCheckpoint) {
+		t.Errorf("Checkpoint = %v, want %v", err, lz4.ErrParityCheckpoint)
+	}
+}
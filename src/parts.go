@@ -0,0 +1,165 @@
+package lz4
+
+import (
+	"errors"
+	"io"
+)
+
+const (
+	// minPartSize keeps room in every part for a frame header, a block and
+	// the skippable padding that closes the part
+	minPartSize = 64 << 10
+	// Magic, descriptor with content size and dictionary ID, and checksum
+	maxFrameHeaderSize = 19
+)
+
+var (
+	ErrInvalidPartSize = errors.New("invalid part size")
+	ErrPartTooSmall    = errors.New("block does not fit in a part")
+	ErrPartPadding     = errors.New("part gap too small for padding")
+)
+
+// WithPartSize makes the Writer end frames so that the output splits into
+// parts of exactly n bytes, e.g. S3 multipart upload parts, each holding
+// only complete frames: before a block would cross a part boundary the
+// frame is ended, the rest of the part is filled with skippable padding and
+// a new frame starts the next part. Each part can then be decoded on its
+// own, and Parts maps it back to its range of the uncompressed data.
+// Metadata written on Close, such as the section index, may span parts.
+// Zero disables part alignment.
+func WithPartSize(n int64) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			if n != 0 && n < minPartSize {
+				return ErrInvalidPartSize
+			}
+			w.partSize = n
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// fitPart makes sure a stored block of size bytes and the frame trailer
+// after it fit in the current part, moving to a new frame in the next part
+// if not. The space left in a part after the trailer is zero or enough for
+// padding.
+func (w *Writer) fitPart(size int) error {
+	if w.partSize == 0 {
+		return nil
+	}
+	fits := func() bool {
+		gap := w.partLeft() - int64(size) - w.trailerSize()
+		return gap == 0 || gap >= skippableHeaderSize
+	}
+	if fits() {
+		return nil
+	}
+	if err := w.endFrame(); err != nil {
+		return err
+	}
+	if err := w.padPart(); err != nil {
+		return err
+	}
+	if err := w.WriteHeader(); err != nil {
+		return err
+	}
+	if !fits() {
+		return ErrPartTooSmall
+	}
+	return nil
+}
+
+// alignPart moves to the next part before a frame header unless the header
+// and the frame trailer fit in the current one with room for padding.
+func (w *Writer) alignPart() error {
+	if w.partSize == 0 || w.partLeft() == w.partSize || w.partLeft() >= maxFrameHeaderSize+w.trailerSize()+skippableHeaderSize {
+		return nil
+	}
+	return w.padPart()
+}
+
+// trailerSize returns the number of bytes endFrame writes after the last
+// block of a frame: the end mark, the content checksum and the checkpoint
+// of WithChecksumInterval.
+func (w *Writer) trailerSize() int64 {
+	n := int64(4)
+	if w.contentChecksum {
+		n += 4
+	}
+	if w.checksumInterval > 0 {
+		n += skippableHeaderSize + checksumPayloadSize
+	}
+	return n
+}
+
+// partLeft returns the number of bytes left in the current part.
+func (w *Writer) partLeft() int64 {
+	return w.partSize - w.dst.n%w.partSize
+}
+
+// padPart fills the rest of the current part with a skippable frame.
+func (w *Writer) padPart() error {
+	gap := w.partLeft()
+	if gap == w.partSize {
+		return nil
+	}
+	if gap < skippableHeaderSize {
+		w.err = ErrPartPadding
+		return w.err
+	}
+	if err := writeSkippableFrame(w.dst, paddingNibble, make([]byte, gap-skippableHeaderSize)); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+// Part is a part of a stream written with WithPartSize, and the range of
+// uncompressed data its frames decode to.
+type Part struct {
+	Offset           int64
+	Size             int64
+	DecompressedFrom int64
+	DecompressedSize int64
+}
+
+// Parts splits the stream of size bytes in r into parts of partSize bytes
+// and returns the uncompressed range of each. Block contents are parsed but
+// not decompressed.
+func Parts(r io.ReaderAt, size, partSize int64) ([]Part, error) {
+	if partSize <= 0 {
+		return nil, ErrInvalidPartSize
+	}
+	parts := make([]Part, (size+partSize-1)/partSize)
+	for i := range parts {
+		parts[i].Offset = int64(i) * partSize
+		parts[i].Size = min(partSize, size-parts[i].Offset)
+	}
+
+	s := newBlockScanner(io.NewSectionReader(r, 0, size), nil)
+	for {
+		b, err := s.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		n := len(b.Data)
+		if !b.Uncompressed {
+			if n, err = decodedSize(s.walk.header, b.Data); err != nil {
+				return nil, err
+			}
+		}
+		parts[b.Offset/partSize].DecompressedSize += int64(n)
+	}
+
+	var pos int64
+	for i := range parts {
+		parts[i].DecompressedFrom = pos
+		pos += parts[i].DecompressedSize
+	}
+	return parts, nil
+}
@@ -0,0 +1,32 @@
+package lz4
+
+import "runtime"
+
+// WorkerPool caps how many blocks are being compressed or decompressed at
+// the same time across every Writer and Reader attached to it, so a server
+// handling many streams bounds its total CPU use rather than its per-stream
+// use.
+type WorkerPool struct {
+	slots chan struct{}
+}
+
+// NewWorkerPool returns a pool running at most workers blocks at a time, or
+// GOMAXPROCS blocks if workers is not positive.
+func NewWorkerPool(workers int) *WorkerPool {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return &WorkerPool{slots: make(chan struct{}, workers)}
+}
+
+func (p *WorkerPool) acquire() {
+	if p != nil {
+		p.slots <- struct{}{}
+	}
+}
+
+func (p *WorkerPool) release() {
+	if p != nil {
+		<-p.slots
+	}
+}
@@ -0,0 +1,30 @@
+//go:build linux
+
+package lz4
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// preallocate reserves the blocks of f up to size with fallocate, so that
+// running out of space fails now rather than midway. File systems without
+// fallocate get a plain Truncate.
+func preallocate(f *os.File, size int64) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+	err = syscall.Fallocate(int(f.Fd()), 0, 0, size)
+	if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS) {
+		return f.Truncate(size)
+	}
+	if err != nil {
+		return &os.PathError{Op: "fallocate", Path: f.Name(), Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package lz4
+
+import "os"
+
+func preallocate(f *os.File, size int64) error {
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return err
+	}
+	return f.Truncate(size)
+}
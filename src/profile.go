@@ -0,0 +1,54 @@
+package lz4
+
+import (
+	"crypto/sha256"
+	"errors"
+)
+
+const digestTag = "RZSH"
+
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// WithSHA256 makes a Writer store the SHA-256 of everything written in a
+// skippable frame after the last data frame, tagged "RZSH", for long-term
+// integrity checks with standard tools.
+func WithSHA256() Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			w.digest = sha256.New()
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// ArchiveProfile bundles the settings for long-term storage: 4MB blocks
+// compressed at the highest HC level, block and content checksums, and a
+// stored SHA-256 of the input. The content size is left to the caller, who
+// may know it: see WithContentSize.
+func ArchiveProfile() Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			return w.Apply(WithBlockSize(4<<20), WithLevel(maxLevel), WithBlockChecksum(), WithContentChecksum(), WithSHA256())
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// Profile returns the preset called name; "archive" is ArchiveProfile.
+func Profile(name string) (Option, error) {
+	switch name {
+	case "archive":
+		return ArchiveProfile(), nil
+	}
+	return nil, ErrUnknownProfile
+}
+
+func (w *Writer) writeDigest() error {
+	if w.digest == nil {
+		return nil
+	}
+	return writeSkippableFrame(w.dst, digestNibble, w.digest.Sum([]byte(digestTag)))
+}
@@ -0,0 +1,176 @@
+package lz4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+// SkippedRange describes input bytes a Reader in recovery mode dropped after
+// finding a corrupt block, as offsets into the compressed stream.
+type SkippedRange struct {
+	Start int64
+	End   int64
+	Err   error
+}
+
+// WithRecovery makes a Reader resynchronize when a block turns out to be
+// corrupt, instead of failing: it scans forward for the magic number of a
+// frame, legacy frame or skippable frame, or, in a frame of independent
+// blocks with block checksums, for a block whose checksum matches, and
+// resumes there. Every dropped range is passed to report. Content
+// checksums and checkpoints are not verified once data has been dropped.
+func WithRecovery(report func(SkippedRange)) Option {
+	return func(a applier) error {
+		switch r := a.(type) {
+		case *Reader:
+			r.recovery = report
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// WithReturnPartialOnError makes a Reader deliver the bytes of a corrupt or
+// truncated block that decoded successfully before returning the error, to
+// salvage as much as possible from damaged input. Those bytes end where the
+// damage was detected, which may be after it occurred. WithRecovery takes
+// precedence for corrupt blocks.
+func WithReturnPartialOnError() Option {
+	return func(a applier) error {
+		switch r := a.(type) {
+		case *Reader:
+			r.partial = true
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// resyncLookahead is how far resync scans before it drops the bytes behind
+// it.
+const resyncLookahead = 64 << 10
+
+// resync scans forward from a corrupt block, whose size field is at offset
+// start, for a point to resume decoding at, as WithRecovery describes.
+// Scanning starts at start+1, with consumed holding the bytes already read
+// from there on. If the input ends first, the Reader stops there.
+func (r *Reader) resync(start int64, cause error, consumed []byte) error {
+	r.checksum = nil
+	r.cumulative = nil
+	// Linked blocks would decode against the history that was dropped
+	blocks := r.header.Magic == magic && r.header.BlocksIndependentFlag && r.header.BlocksChecksumFlag
+	buf, base := consumed, start+1
+	for i := 0; ; i++ {
+		if i >= resyncLookahead && 2*i >= len(buf) {
+			buf = append(buf[:0], buf[i:]...)
+			base += int64(i)
+			i = 0
+		}
+		var err error
+		if buf, err = r.fill(buf, i+maxFrameHeaderSize); err != nil {
+			return err
+		}
+		if len(buf) < i+4 {
+			r.skipped(start, base+int64(len(buf)), cause)
+			r.finish()
+			return nil
+		}
+
+		switch w := binary.LittleEndian.Uint32(buf[i:]); {
+		case w == magic || w == legacyMagic:
+			header := bytes.NewReader(buf[i:])
+			h, err := ReadFrameHeader(header)
+			if err != nil {
+				continue
+			}
+			r.skipped(start, base+int64(i), cause)
+			rest := len(buf) - header.Len()
+			r.unread(buf[rest:], base+int64(rest))
+			return r.startFrame(h)
+
+		case isSkippableMagic(w):
+			// The current frame ended before it, and the scan goes on
+			// after it
+			r.skipped(start, base+int64(i), cause)
+			r.unread(buf[i+4:], base+int64(i+4))
+			if err := r.skipSkippable(); err != nil {
+				return err
+			}
+			blocks = false
+			buf, base, start, i = nil, r.src.n, r.src.n, -1
+
+		case blocks:
+			size := w &^ 0x80000000
+			if size == endMark || size > r.header.BlockMaxSize {
+				continue
+			}
+			end := i + 4 + int(size)
+			if buf, err = r.fill(buf, end+8); err != nil {
+				return err
+			}
+			if len(buf) < end+4 {
+				continue
+			}
+			// Only hash blocks followed by what may be another block or the
+			// end mark
+			if len(buf) >= end+8 {
+				if next := binary.LittleEndian.Uint32(buf[end+4:]) &^ 0x80000000; next > r.header.BlockMaxSize {
+					continue
+				}
+			}
+			if xxHash32.Checksum(buf[i+4:end], 0) != binary.LittleEndian.Uint32(buf[end:]) {
+				continue
+			}
+			r.skipped(start, base+int64(i), cause)
+			r.unread(buf[i:], base+int64(i))
+			return nil
+		}
+	}
+}
+
+// skipped reports the bytes from start to end as dropped, unless there are
+// none.
+func (r *Reader) skipped(start, end int64, cause error) {
+	if end > start {
+		r.recovery(SkippedRange{Start: start, End: end, Err: cause})
+	}
+}
+
+// fill reads from the input until buf holds n bytes or the input ends.
+func (r *Reader) fill(buf []byte, n int) ([]byte, error) {
+	if len(buf) >= n {
+		return buf, nil
+	}
+	if cap(buf) < n {
+		grown := make([]byte, len(buf), max(n, 2*cap(buf), resyncLookahead))
+		copy(grown, buf)
+		buf = grown
+	}
+	m, err := io.ReadAtLeast(r.src, buf[len(buf):cap(buf)], n-len(buf))
+	buf = buf[:len(buf)+m]
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return buf, err
+}
+
+// unread puts p, which was read from offset off of the input, back in front
+// of the rest of it.
+func (r *Reader) unread(p []byte, off int64) {
+	r.src.r = io.MultiReader(bytes.NewReader(p), r.src.r)
+	r.src.n = off
+}
+
+// corruptBlock returns the bytes of a corrupt block read after the first
+// byte of its size field, for resync to scan again: the rest of the size
+// field, then the data and checksum of the block if they were read.
+func (r *Reader) corruptBlock(size [4]byte, data []byte) []byte {
+	b := append(size[1:4:4], data...)
+	if data != nil && r.header.BlocksChecksumFlag {
+		b = append(b, r.word[:]...)
+	}
+	return b
+}
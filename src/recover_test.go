@@ -0,0 +1,111 @@
+package lz4_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	lz4 "rzstd/src"
+)
+
+// recoverAll decompresses stream in recovery mode, returning what it
+// decodes to and the ranges it drops.
+func recoverAll(t *testing.T, stream []byte) ([]byte, []lz4.SkippedRange) {
+	t.Helper()
+	var skipped []lz4.SkippedRange
+	out := decompress(t, stream, lz4.WithRecovery(func(s lz4.SkippedRange) {
+		skipped = append(skipped, s)
+	}))
+	return out, skipped
+}
+
+// blockOffsets lists the offsets of the blocks of the first frame of stream.
+func blockOffsets(t *testing.T, stream []byte) []int64 {
+	t.Helper()
+	frames, err := lz4.Inspect(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var offsets []int64
+	for _, b := range frames[0].Blocks {
+		offsets = append(offsets, b.Offset)
+	}
+	return offsets
+}
+
+// TestRecoveryBlockChecksums damages one block of a frame with block
+// checksums, which recovery drops alone, resuming at the next block.
+func TestRecoveryBlockChecksums(t *testing.T) {
+	data := testInput(256 << 10)
+	stream := compress(t, data, lz4.WithBlockSize(64<<10), lz4.WithBlockChecksum())
+	blocks := blockOffsets(t, stream)
+	stream[blocks[1]+20] ^= 0xFF
+
+	if _, err := io.ReadAll(lz4.NewReader(bytes.NewReader(stream))); !errors.Is(err, lz4.ErrBlockChecksum) {
+		t.Fatalf("Read without recovery = %v, want %v", err, lz4.ErrBlockChecksum)
+	}
+	out, skipped := recoverAll(t, stream)
+	if want := append(bytes.Clone(data[:64<<10]), data[128<<10:]...); !bytes.Equal(out, want) {
+		t.Errorf("recovered %d bytes, want the %d outside the damaged block", len(out), len(want))
+	}
+	want := lz4.SkippedRange{Start: blocks[1], End: blocks[2], Err: lz4.ErrBlockChecksum}
+	if len(skipped) != 1 || skipped[0] != want {
+		t.Errorf("skipped %+v, want %+v", skipped, want)
+	}
+}
+
+// TestRecoveryNextFrame damages the size field of a block of a frame
+// without block checksums, which recovery drops the rest of, resuming at
+// the next frame. Damage in the last frame drops the rest of the stream.
+func TestRecoveryNextFrame(t *testing.T) {
+	first, second := testInput(256<<10), testInput(10<<10)
+	frame := compress(t, first, lz4.WithBlockSize(64<<10))
+	stream := append(bytes.Clone(frame), compress(t, second)...)
+	blocks := blockOffsets(t, stream)
+	binary.LittleEndian.PutUint32(stream[blocks[1]:], 0x7FFFFFFF)
+
+	out, skipped := recoverAll(t, stream)
+	if want := append(bytes.Clone(first[:64<<10]), second...); !bytes.Equal(out, want) {
+		t.Errorf("recovered %d bytes, want %d", len(out), len(want))
+	}
+	want := lz4.SkippedRange{Start: blocks[1], End: int64(len(frame)), Err: lz4.ErrBlockTooLarge}
+	if len(skipped) != 1 || skipped[0] != want {
+		t.Errorf("skipped %+v, want %+v", skipped, want)
+	}
+
+	out, skipped = recoverAll(t, stream[:len(frame)])
+	if !bytes.Equal(out, first[:64<<10]) {
+		t.Errorf("recovered %d bytes of the last frame, want %d", len(out), 64<<10)
+	}
+	want.End = int64(len(frame))
+	if len(skipped) != 1 || skipped[0] != want {
+		t.Errorf("skipped %+v in the last frame, want %+v", skipped, want)
+	}
+}
+
+// TestReturnPartialOnError cuts a stream inside a block: the Reader
+// delivers the blocks before it and part of the cut one, then the error.
+func TestReturnPartialOnError(t *testing.T) {
+	data := testInput(256 << 10)
+	stream := compress(t, data, lz4.WithBlockSize(64<<10))
+	blocks := blockOffsets(t, stream)
+	cut := stream[:(blocks[2]+blocks[3])/2]
+
+	r := lz4.NewReader(bytes.NewReader(cut))
+	if err := r.Apply(lz4.WithReturnPartialOnError()); err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Read = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if len(out) <= 128<<10 || !bytes.Equal(out, data[:len(out)]) {
+		t.Errorf("got %d bytes, want a prefix of the input longer than %d", len(out), 128<<10)
+	}
+	out, _ = io.ReadAll(lz4.NewReader(bytes.NewReader(cut)))
+	if len(out) != 128<<10 {
+		t.Errorf("got %d bytes without WithReturnPartialOnError, want %d", len(out), 128<<10)
+	}
+}
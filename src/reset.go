@@ -0,0 +1,60 @@
+package lz4
+
+import "io"
+
+// Reset discards the state of w, including anything written but not yet
+// flushed, and makes it write a new stream to dst with the same options. The
+// hash table and scratch buffers are kept, so Writers can be recycled
+// through a sync.Pool without reallocating them for every stream. The
+// wrappers installed by WithTee and WithDstWrapper go with the old
+// destination and have to be applied again.
+func (w *Writer) Reset(dst io.Writer) {
+	if !w.closed {
+		// Waits for the blocks being compressed in the background
+		w.Abort()
+	}
+	w.releasePending()
+
+	w.dst = NewCountingWriter(dst)
+	w.err, w.closed = nil, false
+	w.headerWritten, w.blocksInFrame, w.frames, w.consumed = false, 0, 0, 0
+	w.sections, w.sectionOpen = nil, false
+	w.seekIndex = nil
+	w.stats = Stats{}
+	w.cumulative, w.checksumBlocks, w.sinceChecksum = nil, 0, 0
+	w.content = nil
+	w.queued = 0
+	w.codecWriter = nil
+	if w.digest != nil {
+		w.digest.Reset()
+	}
+	if w.parity != nil {
+		w.parity = &parityEncoder{data: w.parity.data, parity: w.parity.parity}
+	}
+	if w.adaptive {
+		w.adaptStep, w.adaptProbe, w.adaptRawBlocks = -1, false, 0
+		w.adaptSpeed = [len(adaptLadder)]float64{}
+	}
+	if w.targetThroughput > 0 {
+		// Start again from the acceleration of the level
+		WithLevel(w.level)(w)
+	}
+}
+
+// Reset discards the state of r, including any data read ahead, and makes
+// it read a new stream from src with the same options. Its block buffers are
+// kept for the next stream. A size given to NewReaderN is forgotten, and the
+// wrapper installed by WithSrcWrapper goes with the old source.
+func (r *Reader) Reset(src io.Reader) {
+	r.dropBlocks()
+	r.releaseLeftover()
+
+	r.src = NewCountingReader(src)
+	r.err, r.pendingErr, r.closed, r.eof = nil, nil, false, false
+	r.headerRead, r.header = false, nil
+	r.checksum, r.cumulative, r.checksumBlocks, r.checksumSize = nil, nil, 0, 0
+	r.expected, r.delivered = -1, 0
+	r.frameSize, r.frameRead, r.magicRead = 0, false, false
+	r.dict = nil
+	r.codecReader = nil
+}
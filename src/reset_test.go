@@ -0,0 +1,78 @@
+package lz4_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	lz4 "rzstd/src"
+	"rzstd/src/lz4test"
+)
+
+// TestWriterReset reuses a Writer after a stream that failed and one left
+// in the middle of a block. Each new stream must match that of a fresh
+// Writer.
+func TestWriterReset(t *testing.T) {
+	first, second := testInput(200<<10), testInput(150<<10)
+	for _, concurrency := range []int{1, 4} {
+		options := []lz4.Option{lz4.WithBlockSize(64 << 10), lz4.WithContentChecksum(), lz4.WithConcurrency(concurrency)}
+		want := compress(t, second, options...)
+
+		w := lz4.NewWriter(io.Discard)
+		if err := w.Apply(append(options, lz4.WithDstWrapper(lz4test.FailWrites(0, errFault, 1)))...); err != nil {
+			t.Fatal(err)
+		}
+		w.Write(first)
+		if err := w.Close(); !errors.Is(err, errFault) {
+			t.Fatalf("concurrency %d: Close = %v, want %v", concurrency, err, errFault)
+		}
+
+		for _, written := range []int{0, 1000} {
+			var buf bytes.Buffer
+			w.Reset(&buf)
+			if _, err := w.Write(second); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("concurrency %d: stream after Reset differs from a fresh Writer's", concurrency)
+			}
+			// Leave part of a block behind for the next Reset
+			w.Reset(io.Discard)
+			w.Write(first[:written])
+		}
+	}
+}
+
+// TestReaderReset reuses a Reader after a stream it stopped reading midway
+// and one that failed.
+func TestReaderReset(t *testing.T) {
+	first, second := testInput(200<<10), testInput(150<<10)
+	stream := compress(t, first, lz4.WithBlockSize(64<<10))
+	want := compress(t, second, lz4.WithBlockSize(64<<10))
+	for _, concurrency := range []int{1, 4} {
+		r := lz4.NewReader(bytes.NewReader(stream))
+		if err := r.Apply(lz4.WithConcurrency(concurrency)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(r, make([]byte, 1000)); err != nil {
+			t.Fatal(err)
+		}
+		r.Reset(bytes.NewReader(want))
+		if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, second) {
+			t.Errorf("concurrency %d: after a partial read, Reset stream = %d bytes, %v", concurrency, len(got), err)
+		}
+
+		r.Reset(bytes.NewReader(stream[:len(stream)/2]))
+		if _, err := io.ReadAll(r); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("concurrency %d: truncated stream = %v", concurrency, err)
+		}
+		r.Reset(bytes.NewReader(want))
+		if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, second) {
+			t.Errorf("concurrency %d: after an error, Reset stream = %d bytes, %v", concurrency, len(got), err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package lz4
+
+import (
+	"fmt"
+	"io"
+)
+
+// blockScanner walks the blocks of every frame in a stream, skipping
+// skippable frames, without decoding them.
+type blockScanner struct {
+	walk *frameWalker
+	// resolve finds the dictionary of a frame that names one, for decode,
+	// and dictErr is why there is none. history is the dictionary of the
+	// current frame, followed by its previous blocks if they are linked,
+	// which window holds.
+	resolve func(id uint32) ([]byte, error)
+	dictErr error
+	history []byte
+	window  []byte
+}
+
+func newBlockScanner(src io.Reader, resolve func(id uint32) ([]byte, error)) *blockScanner {
+	return &blockScanner{walk: newFrameWalker(src), resolve: resolve}
+}
+
+// next returns the next block, or io.EOF once the input ends on a frame
+// boundary.
+func (s *blockScanner) next() (*scannedBlock, error) {
+	for {
+		if s.walk.header == nil {
+			m, _, err := s.walk.magic()
+			if err != nil {
+				return nil, err
+			}
+			if isSkippableMagic(m) {
+				if err := s.walk.skip(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			header, checksumOK, err := s.walk.readHeader(m)
+			if err != nil {
+				return nil, err
+			}
+			if !checksumOK {
+				return nil, ErrHeaderChecksum
+			}
+			s.history, s.dictErr = nil, nil
+			if header.DictIDFlag {
+				s.history, s.dictErr = resolveDictionary(s.resolve, header.DictID)
+			}
+		}
+
+		block, err := s.walk.block()
+		if err != nil {
+			return nil, err
+		}
+		if block != nil {
+			return block, nil
+		}
+		if _, err := s.walk.endFrame(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// decode returns the uncompressed contents of b, reusing dst when possible.
+// In a frame of linked blocks, every block has to be decoded in turn. It
+// fails with the error of resolve if the frame needs a dictionary that
+// could not be found.
+func (s *blockScanner) decode(b *scannedBlock, dst []byte) ([]byte, error) {
+	header := s.walk.header
+	if b.Uncompressed {
+		dst = append(dst[:0], b.Data...)
+	} else {
+		if s.dictErr != nil {
+			return nil, s.dictErr
+		}
+		if cap(dst) < int(header.BlockMaxSize) {
+			dst = make([]byte, header.BlockMaxSize)
+		}
+		dst = dst[:cap(dst)]
+		n, err := decompressBlockDict(b.Data, dst, s.history, minMatchLength)
+		if err != nil {
+			return nil, err
+		}
+		dst = dst[:n]
+	}
+	if !header.BlocksIndependentFlag {
+		s.window = slideWindow(s.window, s.history, dst)
+		s.history = s.window
+	}
+	return dst, nil
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// errNoEndMark matches both ErrMissingEndMark and io.ErrUnexpectedEOF.
+var errNoEndMark = fmt.Errorf("%w: %w", ErrMissingEndMark, io.ErrUnexpectedEOF)
+
+// noEndMark is noEOF for a stream that ends where a block size or the end
+// mark should be.
+func noEndMark(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errNoEndMark
+	}
+	return err
+}
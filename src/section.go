@@ -0,0 +1,251 @@
+package lz4
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+const (
+	sectionIndexTag = "RZSI"
+	footerTag       = "RZFT"
+	// Skippable frame header, tag, index offset (8), index frame size (4)
+	// and a checksum of the payload (4)
+	footerSize = skippableHeaderSize + 4 + 8 + 4 + 4
+)
+
+var (
+	ErrNoSectionIndex  = errors.New("no section index")
+	ErrSectionNotFound = errors.New("section not found")
+	ErrSectionName     = errors.New("section name too long")
+)
+
+// Section is a named part of a stream. It starts on a frame boundary at
+// Offset and spans Length bytes of compressed output.
+type Section struct {
+	Name   string
+	Offset int64
+	Length int64
+}
+
+// StartSection ends the current frame, if any, and starts a new one that
+// begins the section called name. On Close the names and offsets of all
+// sections are appended to the stream as a skippable frame, which other LZ4
+// decoders ignore, followed by a fixed-size footer locating it; OpenSection
+// uses it to decode a single section.
+func (w *Writer) StartSection(name string) error {
+	if len(name) > 0xFFFF {
+		return ErrSectionName
+	}
+	if err := w.drain(); err != nil {
+		return err
+	}
+	if w.headerWritten {
+		if err := w.endFrame(); err != nil {
+			return err
+		}
+	}
+	w.endSection()
+	if err := w.alignOutput(); err != nil {
+		return err
+	}
+	w.sections = append(w.sections, Section{Name: name, Offset: w.dst.n})
+	w.sectionOpen = true
+	return w.WriteHeader()
+}
+
+func (w *Writer) endSection() {
+	if w.sectionOpen {
+		s := &w.sections[len(w.sections)-1]
+		s.Length = w.dst.n - s.Offset
+		w.sectionOpen = false
+	}
+}
+
+func (w *Writer) writeSectionIndex() error {
+	w.endSection()
+	if len(w.sections) == 0 {
+		return nil
+	}
+
+	payload := append([]byte(sectionIndexTag), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(payload[4:], uint32(len(w.sections)))
+	for _, s := range w.sections {
+		payload = binary.LittleEndian.AppendUint16(payload, uint16(len(s.Name)))
+		payload = append(payload, s.Name...)
+		payload = binary.LittleEndian.AppendUint64(payload, uint64(s.Offset))
+		payload = binary.LittleEndian.AppendUint64(payload, uint64(s.Length))
+	}
+	w.sections = nil
+	offset := w.dst.n
+	if err := writeSkippableFrame(w.dst, sectionIndexNibble, payload); err != nil {
+		return err
+	}
+
+	footer := append([]byte(footerTag), make([]byte, 12)...)
+	binary.LittleEndian.PutUint64(footer[4:], uint64(offset))
+	binary.LittleEndian.PutUint32(footer[12:], uint32(w.dst.n-offset))
+	footer = binary.LittleEndian.AppendUint32(footer, xxHash32.Checksum(footer, 0))
+	return writeSkippableFrame(w.dst, footerNibble, footer)
+}
+
+// readFooter returns the section index located by the footer at the end of
+// the stream and the offset of its frame, or nil if there is no valid
+// footer.
+func readFooter(r io.ReaderAt, size int64) ([]byte, int64) {
+	if size < footerSize {
+		return nil, 0
+	}
+	var footer [footerSize]byte
+	if _, err := r.ReadAt(footer[:], size-footerSize); err != nil {
+		return nil, 0
+	}
+	p := footer[skippableHeaderSize:]
+	if binary.LittleEndian.Uint32(footer[:]) != skippableMagic|footerNibble ||
+		binary.LittleEndian.Uint32(footer[4:]) != uint32(len(p)) ||
+		string(p[:4]) != footerTag ||
+		xxHash32.Checksum(p[:16], 0) != binary.LittleEndian.Uint32(p[16:]) {
+		return nil, 0
+	}
+
+	offset := int64(binary.LittleEndian.Uint64(p[4:]))
+	n := int64(binary.LittleEndian.Uint32(p[12:]))
+	if offset < 0 || n < skippableHeaderSize+8 || offset+n > size-footerSize {
+		return nil, 0
+	}
+	frame := make([]byte, n)
+	if _, err := r.ReadAt(frame, offset); err != nil {
+		return nil, 0
+	}
+	payload := frame[skippableHeaderSize:]
+	if binary.LittleEndian.Uint32(frame) != skippableMagic|sectionIndexNibble ||
+		binary.LittleEndian.Uint32(frame[4:]) != uint32(len(payload)) ||
+		string(payload[:4]) != sectionIndexTag {
+		return nil, 0
+	}
+	return payload, offset
+}
+
+// Sections returns the section index of a stream written with StartSection.
+// The footer at the end of the stream locates it directly; without a valid
+// footer frames are skipped using their block size prefixes, so no payload
+// is decompressed.
+func Sections(r io.ReaderAt, size int64) ([]Section, error) {
+	if payload, _ := readFooter(r, size); payload != nil {
+		return parseSectionIndex(payload)
+	}
+
+	sr := io.NewSectionReader(r, 0, size)
+	var buf [4]byte
+	for {
+		if _, err := io.ReadFull(sr, buf[:]); err != nil {
+			if err == io.EOF {
+				return nil, ErrNoSectionIndex
+			}
+			return nil, err
+		}
+
+		m := binary.LittleEndian.Uint32(buf[:])
+		if isSkippableMagic(m) {
+			if _, err := io.ReadFull(sr, buf[:]); err != nil {
+				return nil, err
+			}
+			n := int64(binary.LittleEndian.Uint32(buf[:]))
+			if n > size {
+				return nil, ErrCorrupted
+			}
+			payload := make([]byte, n)
+			if _, err := io.ReadFull(sr, payload); err != nil {
+				return nil, err
+			}
+			if len(payload) >= 8 && string(payload[:4]) == sectionIndexTag {
+				return parseSectionIndex(payload)
+			}
+			continue
+		}
+
+		if _, err := sr.Seek(-4, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+		if err := skipFrame(sr); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// OpenSection returns a Reader decoding only the section called name.
+func OpenSection(r io.ReaderAt, size int64, name string) (*Reader, error) {
+	sections, err := Sections(r, size)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sections {
+		if s.Name == name {
+			return NewReader(io.NewSectionReader(r, s.Offset, s.Length)), nil
+		}
+	}
+	return nil, ErrSectionNotFound
+}
+
+func skipFrame(rs io.ReadSeeker) error {
+	header, err := ReadFrameHeader(rs)
+	if err != nil {
+		return err
+	}
+
+	var sizeBuf [4]byte
+	for {
+		if _, err := io.ReadFull(rs, sizeBuf[:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		size := binary.LittleEndian.Uint32(sizeBuf[:])
+		if size == 0 {
+			break
+		}
+		skip := int64(size &^ 0x80000000)
+		if header.BlocksChecksumFlag {
+			skip += 4
+		}
+		if _, err := rs.Seek(skip, io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+
+	if header.ContentChecksumFlag {
+		if _, err := rs.Seek(4, io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseSectionIndex(payload []byte) ([]Section, error) {
+	count := binary.LittleEndian.Uint32(payload[4:])
+	p := payload[8:]
+	if int(count) > len(p)/18 {
+		return nil, ErrCorrupted
+	}
+	sections := make([]Section, 0, count)
+	for i := uint32(0); i < count; i++ {
+		if len(p) < 2 {
+			return nil, ErrCorrupted
+		}
+		nameLen := int(binary.LittleEndian.Uint16(p))
+		p = p[2:]
+		if len(p) < nameLen+16 {
+			return nil, ErrCorrupted
+		}
+		sections = append(sections, Section{
+			Name:   string(p[:nameLen]),
+			Offset: int64(binary.LittleEndian.Uint64(p[nameLen:])),
+			Length: int64(binary.LittleEndian.Uint64(p[nameLen+8:])),
+		})
+		p = p[nameLen+16:]
+	}
+	return sections, nil
+}
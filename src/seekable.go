@@ -0,0 +1,295 @@
+package lz4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+const (
+	seekIndexTag = "RZSK"
+	// The index ends with the uncompressed size (8), the number of entries
+	// (4), flags (4), a checksum of the index (4) and the tag, so that it
+	// can be found from its end
+	seekTrailerSize = 8 + 4 + 4 + 4 + 4
+	seekEntrySize   = 16
+
+	seekBlockChecksums = 1
+)
+
+var (
+	ErrNoSeekIndex         = errors.New("no seek index")
+	ErrSeekIndexBlocks     = errors.New("a seek index requires independent blocks without a dictionary")
+	ErrSeekIndexCheckpoint = errors.New("checkpoints are not supported with a seek index")
+	ErrNegativeOffset      = errors.New("negative offset")
+)
+
+// seekEntry locates a block: the offset of its size field in the
+// compressed stream and the offset of its first byte in the input.
+type seekEntry struct {
+	compressed   int64
+	uncompressed int64
+}
+
+// WithSeekIndex makes a Writer record where every block starts, in the
+// output and in the input, and append that index on Close as a skippable
+// frame, which other decoders ignore. NewSeekableReader uses it to decode
+// any range of the input without the blocks before it, so smaller blocks
+// make for cheaper random access. Blocks have to be decodable on their own:
+// with WithLinkedBlocks or WithDictionary, writing fails with
+// ErrSeekIndexBlocks.
+func WithSeekIndex() Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			w.seekable = true
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// checkSeekable fails if the blocks of w cannot be indexed.
+func (w *Writer) checkSeekable() error {
+	if w.seekable && (w.linked || w.dict != nil) {
+		w.err = ErrSeekIndexBlocks
+		return w.err
+	}
+	return nil
+}
+
+// writeSeekIndex writes the index of WithSeekIndex.
+func (w *Writer) writeSeekIndex() error {
+	if !w.seekable {
+		return nil
+	}
+	payload := make([]byte, 0, len(w.seekIndex)*seekEntrySize+seekTrailerSize)
+	for _, e := range w.seekIndex {
+		payload = binary.LittleEndian.AppendUint64(payload, uint64(e.compressed))
+		payload = binary.LittleEndian.AppendUint64(payload, uint64(e.uncompressed))
+	}
+	var flags uint32
+	if w.blockChecksum {
+		flags |= seekBlockChecksums
+	}
+	payload = binary.LittleEndian.AppendUint64(payload, uint64(w.consumed))
+	payload = binary.LittleEndian.AppendUint32(payload, uint32(len(w.seekIndex)))
+	payload = binary.LittleEndian.AppendUint32(payload, flags)
+	payload = binary.LittleEndian.AppendUint32(payload, xxHash32.Checksum(payload, 0))
+	payload = append(payload, seekIndexTag...)
+	w.seekIndex = nil
+	return writeSkippableFrame(w.dst, seekIndexNibble, payload)
+}
+
+// SeekableReader decodes a stream written with WithSeekIndex at random
+// offsets. It reads only the blocks that hold the bytes asked for, and
+// keeps the last one it decoded for the reads that follow. Read and Seek
+// share a position, so they are not safe for concurrent use, but ReadAt
+// is.
+type SeekableReader struct {
+	src       io.ReaderAt
+	index     []seekEntry
+	size      int64
+	checksums bool
+	pos       int64
+
+	// mu guards the last decoded block, which is block number cached
+	mu         sync.Mutex
+	cached     int
+	block      []byte
+	compressed []byte
+}
+
+// NewSeekableReader returns a SeekableReader for the stream of size bytes
+// in r, which must end with the seek index, or with the section index of
+// StartSection right after it. It fails with ErrNoSeekIndex if there is
+// none.
+func NewSeekableReader(r io.ReaderAt, size int64) (*SeekableReader, error) {
+	end := size
+	if _, offset := readFooter(r, size); offset > 0 {
+		end = offset
+	}
+	if end < skippableHeaderSize+seekTrailerSize {
+		return nil, ErrNoSeekIndex
+	}
+	var trailer [seekTrailerSize]byte
+	if _, err := r.ReadAt(trailer[:], end-seekTrailerSize); err != nil {
+		return nil, err
+	}
+	if string(trailer[20:]) != seekIndexTag {
+		return nil, ErrNoSeekIndex
+	}
+	count := int64(binary.LittleEndian.Uint32(trailer[8:]))
+	n := skippableHeaderSize + count*seekEntrySize + seekTrailerSize
+	if n > end {
+		return nil, ErrNoSeekIndex
+	}
+	frame := make([]byte, n)
+	if _, err := r.ReadAt(frame, end-n); err != nil {
+		return nil, err
+	}
+	payload := frame[skippableHeaderSize:]
+	sumOffset := len(payload) - 8
+	if binary.LittleEndian.Uint32(frame) != skippableMagic|seekIndexNibble ||
+		binary.LittleEndian.Uint32(frame[4:]) != uint32(len(payload)) {
+		return nil, ErrNoSeekIndex
+	}
+	if xxHash32.Checksum(payload[:sumOffset], 0) != binary.LittleEndian.Uint32(payload[sumOffset:]) {
+		return nil, fmt.Errorf("%w: seek index checksum mismatch", ErrCorrupted)
+	}
+
+	s := &SeekableReader{
+		src:       r,
+		index:     make([]seekEntry, count),
+		size:      int64(binary.LittleEndian.Uint64(trailer[:])),
+		checksums: binary.LittleEndian.Uint32(trailer[12:])&seekBlockChecksums != 0,
+		cached:    -1,
+	}
+	for i := range s.index {
+		e := payload[i*seekEntrySize:]
+		s.index[i] = seekEntry{
+			compressed:   int64(binary.LittleEndian.Uint64(e)),
+			uncompressed: int64(binary.LittleEndian.Uint64(e[8:])),
+		}
+	}
+	// Later code relies on sorted, in-range offsets, starting from the
+	// first byte of the input
+	if count == 0 && s.size != 0 || count > 0 && s.index[0].uncompressed != 0 {
+		return nil, fmt.Errorf("%w: invalid seek index", ErrCorrupted)
+	}
+	prev := seekEntry{}
+	for _, e := range s.index {
+		if e.compressed < prev.compressed || e.compressed >= end-n || e.uncompressed < prev.uncompressed || e.uncompressed > s.size {
+			return nil, fmt.Errorf("%w: invalid seek index", ErrCorrupted)
+		}
+		prev = e
+	}
+	return s, nil
+}
+
+// Size returns the uncompressed size of the stream.
+func (s *SeekableReader) Size() int64 {
+	return s.size
+}
+
+func (s *SeekableReader) Read(p []byte) (int, error) {
+	n, err := s.ReadAt(p, s.pos)
+	s.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the offset in the uncompressed stream for the next Read.
+func (s *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, fmt.Errorf("lz4: invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, ErrNegativeOffset
+	}
+	s.pos = offset
+	return offset, nil
+}
+
+// ReadAt reads len(p) bytes of the uncompressed stream from offset off.
+func (s *SeekableReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrNegativeOffset
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := 0
+	for total < len(p) && off < s.size {
+		// The last block starting at or before off holds it
+		i := sort.Search(len(s.index), func(i int) bool { return s.index[i].uncompressed > off }) - 1
+		block, err := s.decodeBlock(i)
+		if err != nil {
+			return total, err
+		}
+		start := off - s.index[i].uncompressed
+		n := copy(p[total:], block[start:])
+		total += n
+		off += int64(n)
+	}
+	if total < len(p) {
+		return total, io.EOF
+	}
+	return total, nil
+}
+
+// decodeBlock returns block i, decoding it unless it is cached.
+func (s *SeekableReader) decodeBlock(i int) ([]byte, error) {
+	if i == s.cached {
+		return s.block, nil
+	}
+	s.cached = -1
+	e := s.index[i]
+	end := s.size
+	if i+1 < len(s.index) {
+		end = s.index[i+1].uncompressed
+	}
+	length := int(end - e.uncompressed)
+
+	var word [4]byte
+	if _, err := s.src.ReadAt(word[:], e.compressed); err != nil {
+		return nil, noEOF(err)
+	}
+	size := binary.LittleEndian.Uint32(word[:])
+	uncompressed := size&0x80000000 != 0
+	size &^= 0x80000000
+	if size == 0 || int(size) > compressBound(length) {
+		return nil, fmt.Errorf("%w: block %d", ErrCorrupted, i)
+	}
+	n := int(size)
+	if s.checksums {
+		n += 4
+	}
+	if cap(s.compressed) < n {
+		s.compressed = make([]byte, n)
+	}
+	data := s.compressed[:n]
+	if _, err := s.src.ReadAt(data, e.compressed+4); err != nil {
+		return nil, noEOF(err)
+	}
+	if s.checksums {
+		data, n = data[:size], int(size)
+		if xxHash32.Checksum(data, 0) != binary.LittleEndian.Uint32(s.compressed[n:]) {
+			return nil, fmt.Errorf("%w: block %d", ErrBlockChecksum, i)
+		}
+	}
+
+	if uncompressed {
+		if len(data) != length {
+			return nil, fmt.Errorf("%w: block %d", ErrCorrupted, i)
+		}
+		s.block = append(s.block[:0], data...)
+	} else {
+		if cap(s.block) < length {
+			s.block = make([]byte, length)
+		}
+		s.block = s.block[:length]
+		m, err := decompressBlock(data, s.block, minMatchLength)
+		if err != nil {
+			return nil, fmt.Errorf("%w: block %d", err, i)
+		}
+		if m != length {
+			return nil, fmt.Errorf("%w: block %d", ErrCorrupted, i)
+		}
+	}
+	s.cached = i
+	return s.block, nil
+}
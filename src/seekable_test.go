@@ -0,0 +1,57 @@
+package lz4_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	lz4 "rzstd/src"
+)
+
+func TestSeekableReader(t *testing.T) {
+	data := testInput(500<<10 + 123)
+	stream := compress(t, data, lz4.WithBlockSize(64<<10), lz4.WithSeekIndex(), lz4.WithBlockChecksum())
+	if got := decompress(t, stream); !bytes.Equal(got, data) {
+		t.Fatal("a plain Reader does not skip the seek index")
+	}
+
+	s, err := lz4.NewSeekableReader(bytes.NewReader(stream), int64(len(stream)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Size() != int64(len(data)) {
+		t.Errorf("Size = %d, want %d", s.Size(), len(data))
+	}
+	// Ranges within a block, across blocks and up to the end
+	for _, r := range [][2]int{{0, 10}, {65530, 65546}, {100, 300 << 10}, {len(data) - 5, len(data)}} {
+		p := make([]byte, r[1]-r[0])
+		if n, err := s.ReadAt(p, int64(r[0])); err != nil || !bytes.Equal(p[:n], data[r[0]:r[1]]) {
+			t.Errorf("ReadAt %v = %d, %v", r, n, err)
+		}
+	}
+	if _, err := s.Seek(-1000, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(s); err != nil || !bytes.Equal(got, data[len(data)-1000:]) {
+		t.Errorf("Read after Seek = %d bytes, %v", len(got), err)
+	}
+
+	if n, err := s.ReadAt(make([]byte, 10), int64(len(data))-5); n != 5 || err != io.EOF {
+		t.Errorf("ReadAt past the end = %d, %v, want 5, EOF", n, err)
+	}
+	if _, err := s.Seek(-1, io.SeekStart); !errors.Is(err, lz4.ErrNegativeOffset) {
+		t.Errorf("Seek before the start = %v, want %v", err, lz4.ErrNegativeOffset)
+	}
+	plain := compress(t, data)
+	if _, err := lz4.NewSeekableReader(bytes.NewReader(plain), int64(len(plain))); !errors.Is(err, lz4.ErrNoSeekIndex) {
+		t.Errorf("NewSeekableReader without an index = %v, want %v", err, lz4.ErrNoSeekIndex)
+	}
+	w := lz4.NewWriter(io.Discard)
+	if err := w.Apply(lz4.WithSeekIndex(), lz4.WithLinkedBlocks()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); !errors.Is(err, lz4.ErrSeekIndexBlocks) {
+		t.Errorf("Write of linked blocks with a seek index = %v, want %v", err, lz4.ErrSeekIndexBlocks)
+	}
+}
@@ -0,0 +1,176 @@
+package lz4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// maxSequenceOutput bounds the decoded size of a block walked by a
+// SequenceDecoder, which has no destination to check against. Frames limit
+// blocks to 4MB.
+const maxSequenceOutput = 1 << 30
+
+// Sequence is one token of a compressed block: a run of literals followed
+// by a match copying MatchLen bytes from Offset bytes back. The last
+// sequence of a block has literals only, with Offset and MatchLen 0.
+type Sequence struct {
+	// Pos is the position in the decompressed block at which the literals
+	// start.
+	Pos      int
+	Literals []byte
+	Offset   int
+	MatchLen int
+}
+
+// SequenceDecoder steps through the sequences of a raw block without
+// producing its output, for tools that analyze or transcode blocks. It is
+// used like bufio.Scanner:
+//
+//	d := NewSequenceDecoder(block)
+//	for d.Next() {
+//		seq := d.Sequence()
+//		...
+//	}
+//	if err := d.Err(); err != nil {
+//		...
+//	}
+type SequenceDecoder struct {
+	src      []byte
+	srcPos   int
+	dstPos   int
+	minMatch int
+	seq      Sequence
+	err      error
+}
+
+func NewSequenceDecoder(block []byte) *SequenceDecoder {
+	return &SequenceDecoder{src: block, minMatch: minMatchLength}
+}
+
+// Next decodes the next sequence and reports whether there was one. It
+// returns false at the end of the block or on an error, which Err returns.
+func (d *SequenceDecoder) Next() bool {
+	if d.err != nil || d.srcPos >= len(d.src) {
+		return false
+	}
+
+	token := d.src[d.srcPos]
+	d.srcPos++
+
+	litLen, ok := d.readLength(int(token>>4), len(d.src)-d.srcPos, io.ErrUnexpectedEOF)
+	if !ok {
+		return false
+	}
+	if litLen > len(d.src)-d.srcPos {
+		d.err = io.ErrUnexpectedEOF
+		return false
+	}
+	d.seq = Sequence{Pos: d.dstPos, Literals: d.src[d.srcPos : d.srcPos+litLen]}
+	d.srcPos += litLen
+	d.dstPos += litLen
+
+	if d.srcPos >= len(d.src) {
+		return true
+	}
+
+	if len(d.src)-d.srcPos < 2 {
+		d.err = io.ErrUnexpectedEOF
+		return false
+	}
+	offset := int(binary.LittleEndian.Uint16(d.src[d.srcPos:]))
+	d.srcPos += 2
+	if offset == 0 || offset > d.dstPos {
+		d.err = ErrCorrupted
+		return false
+	}
+
+	matchLen, ok := d.readLength(int(token&0x0F), maxSequenceOutput-d.dstPos, ErrBlockTooLarge)
+	if !ok {
+		return false
+	}
+	matchLen += d.minMatch
+
+	d.seq.Offset = offset
+	d.seq.MatchLen = matchLen
+	d.dstPos += matchLen
+	return true
+}
+
+// readLength completes a 4-bit length field with its extension bytes,
+// failing with tooLong as soon as the length exceeds limit so it cannot
+// overflow.
+func (d *SequenceDecoder) readLength(n, limit int, tooLong error) (int, bool) {
+	if n != 15 {
+		return n, true
+	}
+	for {
+		if d.srcPos >= len(d.src) {
+			d.err = io.ErrUnexpectedEOF
+			return 0, false
+		}
+		b := d.src[d.srcPos]
+		d.srcPos++
+		n += int(b)
+		if n > limit {
+			d.err = tooLong
+			return 0, false
+		}
+		if b != 255 {
+			return n, true
+		}
+	}
+}
+
+// Sequence returns the sequence decoded by the last call to Next. Its
+// Literals alias the block.
+func (d *SequenceDecoder) Sequence() Sequence {
+	return d.seq
+}
+
+// Err returns the first error encountered while decoding.
+func (d *SequenceDecoder) Err() error {
+	return d.err
+}
+
+// DecodedSize returns the number of bytes the sequences decoded so far
+// expand to.
+func (d *SequenceDecoder) DecodedSize() int {
+	return d.dstPos
+}
+
+// ParseSequences decodes every sequence of a raw block. Unlike the
+// decompressor it also enforces the end-of-block rules of the format: the
+// block must end with a literals-only sequence, the last match must start at
+// least mfLimit bytes before the end of the decompressed block, and the last
+// lastLiterals bytes must be literals.
+func ParseSequences(block []byte) ([]Sequence, error) {
+	var seqs []Sequence
+	d := NewSequenceDecoder(block)
+	for d.Next() {
+		seqs = append(seqs, d.Sequence())
+	}
+	if err := d.Err(); err != nil {
+		return seqs, err
+	}
+	if len(seqs) == 0 {
+		return seqs, nil
+	}
+
+	last := seqs[len(seqs)-1]
+	if last.MatchLen != 0 {
+		return seqs, fmt.Errorf("%w: block ends with a match", ErrCorrupted)
+	}
+	size := d.DecodedSize()
+	if len(seqs) > 1 {
+		m := seqs[len(seqs)-2]
+		matchPos := m.Pos + len(m.Literals)
+		if matchPos > size-mfLimit {
+			return seqs, fmt.Errorf("%w: last match starts %d bytes before the end of the block", ErrCorrupted, size-matchPos)
+		}
+		if len(last.Literals) < lastLiterals {
+			return seqs, fmt.Errorf("%w: block ends with %d literals", ErrCorrupted, len(last.Literals))
+		}
+	}
+	return seqs, nil
+}
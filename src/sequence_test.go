@@ -0,0 +1,136 @@
+package lz4_test
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+
+	lz4 "rzstd/src"
+	"rzstd/src/lz4test"
+)
+
+// TestAdversarialBlocks runs every hostile block through the decompressor
+// and both sequence parsers. The parsers have no destination, so a vector
+// that only overflows the destination must instead decode to more than it
+// holds.
+func TestAdversarialBlocks(t *testing.T) {
+	for _, v := range lz4test.AdversarialBlocks() {
+		t.Run(v.Name, func(t *testing.T) {
+			if err := v.Check(); err != nil {
+				t.Error(err)
+			}
+			dstOnly := errors.Is(v.Err, lz4.ErrBlockTooLarge)
+
+			d := lz4.NewSequenceDecoder(v.Block)
+			for d.Next() {
+			}
+			switch err := d.Err(); {
+			case !dstOnly && !errors.Is(err, v.Err):
+				t.Errorf("SequenceDecoder: got %v, want %v", err, v.Err)
+			case dstOnly && err == nil && d.DecodedSize() <= v.DstSize:
+				t.Errorf("SequenceDecoder: decoded %d bytes, want more than %d", d.DecodedSize(), v.DstSize)
+			}
+
+			seqs, err := lz4.ParseSequences(v.Block)
+			if !dstOnly && !errors.Is(err, v.Err) {
+				t.Errorf("ParseSequences: got %v, want %v", err, v.Err)
+			}
+			if dstOnly && err == nil {
+				size := 0
+				for _, s := range seqs {
+					size += len(s.Literals) + s.MatchLen
+				}
+				if size <= v.DstSize {
+					t.Errorf("ParseSequences: decoded %d bytes, want more than %d", size, v.DstSize)
+				}
+			}
+		})
+	}
+}
+
+// TestParseSequences compresses inputs whose sequences are known: a run,
+// which becomes one match at offset 1, and two copies of a pattern that
+// differ in one byte, which become two matches at the same offset. Every
+// block ends with a sequence of literals alone.
+func TestParseSequences(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	pattern := make([]byte, 64)
+	rng.Read(pattern)
+	changed := bytes.Clone(pattern)
+	changed[30] ^= 0xFF
+	tail := make([]byte, 20)
+	rng.Read(tail)
+
+	tests := []struct {
+		name  string
+		input []byte
+		want  []lz4.Sequence // Literals holds only the count
+	}{
+		{"run", bytes.Repeat([]byte{'x'}, 1000), []lz4.Sequence{
+			{Pos: 0, Literals: make([]byte, 1), Offset: 1, MatchLen: 994},
+			{Pos: 995, Literals: make([]byte, 5)},
+		}},
+		{"repeated offset", bytes.Join([][]byte{pattern, changed, tail}, nil), []lz4.Sequence{
+			{Pos: 0, Literals: make([]byte, 64), Offset: 64, MatchLen: 30},
+			{Pos: 94, Literals: make([]byte, 1), Offset: 64, MatchLen: 33},
+			{Pos: 128, Literals: make([]byte, 20)},
+		}},
+	}
+	for _, tt := range tests {
+		dst := make([]byte, lz4.CompressBlockBound(len(tt.input)))
+		n, err := lz4.CompressBlock(tt.input, dst)
+		if err != nil {
+			t.Fatalf("%s: CompressBlock: %v", tt.name, err)
+		}
+		seqs, err := lz4.ParseSequences(dst[:n])
+		if err != nil {
+			t.Fatalf("%s: ParseSequences: %v", tt.name, err)
+		}
+		if len(seqs) != len(tt.want) {
+			t.Fatalf("%s: got %d sequences, want %d", tt.name, len(seqs), len(tt.want))
+		}
+		for i, s := range seqs {
+			w := tt.want[i]
+			if s.Pos != w.Pos || len(s.Literals) != len(w.Literals) || s.Offset != w.Offset || s.MatchLen != w.MatchLen {
+				t.Errorf("%s: sequence %d = pos %d, %d literals, offset %d, match %d; want pos %d, %d literals, offset %d, match %d",
+					tt.name, i, s.Pos, len(s.Literals), s.Offset, s.MatchLen, w.Pos, len(w.Literals), w.Offset, w.MatchLen)
+			}
+			if !bytes.Equal(s.Literals, tt.input[s.Pos:s.Pos+len(s.Literals)]) {
+				t.Errorf("%s: sequence %d has literals that are not in the input", tt.name, i)
+			}
+		}
+	}
+}
+
+// TestLongMatches compresses a run far longer than the 64KB window, which
+// becomes a single match, and cuts the length of that match short.
+func TestLongMatches(t *testing.T) {
+	src := bytes.Repeat([]byte{'z'}, 4<<20)
+	dst := make([]byte, lz4.CompressBlockBound(len(src)))
+	n, err := lz4.CompressBlock(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := dst[:n]
+	seqs, err := lz4.ParseSequences(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seqs) != 2 || seqs[0].MatchLen != len(src)-6 {
+		t.Fatalf("got %d sequences, the first with a match of %d bytes; want one match of %d", len(seqs), seqs[0].MatchLen, len(src)-6)
+	}
+	out := make([]byte, len(src))
+	if m, err := lz4.DecompressBlock(block, out); err != nil || !bytes.Equal(out[:m], src) {
+		t.Fatalf("DecompressBlock = %d, %v", m, err)
+	}
+
+	// Without its last length bytes, the match runs into the end of the
+	// block
+	if _, err := lz4.DecompressBlock(block[:n/2], out); err == nil {
+		t.Error("DecompressBlock of a block cut inside a match length succeeded")
+	}
+	if _, err := lz4.ParseSequences(block[:n/2]); err == nil {
+		t.Error("ParseSequences of a block cut inside a match length succeeded")
+	}
+}
@@ -0,0 +1,144 @@
+package lz4
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+const (
+	shardTag = "RZSD"
+	// Skippable frame header, tag, offset (8), length (8), checksum (4) and
+	// a checksum of the payload (4)
+	shardSize = skippableHeaderSize + 4 + 8 + 8 + 4 + 4
+)
+
+var (
+	ErrNotShard = errors.New("not a shard")
+	ErrShardGap = errors.New("shards do not cover the input contiguously")
+)
+
+// Shard describes a byte range of an input compressed by CompressShard.
+// Checksum is the xxh32 of the range.
+type Shard struct {
+	Offset   int64
+	Length   int64
+	Checksum uint32
+}
+
+// ShardRange returns the byte range of shard k when an input of size bytes
+// is split into n shards of nearly equal length.
+func ShardRange(size int64, n, k int) (offset, length int64) {
+	offset = size * int64(k) / int64(n)
+	return offset, size*int64(k+1)/int64(n) - offset
+}
+
+// CompressShard compresses length bytes of src starting at offset to dst,
+// so that ranges of one input can be compressed on different machines and
+// joined with MergeShards. The output is a complete frame followed by a
+// skippable frame describing the shard; other LZ4 decoders see just the
+// data of the range.
+func CompressShard(src io.ReaderAt, offset, length int64, dst io.Writer, options ...Option) (Shard, error) {
+	h := xxHash32.New(0)
+	in := NewCountingReader(io.TeeReader(io.NewSectionReader(src, offset, length), h))
+	if err := CompressStream(in, dst, options...); err != nil {
+		return Shard{}, err
+	}
+	if in.Count() != length {
+		return Shard{}, io.ErrUnexpectedEOF
+	}
+
+	s := Shard{Offset: offset, Length: length, Checksum: h.Sum32()}
+	payload := []byte(shardTag)
+	payload = binary.LittleEndian.AppendUint64(payload, uint64(s.Offset))
+	payload = binary.LittleEndian.AppendUint64(payload, uint64(s.Length))
+	payload = binary.LittleEndian.AppendUint32(payload, s.Checksum)
+	payload = binary.LittleEndian.AppendUint32(payload, xxHash32.Checksum(payload, 0))
+	return s, writeSkippableFrame(dst, shardNibble, payload)
+}
+
+// ReadShard returns the description of the shard of size bytes in r.
+func ReadShard(r io.ReaderAt, size int64) (Shard, error) {
+	if size < shardSize {
+		return Shard{}, ErrNotShard
+	}
+	var frame [shardSize]byte
+	if _, err := r.ReadAt(frame[:], size-shardSize); err != nil {
+		return Shard{}, err
+	}
+	p := frame[skippableHeaderSize:]
+	if binary.LittleEndian.Uint32(frame[:]) != skippableMagic|shardNibble ||
+		binary.LittleEndian.Uint32(frame[4:]) != uint32(len(p)) ||
+		string(p[:4]) != shardTag ||
+		xxHash32.Checksum(p[:24], 0) != binary.LittleEndian.Uint32(p[24:]) {
+		return Shard{}, ErrNotShard
+	}
+	return Shard{
+		Offset:   int64(binary.LittleEndian.Uint64(p[4:])),
+		Length:   int64(binary.LittleEndian.Uint64(p[12:])),
+		Checksum: binary.LittleEndian.Uint32(p[20:]),
+	}, nil
+}
+
+// MergeShards writes the shards, given in any order, to dst as one stream.
+// The shards must cover their input from offset 0 without gaps. Each shard
+// is decoded to verify its checksum, and the merged stream gets the SHA-256
+// of the whole input as WithSHA256 writes it, and a section per shard named
+// after its offset in decimal, so OpenSection can decode any of them. It
+// returns the description of the merged input.
+func MergeShards(dst io.Writer, shards ...*io.SectionReader) (Shard, error) {
+	type piece struct {
+		Shard
+		data *io.SectionReader
+	}
+	pieces := make([]piece, len(shards))
+	for i, sr := range shards {
+		s, err := ReadShard(sr, sr.Size())
+		if err != nil {
+			return Shard{}, fmt.Errorf("shard %d: %w", i, err)
+		}
+		pieces[i] = piece{Shard: s, data: io.NewSectionReader(sr, 0, sr.Size()-shardSize)}
+	}
+	sort.Slice(pieces, func(i, j int) bool { return pieces[i].Offset < pieces[j].Offset })
+
+	w := NewWriter(dst)
+	w.digest = sha256.New()
+	whole := xxHash32.New(0)
+	var next int64
+	for _, p := range pieces {
+		if p.Offset != next {
+			return Shard{}, fmt.Errorf("%w: expected offset %d, got %d", ErrShardGap, next, p.Offset)
+		}
+		next += p.Length
+
+		w.sections = append(w.sections, Section{Name: strconv.FormatInt(p.Offset, 10), Offset: w.dst.n})
+		w.sectionOpen = true
+		h := xxHash32.New(0)
+		r := NewReader(io.TeeReader(p.data, w.dst))
+		n, err := io.Copy(io.MultiWriter(h, whole, w.digest), r)
+		if err != nil {
+			return Shard{}, fmt.Errorf("shard at %d: %w", p.Offset, err)
+		}
+		if rest, _ := io.Copy(io.Discard, p.data); rest > 0 {
+			return Shard{}, fmt.Errorf("%w: shard at %d has %d bytes after its frame", ErrCorrupted, p.Offset, rest)
+		}
+		if n != p.Length || h.Sum32() != p.Checksum {
+			return Shard{}, fmt.Errorf("%w: shard at %d", ErrContentChecksum, p.Offset)
+		}
+		w.endSection()
+	}
+
+	if err := w.writeDigest(); err != nil {
+		return Shard{}, err
+	}
+	if err := w.writeSectionIndex(); err != nil {
+		return Shard{}, err
+	}
+	return Shard{Length: next, Checksum: whole.Sum32()}, nil
+}
@@ -0,0 +1,70 @@
+package lz4
+
+import "errors"
+
+var ErrInvalidContentSize = errors.New("invalid content size")
+
+// WithContentSize makes a Writer declare in the header of its first frame
+// that the frame holds exactly n bytes, as lz4 --content-size does, so a
+// reader can size its output up front. A Write past n bytes fails without
+// writing anything, and ending the frame short of n fails; either way the
+// error is a *SizeMismatchError. Since the size covers the first frame only,
+// the option suits streams written as a single frame.
+func WithContentSize(n int64) Option {
+	if n < 0 {
+		return func(applier) error { return ErrInvalidContentSize }
+	}
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			w.contentSize = n
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// checkContentSize fails if writing n more bytes would exceed the content
+// size declared for the first frame.
+func (w *Writer) checkContentSize(n int) error {
+	if w.contentSize < 0 || w.frames > 0 {
+		return nil
+	}
+	if total := w.consumed + w.queued + int64(len(w.pending)+n); total > w.contentSize {
+		return &SizeMismatchError{Expected: w.contentSize, Actual: total}
+	}
+	return nil
+}
+
+// Size returns the content size declared in the header of the current
+// frame, or -1 if the header has none. It reads the header of the first
+// frame if Read has not yet, so the size is known before any data is
+// decoded; an error reading it is returned by Size and every later Read.
+func (r *Reader) Size() (int64, error) {
+	if err := r.ReadHeader(); err != nil {
+		return -1, err
+	}
+	if r.header == nil {
+		return -1, r.err
+	}
+	if !r.header.ContentSizeFlag {
+		return -1, nil
+	}
+	return int64(r.header.ContentSize), nil
+}
+
+// checksContentSize reports whether the decoded size of the current frame
+// is held to its header. Recovery and partial reads drop data by design.
+func (r *Reader) checksContentSize() bool {
+	return r.header.ContentSizeFlag && r.recovery == nil && !r.partial
+}
+
+// addFrameSize accounts for n more bytes decoded from the current frame,
+// failing as soon as they exceed its declared content size.
+func (r *Reader) addFrameSize(n int) error {
+	r.frameSize += int64(n)
+	if r.checksContentSize() && uint64(r.frameSize) > r.header.ContentSize {
+		return &SizeMismatchError{Expected: int64(r.header.ContentSize), Actual: r.frameSize}
+	}
+	return nil
+}
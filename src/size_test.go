@@ -0,0 +1,71 @@
+package lz4_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	lz4 "rzstd/src"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+func TestContentSize(t *testing.T) {
+	data := testInput(200 << 10)
+	frame := compress(t, data, lz4.WithContentSize(int64(len(data))))
+	r := lz4.NewReader(bytes.NewReader(frame))
+	if n, err := r.Size(); err != nil || n != int64(len(data)) {
+		t.Errorf("Size = %d, %v, want %d", n, err, len(data))
+	}
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("round trip = %d bytes, %v", len(got), err)
+	}
+
+	r = lz4.NewReader(bytes.NewReader(compress(t, data)))
+	if n, err := r.Size(); err != nil || n != -1 {
+		t.Errorf("Size without a content size = %d, %v, want -1", n, err)
+	}
+}
+
+func TestContentSizeMismatch(t *testing.T) {
+	data := testInput(100 << 10)
+	var mismatch *lz4.SizeMismatchError
+
+	// Writing past the declared size fails without writing anything
+	var buf bytes.Buffer
+	w := lz4.NewWriter(&buf)
+	if err := w.Apply(lz4.WithContentSize(1000)); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := w.Write(data); n != 0 || !errors.As(err, &mismatch) || mismatch.Expected != 1000 {
+		t.Errorf("Write past the content size = %d, %v", n, err)
+	}
+
+	// Ending the frame short of it fails too
+	buf.Reset()
+	w = lz4.NewWriter(&buf)
+	if err := w.Apply(lz4.WithContentSize(int64(len(data) + 1))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); !errors.As(err, &mismatch) || mismatch.Actual != int64(len(data)) {
+		t.Errorf("Close short of the content size = %v", err)
+	}
+
+	// A header that declares more than the frame holds
+	frame := compress(t, data, lz4.WithContentSize(int64(len(data))))
+	binary.LittleEndian.PutUint64(frame[6:], uint64(len(data)+1))
+	frame[14] = byte(xxHash32.Checksum(frame[4:14], 0) >> 8)
+	_, err := io.ReadAll(lz4.NewReader(bytes.NewReader(frame)))
+	if !errors.Is(err, lz4.ErrContentSize) {
+		t.Errorf("Read of a frame shorter than its content size = %v, want %v", err, lz4.ErrContentSize)
+	}
+
+	if err := lz4.NewWriter(io.Discard).Apply(lz4.WithContentSize(-1)); !errors.Is(err, lz4.ErrInvalidContentSize) {
+		t.Errorf("WithContentSize(-1) = %v, want %v", err, lz4.ErrInvalidContentSize)
+	}
+}
@@ -0,0 +1,73 @@
+package lz4
+
+import (
+	"errors"
+	"io"
+	"math"
+)
+
+// The nibbles that end the magic numbers of the skippable frames of this
+// package and of package kv. They are all allocated here, so that no two
+// kinds of metadata share one.
+const (
+	sectionIndexNibble = 0x0
+	holesNibble        = 0x1
+	digestNibble       = 0x2
+	parityNibble       = 0x3
+	footerNibble       = 0x4
+	shardNibble        = 0x5
+	checksumNibble     = 0x6
+	// KVTrailerNibble ends the magic number of the trailer of a kv store
+	KVTrailerNibble = 0x7
+	seekIndexNibble = 0x8
+	paddingNibble   = 0xF
+)
+
+var ErrInvalidSkippableFrame = errors.New("invalid skippable frame")
+
+// skippableFrame is application metadata written by WithSkippableFrame.
+type skippableFrame struct {
+	nibble  byte
+	payload []byte
+}
+
+// WriteSkippableFrame writes payload to w as a skippable frame, whose magic
+// number ends in magicNibble. Decoders of the format, this package's Reader
+// among them, skip such frames, so applications can store filenames,
+// indexes or signatures next to their data in a standard .lz4 file. The
+// package uses nibbles 0 to 8 and 15 for metadata of its own and of package
+// kv; other applications should prefer 9 to 14.
+func WriteSkippableFrame(w io.Writer, magicNibble byte, payload []byte) error {
+	if magicNibble > 0x0F || uint64(len(payload)) > math.MaxUint32 {
+		return ErrInvalidSkippableFrame
+	}
+	return writeSkippableFrame(w, magicNibble, payload)
+}
+
+// WithSkippableFrame makes a Writer start its output with payload in a
+// skippable frame, as WriteSkippableFrame writes it, ahead of the first
+// frame header. Repeated options write their frames in order.
+func WithSkippableFrame(magicNibble byte, payload []byte) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			if magicNibble > 0x0F || uint64(len(payload)) > math.MaxUint32 {
+				return ErrInvalidSkippableFrame
+			}
+			w.metadata = append(w.metadata, skippableFrame{nibble: magicNibble, payload: payload})
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// writeMetadata writes the frames of WithSkippableFrame.
+func (w *Writer) writeMetadata() error {
+	for _, f := range w.metadata {
+		if err := writeSkippableFrame(w.dst, f.nibble, f.payload); err != nil {
+			w.err = err
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package lz4_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	lz4 "rzstd/src"
+)
+
+// skippable returns a skippable frame with the magic number ending in
+// nibble that declares size bytes and holds payload.
+func skippable(nibble byte, size uint32, payload []byte) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, 0x184D2A50|uint32(nibble))
+	b = binary.LittleEndian.AppendUint32(b, size)
+	return append(b, payload...)
+}
+
+func TestSkipLeadingFrames(t *testing.T) {
+	data := testInput(100 << 10)
+	frame := compress(t, data)
+	lead := append(skippable(0xA, 5, []byte("hello")), skippable(0xE, 0, nil)...)
+	if got := decompress(t, append(bytes.Clone(lead), frame...)); !bytes.Equal(got, data) {
+		t.Fatal("frame after skippable frames does not match the input")
+	}
+	if got := decompress(t, lead); len(got) != 0 {
+		t.Errorf("skippable frames alone decode to %d bytes", len(got))
+	}
+
+	truncated := skippable(0xA, 100, []byte("short"))
+	if _, err := io.ReadAll(lz4.NewReader(bytes.NewReader(truncated))); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated skippable frame: Read = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestWriteSkippableFrame(t *testing.T) {
+	data := testInput(100 << 10)
+	var buf bytes.Buffer
+	w := lz4.NewWriter(&buf)
+	if err := w.Apply(lz4.WithSkippableFrame(0xA, []byte("name")), lz4.WithSkippableFrame(0xB, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := lz4.WriteSkippableFrame(&buf, 0xC, []byte("trailer")); err != nil {
+		t.Fatal(err)
+	}
+	stream := buf.Bytes()
+
+	lead := append(skippable(0xA, 4, []byte("name")), skippable(0xB, 0, nil)...)
+	if !bytes.HasPrefix(stream, lead) {
+		t.Errorf("stream starts with %x, want %x", stream[:len(lead)], lead)
+	}
+	if trailer := skippable(0xC, 7, []byte("trailer")); !bytes.HasSuffix(stream, trailer) {
+		t.Errorf("stream ends with %x, want %x", stream[len(stream)-len(trailer):], trailer)
+	}
+	if got := decompress(t, stream); !bytes.Equal(got, data) {
+		t.Fatal("round trip does not match the input")
+	}
+	frames, err := lz4.Inspect(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 4 {
+		t.Errorf("Inspect found %d frames, want 4", len(frames))
+	}
+
+	if err := lz4.WriteSkippableFrame(io.Discard, 0x10, nil); !errors.Is(err, lz4.ErrInvalidSkippableFrame) {
+		t.Errorf("WriteSkippableFrame with nibble 0x10 = %v, want %v", err, lz4.ErrInvalidSkippableFrame)
+	}
+	if err := lz4.NewWriter(io.Discard).Apply(lz4.WithSkippableFrame(0x10, nil)); !errors.Is(err, lz4.ErrInvalidSkippableFrame) {
+		t.Errorf("WithSkippableFrame with nibble 0x10 = %v, want %v", err, lz4.ErrInvalidSkippableFrame)
+	}
+}
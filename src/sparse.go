@@ -0,0 +1,148 @@
+package lz4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+const holesTag = "RZHO"
+
+type extent struct {
+	Offset int64
+	Length int64
+}
+
+// CompressSparse compresses src without reading its holes. The hole extents
+// are recorded in a skippable frame ahead of the data frame, which holds
+// only the data regions; DecompressSparse recreates the holes. Other LZ4
+// decoders ignore the metadata and output the data regions back to back.
+func CompressSparse(src *os.File, dst io.Writer, options ...Option) error {
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+	holes, err := findHoles(src, size)
+	if err != nil {
+		return err
+	}
+
+	if len(holes) > 0 {
+		payload := append([]byte(holesTag), make([]byte, 12)...)
+		binary.LittleEndian.PutUint64(payload[4:], uint64(size))
+		binary.LittleEndian.PutUint32(payload[12:], uint32(len(holes)))
+		for _, h := range holes {
+			payload = binary.LittleEndian.AppendUint64(payload, uint64(h.Offset))
+			payload = binary.LittleEndian.AppendUint64(payload, uint64(h.Length))
+		}
+		if err := writeSkippableFrame(dst, holesNibble, payload); err != nil {
+			return err
+		}
+	}
+
+	w := NewWriter(dst)
+	if err := w.Apply(options...); err != nil {
+		return err
+	}
+	buf := make([]byte, 64*1024)
+	off := int64(0)
+	for _, h := range append(holes, extent{Offset: size}) {
+		if h.Offset > off {
+			if _, err := io.CopyBuffer(w, io.NewSectionReader(src, off, h.Offset-off), buf); err != nil {
+				w.Abort()
+				return err
+			}
+		}
+		off = h.Offset + h.Length
+	}
+	return w.Close()
+}
+
+// DecompressSparse decompresses src into dst, recreating the holes recorded
+// by CompressSparse. Streams without hole metadata are decompressed as is.
+func DecompressSparse(src io.Reader, dst *os.File, options ...Option) error {
+	var head [4]byte
+	if _, err := io.ReadFull(src, head[:]); err != nil {
+		return err
+	}
+
+	var size int64 = -1
+	var holes []extent
+	if binary.LittleEndian.Uint32(head[:]) == skippableMagic|holesNibble {
+		if _, err := io.ReadFull(src, head[:]); err != nil {
+			return noEOF(err)
+		}
+		n := int64(binary.LittleEndian.Uint32(head[:]))
+		payload, err := io.ReadAll(io.LimitReader(src, n))
+		if err != nil {
+			return err
+		}
+		if int64(len(payload)) != n {
+			return io.ErrUnexpectedEOF
+		}
+		if size, holes, err = parseHoles(payload); err != nil {
+			return err
+		}
+	} else {
+		src = io.MultiReader(bytes.NewReader(head[:]), src)
+	}
+
+	sw := &sparseWriter{f: dst, holes: holes}
+	if err := DecompressStream(src, sw, options...); err != nil {
+		return err
+	}
+	if size >= 0 {
+		return dst.Truncate(size)
+	}
+	return nil
+}
+
+func parseHoles(payload []byte) (int64, []extent, error) {
+	if len(payload) < 16 || string(payload[:4]) != holesTag {
+		return 0, nil, ErrCorrupted
+	}
+	size := int64(binary.LittleEndian.Uint64(payload[4:]))
+	count := int(binary.LittleEndian.Uint32(payload[12:]))
+	p := payload[16:]
+	if count != len(p)/16 {
+		return 0, nil, ErrCorrupted
+	}
+	holes := make([]extent, count)
+	for i := range holes {
+		holes[i].Offset = int64(binary.LittleEndian.Uint64(p[i*16:]))
+		holes[i].Length = int64(binary.LittleEndian.Uint64(p[i*16+8:]))
+	}
+	return size, holes, nil
+}
+
+// sparseWriter writes data regions to f at their original offsets, leaving
+// the holes between them unwritten.
+type sparseWriter struct {
+	f     *os.File
+	holes []extent
+	pos   int64
+}
+
+func (s *sparseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		for len(s.holes) > 0 && s.holes[0].Offset <= s.pos {
+			s.pos = max(s.pos, s.holes[0].Offset+s.holes[0].Length)
+			s.holes = s.holes[1:]
+		}
+		chunk := len(p)
+		if len(s.holes) > 0 && s.holes[0].Offset-s.pos < int64(chunk) {
+			chunk = int(s.holes[0].Offset - s.pos)
+		}
+		n, err := s.f.WriteAt(p[:chunk], s.pos)
+		written += n
+		s.pos += int64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[chunk:]
+	}
+	return written, nil
+}
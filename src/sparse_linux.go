@@ -0,0 +1,45 @@
+//go:build linux
+
+package lz4
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// findHoles returns the holes of f using SEEK_DATA and SEEK_HOLE. File
+// systems without hole support report none.
+func findHoles(f *os.File, size int64) ([]extent, error) {
+	defer f.Seek(0, io.SeekStart)
+
+	var holes []extent
+	for off := int64(0); off < size; {
+		data, err := f.Seek(off, seekData)
+		if errors.Is(err, syscall.ENXIO) {
+			holes = append(holes, extent{Offset: off, Length: size - off})
+			break
+		}
+		if errors.Is(err, syscall.EINVAL) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if data > off {
+			holes = append(holes, extent{Offset: off, Length: data - off})
+		}
+
+		off, err = f.Seek(data, seekHole)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return holes, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package lz4
+
+import "os"
+
+func findHoles(f *os.File, size int64) ([]extent, error) {
+	return nil, nil
+}
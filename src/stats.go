@@ -0,0 +1,44 @@
+package lz4
+
+// Stats describes how well a Writer's blocks compressed. Sizes cover block
+// payloads only, not frame headers, block size fields or checksums.
+type Stats struct {
+	Blocks int64
+	// RawBlocks is the number of blocks stored uncompressed because
+	// compression did not make them smaller.
+	RawBlocks int64
+	// ExpandedBlocks is the number of blocks whose compressed form was
+	// larger than their input, and ExpansionBytes the total by which they
+	// grew, whether or not they were stored raw instead.
+	ExpandedBlocks int64
+	ExpansionBytes int64
+
+	InputBytes  int64
+	OutputBytes int64
+}
+
+// Saved returns the number of bytes compression saved, which is negative
+// when the output is larger than the input.
+func (s Stats) Saved() int64 {
+	return s.InputBytes - s.OutputBytes
+}
+
+// Stats returns the counters of all blocks written so far.
+func (w *Writer) Stats() Stats {
+	return w.stats
+}
+
+// countBlock records a block of n input bytes whose compressed form takes
+// compressed bytes and that was stored in stored bytes.
+func (s *Stats) countBlock(n, compressed, stored int, raw bool) {
+	s.Blocks++
+	if raw {
+		s.RawBlocks++
+	}
+	if compressed > n {
+		s.ExpandedBlocks++
+		s.ExpansionBytes += int64(compressed - n)
+	}
+	s.InputBytes += int64(n)
+	s.OutputBytes += int64(stored)
+}
@@ -0,0 +1,55 @@
+package lz4_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	lz4 "rzstd/src"
+)
+
+// TestRawBlocks checks that a block which does not shrink is stored as is,
+// between blocks that compress.
+func TestRawBlocks(t *testing.T) {
+	random := make([]byte, 64<<10)
+	rand.New(rand.NewSource(1)).Read(random)
+	text := testInput(64 << 10)
+	data := bytes.Join([][]byte{text, random, text}, nil)
+
+	var buf bytes.Buffer
+	w := lz4.NewWriter(&buf)
+	if err := w.Apply(lz4.WithBlockSize(64 << 10)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	stats := w.Stats()
+	if stats.Blocks != 3 || stats.RawBlocks != 1 || stats.InputBytes != int64(len(data)) {
+		t.Errorf("Stats = %+v, want 3 blocks, 1 raw, %d bytes in", stats, len(data))
+	}
+	if stats.Saved() <= 0 {
+		t.Errorf("Saved = %d", stats.Saved())
+	}
+
+	stream := buf.Bytes()
+	frames, err := lz4.Inspect(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, b := range frames[0].Blocks {
+		if b.Uncompressed != (i == 1) {
+			t.Errorf("block %d: Uncompressed = %v", i, b.Uncompressed)
+		}
+	}
+	b := frames[0].Blocks[1]
+	if !bytes.Equal(stream[b.Offset+4:b.Offset+4+int64(b.CompressedSize)], random) {
+		t.Error("raw block does not hold its input")
+	}
+	if got := decompress(t, stream); !bytes.Equal(got, data) {
+		t.Fatal("round trip does not match the input")
+	}
+}
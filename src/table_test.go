@@ -0,0 +1,50 @@
+package lz4
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestMatchTableReuse compresses blocks that repeat each other with one
+// table, from a fresh table and from one whose base is about to overflow.
+// Every block must come out as if its table had been cleared: no match may
+// reach into an earlier block.
+func TestMatchTableReuse(t *testing.T) {
+	chunk := bytes.Repeat([]byte("independent blocks, same text. "), 2200)[:64<<10]
+	data := bytes.Repeat(chunk, 4)
+	dst := make([]byte, CompressBlockBound(len(chunk)))
+	n, err := CompressBlock(chunk, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := dst[:n]
+
+	for _, base := range []uint32{0, ^uint32(0) - 100<<10} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		if err := w.Apply(WithBlockSize(64 << 10)); err != nil {
+			t.Fatal(err)
+		}
+		w.hashTable.base = base
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		frames, err := Inspect(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, b := range frames[0].Blocks {
+			got := buf.Bytes()[b.Offset+4 : b.Offset+4+int64(b.CompressedSize)]
+			if !bytes.Equal(got, want) {
+				t.Errorf("base %#x: block %d differs from the block compressed with a fresh table", base, i)
+			}
+		}
+		// Four blocks later, the table has started over from base 1
+		if base > 0 && w.hashTable.base > uint32(len(data)) {
+			t.Errorf("base %#x: table was not cleared before its offsets overflowed", base)
+		}
+	}
+}
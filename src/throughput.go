@@ -0,0 +1,40 @@
+package lz4
+
+import "time"
+
+const maxAcceleration = 64
+
+// WithTargetThroughput makes a Writer adjust its acceleration after every
+// block to compress at least mbps megabytes per second: a block that was
+// too slow doubles the acceleration, and one more than twice as fast as
+// needed halves it, trading ratio for speed only as far as required. With
+// WithAdaptive, mbps is the speed its steps have to keep up with instead.
+// The acceleration never goes past 64. Since the choice depends on timing,
+// the output is not reproducible and a checkpointed stream resumes with the
+// initial acceleration.
+func WithTargetThroughput(mbps float64) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case *Writer:
+			w.targetThroughput = mbps
+			return nil
+		}
+		return ErrOptionNotApplicable
+	}
+}
+
+// pace updates the acceleration after a block of n bytes took d to
+// compress.
+func (w *Writer) pace(n int, d time.Duration) {
+	if w.targetThroughput <= 0 || w.adaptive || d <= 0 {
+		return
+	}
+	speed := float64(n) / 1e6 / d.Seconds()
+	acc := w.params.acceleration
+	switch {
+	case speed < w.targetThroughput && acc < maxAcceleration:
+		w.params.acceleration = min(max(1, acc*2), maxAcceleration)
+	case speed > 2*w.targetThroughput && acc > 1:
+		w.params.acceleration = acc / 2
+	}
+}
@@ -0,0 +1,33 @@
+package lz4
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+// TestPaceBounds drives pace with blocks that are always too slow, then
+// always fast enough, from an acceleration that doubles past the maximum.
+func TestPaceBounds(t *testing.T) {
+	w := NewWriter(io.Discard)
+	if err := w.Apply(WithAcceleration(33), WithTargetThroughput(100)); err != nil {
+		t.Fatal(err)
+	}
+	for range 5 {
+		// 1 MB/s
+		w.pace(1e6, time.Second)
+		if acc := w.params.acceleration; acc > maxAcceleration {
+			t.Fatalf("slow block raised the acceleration to %d, above %d", acc, maxAcceleration)
+		}
+	}
+	if acc := w.params.acceleration; acc != maxAcceleration {
+		t.Errorf("acceleration after slow blocks = %d, want %d", acc, maxAcceleration)
+	}
+	for range 10 {
+		// 1000 MB/s
+		w.pace(1e6, time.Millisecond)
+	}
+	if acc := w.params.acceleration; acc != 1 {
+		t.Errorf("acceleration after fast blocks = %d, want 1", acc)
+	}
+}
@@ -0,0 +1,326 @@
+package lz4
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+var (
+	ErrBlockChecksum   = errors.New("block checksum mismatch")
+	ErrContentChecksum = errors.New("content checksum mismatch")
+	ErrContentSize     = errors.New("content size mismatch")
+	ErrMissingEndMark  = errors.New("missing end mark")
+)
+
+// SizeMismatchError is returned by a Reader created with NewReaderN when the
+// stream does not decompress to the expected size, and when a frame does not
+// decompress to the content size in its header. Actual is a lower bound when
+// the stream is too long, as reading stops at the first extra block. A Writer
+// given WithContentSize returns it when its input does not match.
+type SizeMismatchError struct {
+	Expected int64
+	Actual   int64
+}
+
+func (e *SizeMismatchError) Error() string {
+	if e.Actual > e.Expected {
+		return fmt.Sprintf("decompressed size exceeds the expected %d bytes", e.Expected)
+	}
+	return fmt.Sprintf("decompressed size %d is less than the expected %d bytes", e.Actual, e.Expected)
+}
+
+// Is makes errors.Is(err, ErrContentSize) hold for a SizeMismatchError.
+func (e *SizeMismatchError) Is(target error) bool {
+	return target == ErrContentSize
+}
+
+// ChecksumMismatchError is returned by a Reader when the content checksum
+// stored after a frame does not match the content decoded from it.
+type ChecksumMismatchError struct {
+	Stored   uint32
+	Computed uint32
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("content checksum mismatch: stored %08x, computed %08x", e.Stored, e.Computed)
+}
+
+// Is makes errors.Is(err, ErrContentChecksum) hold for a
+// ChecksumMismatchError.
+func (e *ChecksumMismatchError) Is(target error) bool {
+	return target == ErrContentChecksum
+}
+
+// Problem is one defect found by Validate. Block is -1 for problems that
+// concern the frame rather than one of its blocks.
+type Problem struct {
+	Offset int64
+	Frame  int
+	Block  int
+	Err    error
+}
+
+func (p Problem) String() string {
+	if p.Block < 0 {
+		return fmt.Sprintf("offset %d: frame %d: %v", p.Offset, p.Frame, p.Err)
+	}
+	return fmt.Sprintf("offset %d: frame %d, block %d: %v", p.Offset, p.Frame, p.Block, p.Err)
+}
+
+// Report is the result of Validate.
+type Report struct {
+	Frames          int
+	SkippableFrames int
+	Blocks          int
+	// Size is the number of bytes read, and DecompressedSize the number of
+	// bytes the blocks decode to, unless decoding was disabled.
+	Size             int64
+	DecompressedSize int64
+	Problems         []Problem
+	// Unverified lists the frames that name a dictionary Validate could not
+	// get: their structure and block checksums are checked, but not their
+	// contents. They do not count as problems.
+	Unverified []Problem
+}
+
+// OK reports whether no problems were found.
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// ValidateOption configures Validate.
+type ValidateOption func(*validateConfig)
+
+type validateConfig struct {
+	decode      bool
+	maxProblems int
+	resolve     func(id uint32) ([]byte, error)
+}
+
+// WithoutDecoding makes Validate check the frame structure and block
+// checksums only, skipping block decoding and the content checksum and size.
+func WithoutDecoding() ValidateOption {
+	return func(c *validateConfig) {
+		c.decode = false
+	}
+}
+
+// WithMaxProblems stops Validate after n problems; n < 1 means no limit.
+func WithMaxProblems(n int) ValidateOption {
+	return func(c *validateConfig) {
+		c.maxProblems = n
+	}
+}
+
+// WithDictionaries makes Validate decode the frames that name a dictionary
+// with the one resolve returns for its ID, as WithDictionaryResolver does
+// for a Reader. Without it, such frames are listed in Report.Unverified.
+func WithDictionaries(resolve func(id uint32) ([]byte, error)) ValidateOption {
+	return func(c *validateConfig) {
+		c.resolve = resolve
+	}
+}
+
+// validator holds the state of one Validate call.
+type validator struct {
+	cfg    validateConfig
+	walk   *frameWalker
+	report Report
+	out    []byte
+	window []byte
+}
+
+// Validate reads a stream of frames and checks header checksums, block
+// sizes, block checksums, content sizes, content checksums and end marks
+// without producing any output. Problems are collected in the report; the
+// error is only set when reading from r fails. Validation of a frame stops
+// at its first structural problem, and of the stream at a problem that makes
+// the next frame impossible to locate.
+func Validate(r io.Reader, options ...ValidateOption) (Report, error) {
+	v := &validator{
+		cfg:  validateConfig{decode: true},
+		walk: newFrameWalker(r),
+	}
+	for _, o := range options {
+		o(&v.cfg)
+	}
+	err := v.run()
+	v.report.Size = v.walk.src.Count()
+	return v.report, err
+}
+
+// errStopValidation ends validation once enough problems are collected.
+var errStopValidation = errors.New("stop validation")
+
+func (v *validator) problem(frame, block int, offset int64, err error) error {
+	v.report.Problems = append(v.report.Problems, Problem{Offset: offset, Frame: frame, Block: block, Err: err})
+	if v.cfg.maxProblems > 0 && len(v.report.Problems) >= v.cfg.maxProblems {
+		return errStopValidation
+	}
+	return nil
+}
+
+func (v *validator) run() error {
+	for {
+		m, offset, err := v.walk.magic()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				return v.stop(v.problem(v.report.Frames, -1, offset, err))
+			}
+			return err
+		}
+
+		if isSkippableMagic(m) {
+			if err := v.walk.skip(); err != nil {
+				return v.truncated(v.report.Frames, -1, offset, err)
+			}
+			v.report.SkippableFrames++
+			continue
+		}
+
+		frame := v.report.Frames
+		v.report.Frames++
+		if m != magic && m != legacyMagic {
+			// Without a valid magic number the frame boundaries are lost
+			return v.stop(v.problem(frame, -1, offset, fmt.Errorf("%w: bad magic number %#08x", ErrCorrupted, m)))
+		}
+		header, checksumOK, err := v.walk.readHeader(m)
+		if err == ErrInvalidVersion || err == ErrInvalidBlockSize {
+			return v.stop(v.problem(frame, -1, offset, err))
+		}
+		if err != nil {
+			return v.truncated(frame, -1, offset, err)
+		}
+		if !checksumOK {
+			if err := v.problem(frame, -1, offset, ErrHeaderChecksum); err != nil {
+				return v.stop(err)
+			}
+		}
+		if err := v.frame(frame, offset, header); err != nil {
+			return v.stop(err)
+		}
+	}
+}
+
+// stop turns errStopValidation into a clean end of validation.
+func (v *validator) stop(err error) error {
+	if err == errStopValidation {
+		return nil
+	}
+	return err
+}
+
+// truncated records a problem for an unexpected end of input and ends
+// validation, or returns a read error as is.
+func (v *validator) truncated(frame, block int, offset int64, err error) error {
+	if err != io.ErrUnexpectedEOF {
+		return err
+	}
+	return v.stop(v.problem(frame, block, offset, err))
+}
+
+// frame checks the blocks of one frame after its header, which starts at
+// offset.
+func (v *validator) frame(frame int, offset int64, header *DecodedFrameHeader) error {
+	var content hash.Hash32
+	if header.ContentChecksumFlag && v.cfg.decode {
+		content = xxHash32.New(0)
+	}
+	var decoded int64
+	// contentOK is cleared when a block fails to decode, which makes the
+	// content checksum and size meaningless
+	decode, contentOK := v.cfg.decode, v.cfg.decode
+	// history is the dictionary of the frame, followed by its previous
+	// blocks if they are linked
+	var history []byte
+	if decode && header.DictIDFlag {
+		dict, err := resolveDictionary(v.cfg.resolve, header.DictID)
+		if err != nil {
+			v.report.Unverified = append(v.report.Unverified, Problem{Offset: offset, Frame: frame, Block: -1, Err: err})
+			decode, contentOK = false, false
+		}
+		history = dict
+	}
+
+	for block := 0; ; block++ {
+		offset := v.walk.pos()
+		b, err := v.walk.block()
+		if err == ErrMissingEndMark {
+			return v.problem(frame, -1, offset, err)
+		}
+		if err == ErrBlockTooLarge {
+			// The size is not trustworthy, so the rest of the frame is lost
+			if err := v.problem(frame, block, offset, err); err != nil {
+				return err
+			}
+			return errStopValidation
+		}
+		if err != nil {
+			return v.truncated(frame, block, offset, err)
+		}
+		if b == nil {
+			break
+		}
+		v.report.Blocks++
+		data := b.Data
+
+		if header.BlocksChecksumFlag && b.Checksum != xxHash32.Checksum(data, 0) {
+			if err := v.problem(frame, block, offset, ErrBlockChecksum); err != nil {
+				return err
+			}
+		}
+
+		if !decode {
+			continue
+		}
+		out := data
+		if !b.Uncompressed {
+			if cap(v.out) < int(header.BlockMaxSize) {
+				v.out = make([]byte, header.BlockMaxSize)
+			}
+			n, err := decompressBlockDict(data, v.out[:header.BlockMaxSize], history, minMatchLength)
+			if err != nil {
+				// Linked blocks depend on this one, so stop decoding them but
+				// keep checking the structure of the frame
+				decode = header.BlocksIndependentFlag
+				contentOK = false
+				if err := v.problem(frame, block, offset, err); err != nil {
+					return err
+				}
+				continue
+			}
+			out = v.out[:n]
+		}
+		if !header.BlocksIndependentFlag {
+			v.window = slideWindow(v.window, history, out)
+			history = v.window
+		}
+		decoded += int64(len(out))
+		v.report.DecompressedSize += int64(len(out))
+		if content != nil {
+			content.Write(out)
+		}
+	}
+
+	offset = v.walk.pos()
+	sum, err := v.walk.endFrame()
+	if err != nil {
+		return v.truncated(frame, -1, offset, err)
+	}
+	if header.ContentChecksumFlag && contentOK && sum != content.Sum32() {
+		if err := v.problem(frame, -1, offset, ErrContentChecksum); err != nil {
+			return err
+		}
+	}
+	if contentOK && header.ContentSizeFlag && uint64(decoded) != header.ContentSize {
+		return v.problem(frame, -1, v.walk.pos(), fmt.Errorf("%w: header says %d, frame has %d", ErrContentSize, header.ContentSize, decoded))
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package lz4_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	lz4 "rzstd/src"
+	"rzstd/src/lz4test"
+)
+
+// TestCorruptFrames runs every corrupted variant of a few valid frames
+// through a Reader and Validate. A vector without an expected error must
+// still fail, with whatever problem its corruption leads to.
+func TestCorruptFrames(t *testing.T) {
+	data := testInput(100 << 10)
+	dict := testInput(16 << 10)
+	const dictID = 7
+	resolve := func(id uint32) ([]byte, error) {
+		if id != dictID {
+			return nil, lz4.ErrDictionaryRequired
+		}
+		return dict, nil
+	}
+	frames := map[string][]lz4.Option{
+		"plain":            nil,
+		"block checksum":   {lz4.WithBlockChecksum()},
+		"content checksum": {lz4.WithContentChecksum()},
+		"both checksums":   {lz4.WithBlockChecksum(), lz4.WithContentChecksum()},
+		"content size":     {lz4.WithContentSize(int64(len(data)))},
+		"dictionary":       {lz4.WithDictionary(dictID, dict), lz4.WithBlockChecksum()},
+	}
+	for name, options := range frames {
+		t.Run(name, func(t *testing.T) {
+			frame := compress(t, data, append([]lz4.Option{lz4.WithBlockSize(64 << 10)}, options...)...)
+			vectors, err := lz4test.CorruptFrame(frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range vectors {
+				r := lz4.NewReader(bytes.NewReader(v.Data))
+				if err := r.Apply(lz4.WithDictionaryResolver(resolve)); err != nil {
+					t.Fatal(err)
+				}
+				_, err := io.ReadAll(r)
+				switch {
+				case err == nil:
+					t.Errorf("%s: Reader did not detect the corruption", v.Name)
+				case v.Err != nil && !errors.Is(err, v.Err):
+					t.Errorf("%s: Reader = %v, want %v", v.Name, err, v.Err)
+				}
+
+				report, err := lz4.Validate(bytes.NewReader(v.Data), lz4.WithDictionaries(resolve))
+				switch {
+				case err != nil:
+					t.Errorf("%s: Validate: %v", v.Name, err)
+				case report.OK():
+					t.Errorf("%s: Validate did not detect the corruption", v.Name)
+				case v.Err != nil && !errors.Is(report.Problems[0].Err, v.Err):
+					t.Errorf("%s: Validate = %v, want %v", v.Name, report.Problems[0].Err, v.Err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package lz4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// scannedBlock is one data block of a stream as stored on the wire.
+type scannedBlock struct {
+	Frame        int
+	Offset       int64
+	Data         []byte
+	Uncompressed bool
+	// Checksum is the stored checksum of the block if its frame has
+	// BlocksChecksumFlag set
+	Checksum uint32
+}
+
+// frameWalker reads the frames of a stream and the blocks of each as they
+// are stored, without decoding or verifying them, for Validate, Inspect and
+// blockScanner. A frame is read with magic, then skip for a skippable frame,
+// or readHeader, block until it returns nil and endFrame for the others.
+type frameWalker struct {
+	src *CountingReader
+	// header is that of the current frame, and frame its index among the
+	// frames that are not skippable
+	header *DecodedFrameHeader
+	frame  int
+	word   [4]byte
+	// next is set when word holds the magic number of the next frame, read
+	// where a legacy frame could have had another block
+	next bool
+	buf  []byte
+}
+
+func newFrameWalker(r io.Reader) *frameWalker {
+	return &frameWalker{src: NewCountingReader(r), frame: -1}
+}
+
+// pos returns the offset in the stream of the next byte to be walked.
+func (fw *frameWalker) pos() int64 {
+	if fw.next {
+		return fw.src.n - 4
+	}
+	return fw.src.n
+}
+
+// magic reads the magic number of the next frame and returns it along with
+// its offset. It returns io.EOF if the stream ends before it.
+func (fw *frameWalker) magic() (uint32, int64, error) {
+	offset := fw.pos()
+	if !fw.next {
+		if _, err := io.ReadFull(fw.src, fw.word[:]); err != nil {
+			return 0, offset, err
+		}
+	}
+	fw.next = false
+	return binary.LittleEndian.Uint32(fw.word[:]), offset, nil
+}
+
+// skip skips the rest of a skippable frame.
+func (fw *frameWalker) skip() error {
+	if _, err := io.ReadFull(fw.src, fw.word[:]); err != nil {
+		return noEOF(err)
+	}
+	if _, err := io.CopyN(io.Discard, fw.src, int64(binary.LittleEndian.Uint32(fw.word[:]))); err != nil {
+		return noEOF(err)
+	}
+	return nil
+}
+
+// readHeader reads the rest of the header of a frame that starts with magic
+// number m, and reports whether its checksum matches, as readFrameHeader.
+func (fw *frameWalker) readHeader(m uint32) (*DecodedFrameHeader, bool, error) {
+	var word [4]byte
+	binary.LittleEndian.PutUint32(word[:], m)
+	header, checksumOK, err := readFrameHeader(io.MultiReader(bytes.NewReader(word[:]), fw.src))
+	if err != nil {
+		return nil, false, noEOF(err)
+	}
+	fw.header = header
+	fw.frame++
+	return header, checksumOK, nil
+}
+
+// block reads the next block of the current frame, or returns nil at its
+// end mark, or where a legacy frame ends. The data of the block is only
+// valid until the next call. It fails with ErrMissingEndMark if the stream
+// ends where a block or the end mark should be.
+func (fw *frameWalker) block() (*scannedBlock, error) {
+	legacy := fw.header.Magic == legacyMagic
+	b := &scannedBlock{Frame: fw.frame, Offset: fw.src.n}
+	if _, err := io.ReadFull(fw.src, fw.word[:]); err != nil {
+		switch {
+		case legacy && err == io.EOF:
+			return nil, nil
+		case err == io.EOF || err == io.ErrUnexpectedEOF:
+			return nil, ErrMissingEndMark
+		}
+		return nil, err
+	}
+	size := binary.LittleEndian.Uint32(fw.word[:])
+	limit := fw.header.BlockMaxSize
+	if legacy {
+		if size > legacyBound {
+			fw.next = true
+			return nil, nil
+		}
+		limit = legacyBound
+	} else {
+		if size == endMark {
+			return nil, nil
+		}
+		b.Uncompressed = size&0x80000000 != 0
+		size &^= 0x80000000
+	}
+	if size > limit {
+		return nil, ErrBlockTooLarge
+	}
+
+	if cap(fw.buf) < int(size) {
+		fw.buf = make([]byte, size)
+	}
+	b.Data = fw.buf[:size]
+	if _, err := io.ReadFull(fw.src, b.Data); err != nil {
+		return nil, noEOF(err)
+	}
+	if fw.header.BlocksChecksumFlag {
+		if _, err := io.ReadFull(fw.src, fw.word[:]); err != nil {
+			return nil, noEOF(err)
+		}
+		b.Checksum = binary.LittleEndian.Uint32(fw.word[:])
+	}
+	return b, nil
+}
+
+// endFrame reads what follows the end mark of the current frame, returning
+// the content checksum if the header has ContentChecksumFlag set.
+func (fw *frameWalker) endFrame() (uint32, error) {
+	h := fw.header
+	fw.header = nil
+	if !h.ContentChecksumFlag {
+		return 0, nil
+	}
+	if _, err := io.ReadFull(fw.src, fw.word[:]); err != nil {
+		return 0, noEOF(err)
+	}
+	return binary.LittleEndian.Uint32(fw.word[:]), nil
+}
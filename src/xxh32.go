@@ -0,0 +1,126 @@
+package lz4
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+const (
+	xxhPrime1 uint32 = 2654435761
+	xxhPrime2 uint32 = 2246822519
+	xxhPrime3 uint32 = 3266489917
+	xxhPrime4 uint32 = 668265263
+	xxhPrime5 uint32 = 374761393
+)
+
+// xxh32State is a seed 0 xxh32 hash whose state can be saved, which that of
+// xxHash32.New cannot, so that a checkpoint can carry the content checksum
+// of the frame it interrupts.
+type xxh32State struct {
+	v     [4]uint32
+	total uint64
+	buf   [16]byte
+	used  int
+}
+
+func newXXH32() *xxh32State {
+	x := &xxh32State{}
+	x.Reset()
+	return x
+}
+
+func (x *xxh32State) Reset() {
+	// The constants wrap around, which only variables may do
+	p1, p2 := xxhPrime1, xxhPrime2
+	x.v = [4]uint32{p1 + p2, p2, 0, -p1}
+	x.total, x.used = 0, 0
+}
+
+func (x *xxh32State) Size() int      { return 4 }
+func (x *xxh32State) BlockSize() int { return 16 }
+
+func xxhRound(acc, input uint32) uint32 {
+	return bits.RotateLeft32(acc+input*xxhPrime2, 13) * xxhPrime1
+}
+
+func (x *xxh32State) stripe(p []byte) {
+	for i := range x.v {
+		x.v[i] = xxhRound(x.v[i], binary.LittleEndian.Uint32(p[4*i:]))
+	}
+}
+
+func (x *xxh32State) Write(p []byte) (int, error) {
+	n := len(p)
+	x.total += uint64(n)
+	if x.used > 0 {
+		m := copy(x.buf[x.used:], p)
+		x.used += m
+		p = p[m:]
+		if x.used < 16 {
+			return n, nil
+		}
+		x.stripe(x.buf[:])
+		x.used = 0
+	}
+	for ; len(p) >= 16; p = p[16:] {
+		x.stripe(p)
+	}
+	x.used = copy(x.buf[:], p)
+	return n, nil
+}
+
+func (x *xxh32State) Sum32() uint32 {
+	var h uint32
+	if x.total >= 16 {
+		h = bits.RotateLeft32(x.v[0], 1) + bits.RotateLeft32(x.v[1], 7) +
+			bits.RotateLeft32(x.v[2], 12) + bits.RotateLeft32(x.v[3], 18)
+	} else {
+		h = xxhPrime5
+	}
+	h += uint32(x.total)
+
+	p := x.buf[:x.used]
+	for ; len(p) >= 4; p = p[4:] {
+		h = bits.RotateLeft32(h+binary.LittleEndian.Uint32(p)*xxhPrime3, 17) * xxhPrime4
+	}
+	for _, b := range p {
+		h = bits.RotateLeft32(h+uint32(b)*xxhPrime5, 11) * xxhPrime1
+	}
+	h ^= h >> 15
+	h *= xxhPrime2
+	h ^= h >> 13
+	h *= xxhPrime3
+	h ^= h >> 16
+	return h
+}
+
+func (x *xxh32State) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint32(b, x.Sum32())
+}
+
+// xxh32StateSize is the length of a saved state.
+const xxh32StateSize = 16 + 8 + 1 + 16
+
+func (x *xxh32State) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, xxh32StateSize)
+	for _, v := range x.v {
+		b = binary.LittleEndian.AppendUint32(b, v)
+	}
+	b = binary.LittleEndian.AppendUint64(b, x.total)
+	b = append(b, byte(x.used))
+	return append(b, x.buf[:]...), nil
+}
+
+func (x *xxh32State) UnmarshalBinary(b []byte) error {
+	if len(b) != xxh32StateSize || b[24] >= 16 {
+		return errors.New("invalid xxh32 state")
+	}
+	for i := range x.v {
+		x.v[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	x.total = binary.LittleEndian.Uint64(b[16:])
+	x.used = int(b[24])
+	copy(x.buf[:], b[25:])
+	return nil
+}
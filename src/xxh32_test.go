@@ -0,0 +1,32 @@
+package lz4
+
+import (
+	"testing"
+
+	"github.com/pierrec/xxHash/xxHash32"
+)
+
+// TestXXH32 compares the resumable hash with xxHash32 for every length up
+// to a few stripes, saving and restoring the state at each split point.
+func TestXXH32(t *testing.T) {
+	data := make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	for n := range len(data) {
+		want := xxHash32.Checksum(data[:n], 0)
+		for split := 0; split <= n; split++ {
+			x := newXXH32()
+			x.Write(data[:split])
+			state, _ := x.MarshalBinary()
+			y := newXXH32()
+			if err := y.UnmarshalBinary(state); err != nil {
+				t.Fatal(err)
+			}
+			y.Write(data[split:n])
+			if got := y.Sum32(); got != want {
+				t.Fatalf("length %d split at %d: got %08x, want %08x", n, split, got, want)
+			}
+		}
+	}
+}